@@ -3,33 +3,81 @@ package aws
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
 	"github.com/pete911/ec2/internal/aws/iam"
+	"github.com/pete911/ec2/internal/aws/s3"
+	"github.com/pete911/ec2/internal/aws/ssm"
 	"github.com/pete911/ec2/internal/aws/vpc"
+	"github.com/pete911/ec2/internal/aws/wait"
 	"github.com/pete911/ec2/internal/errs"
+	"github.com/pete911/ec2/internal/progress"
+	"io"
 	"log/slog"
+	"maps"
+	"slices"
 	"strings"
 	"time"
 )
 
-const ssmImageId = "resolve:ssm:/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64"
+// DefaultImageId latest al2023 AMI resolved by EC2 from SSM parameter
+const DefaultImageId = "resolve:ssm:/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64"
+
+// ErrInstanceExists is returned when not terminated instance with the same name already exists
+var ErrInstanceExists = errors.New("already exists")
+
+// notTerminatedStates are instance states of instances that still hold their name and resources
+var notTerminatedStates = []string{"pending", "running", "shutting-down", "stopping", "stopped"}
 
 type Client struct {
 	AccountId string
 	Region    string
+	Partition string
 	logger    *slog.Logger
 	vpcSvc    vpc.Service
 	iamSvc    iam.Service
+	ssmSvc    ssm.Service
+	s3Svc     s3.Service
 	ec2Svc    *ec2.Client
+	reporter  progress.Reporter
+	// waitInterval is interval between retries and polls of eventually consistent resources
+	waitInterval time.Duration
+}
+
+// Options configures AWS SDK used by the client
+type Options struct {
+	// LogApiCalls logs every AWS API call with operation, latency, retry count and request id
+	LogApiCalls bool
+	// Recorder records every AWS API request and response
+	Recorder *Recorder
+	// Replayer serves recorded responses instead of calling AWS, credentials are not required
+	Replayer *Replayer
+	// EndpointUrl is used by all services instead of AWS endpoints, e.g. LocalStack http://localhost:4566
+	EndpointUrl string
+	// ServiceEndpointUrls overrides EndpointUrl for the service, key is service name (ec2, iam, sts or ssm)
+	ServiceEndpointUrls map[string]string
+	// WaitInterval is interval between retries and polls of eventually consistent resources (e.g. terminated instance
+	// or security group that is still in use), wait.DefaultInterval is used if it is not set
+	WaitInterval time.Duration
 }
 
-func NewClient(logger *slog.Logger, region string) (Client, error) {
-	cfg, err := newAWSConfig("")
+// serviceConfig returns copy of the config with service endpoint url set
+func (o Options) serviceConfig(cfg aws.Config, service string) aws.Config {
+	if url := o.ServiceEndpointUrls[service]; url != "" {
+		cfg.BaseEndpoint = aws.String(url)
+	}
+	return cfg
+}
+
+func NewClient(logger *slog.Logger, region string, opts Options) (Client, error) {
+	cfg, err := newAWSConfig("", opts)
 	if err != nil {
 		return Client{}, err
 	}
@@ -39,104 +87,453 @@ func NewClient(logger *slog.Logger, region string) (Client, error) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
-	out, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	return NewClientFromConfig(ctx, logger, cfg, opts)
+}
+
+// NewClientFromConfig creates client from already loaded AWS config, region is taken from the config. Endpoint urls
+// and API call logging are applied from options, record and replay have to be set on the config HTTP client
+func NewClientFromConfig(ctx context.Context, logger *slog.Logger, cfg aws.Config, opts Options) (Client, error) {
+	if opts.EndpointUrl != "" {
+		cfg.BaseEndpoint = aws.String(opts.EndpointUrl)
+	}
+	if opts.LogApiCalls {
+		cfg.APIOptions = append(cfg.APIOptions, logApiCallsMiddleware(logger))
+	}
+	region := cfg.Region
+
+	out, err := sts.NewFromConfig(opts.serviceConfig(cfg, "sts")).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
 	if err != nil {
 		return Client{}, errs.FromAwsApi(err, "sts get-caller-identity")
 	}
+	// caller ARN is in the partition of the region, local emulators use aws partition
+	partition := "aws"
+	if callerArn, err := arn.Parse(aws.ToString(out.Arn)); err == nil {
+		partition = callerArn.Partition
+	}
+
+	waitInterval := opts.WaitInterval
+	if waitInterval <= 0 {
+		waitInterval = wait.DefaultInterval
+	}
 
 	return Client{
-		logger:    logger.With("component", "aws.client"),
-		AccountId: aws.ToString(out.Account),
-		Region:    region,
-		vpcSvc:    vpc.NewService(logger, cfg),
-		iamSvc:    iam.NewService(logger, cfg),
-		ec2Svc:    ec2.NewFromConfig(cfg),
+		logger:       logger.With("component", "aws.client"),
+		AccountId:    aws.ToString(out.Account),
+		Region:       region,
+		Partition:    partition,
+		vpcSvc:       vpc.NewService(logger, opts.serviceConfig(cfg, "ec2")).WithWaitInterval(waitInterval),
+		iamSvc:       iam.NewService(logger, opts.serviceConfig(cfg, "iam"), partition).WithWaitInterval(waitInterval),
+		ssmSvc:       ssm.NewService(logger, opts.serviceConfig(cfg, "ssm")),
+		s3Svc:        s3.NewService(logger, cfg),
+		ec2Svc:       ec2.NewFromConfig(opts.serviceConfig(cfg, "ec2")),
+		waitInterval: waitInterval,
 	}, nil
 }
 
+// WithReporter returns client that reports create and delete progress events to the reporter
+func (c Client) WithReporter(reporter progress.Reporter) Client {
+	c.reporter = reporter
+	return c
+}
+
 func (c Client) GetVpcs(ctx context.Context) ([]vpc.Vpc, error) {
 	return c.vpcSvc.GetVpcs(ctx)
 }
 
+func (c Client) CreateNetwork(ctx context.Context, metadata MetadataInput, cidr string) (vpc.Subnet, error) {
+	return c.vpcSvc.CreateNetwork(ctx, cidr, metadata.Tags)
+}
+
+func (c Client) DeleteNetwork(ctx context.Context, vpcId string) error {
+	return c.vpcSvc.DeleteNetwork(ctx, vpcId)
+}
+
+// DescribeOrphanedNetworks returns VPCs created by CreateNetwork (tagged with metadata tags, except Name) that have no
+// not terminated instance, e.g. because the instance was terminated outside this tool or its delete failed
+func (c Client) DescribeOrphanedNetworks(ctx context.Context, metadata MetadataInput) ([]vpc.Vpc, error) {
+	tags := make(map[string]string)
+	for k, v := range metadata.Tags {
+		if k != "Name" {
+			tags[k] = v
+		}
+	}
+	vpcs, err := c.vpcSvc.DescribeVpcsByTags(ctx, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphaned []vpc.Vpc
+	for _, v := range vpcs {
+		inUse, err := c.isUsedByInstance(ctx, map[string]string{"vpc-id": v.Id})
+		if err != nil {
+			return nil, err
+		}
+		if !inUse {
+			orphaned = append(orphaned, v)
+		}
+	}
+	return orphaned, nil
+}
+
+// DeleteOrphanedNetwork deletes VPC created by CreateNetwork, VPC is checked again before delete, because instance could
+// have been launched in it since it was listed
+func (c Client) DeleteOrphanedNetwork(ctx context.Context, vpcId string) error {
+	inUse, err := c.isUsedByInstance(ctx, map[string]string{"vpc-id": vpcId})
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return fmt.Errorf("vpc %s is used by instance, skipping delete", vpcId)
+	}
+	if err := c.vpcSvc.DeleteNetwork(ctx, vpcId); err != nil {
+		return err
+	}
+	c.reportDeleted("vpc", vpcId)
+	return nil
+}
+
+// CreateSSMEndpoints creates (or reuses existing) SSM interface endpoints in the subnets VPC, endpoints and their
+// security group are named and tagged by metadata. Created resources are returned on error as well
+func (c Client) CreateSSMEndpoints(ctx context.Context, metadata MetadataInput, subnets []vpc.Subnet, cidrBlocks, services []string) (vpc.InterfaceEndpoints, error) {
+	in := vpc.InterfaceEndpointsInput{
+		VpcId:      subnets[0].VpcId,
+		CidrBlocks: cidrBlocks,
+		Name:       metadata.Name,
+		Tags:       metadata.Tags,
+	}
+	// only one subnet per AZ is allowed
+	azs := make(map[string]bool)
+	for _, subnet := range subnets {
+		if !azs[subnet.AvailabilityZone] {
+			azs[subnet.AvailabilityZone] = true
+			in.SubnetIds = append(in.SubnetIds, subnet.Id)
+		}
+	}
+	for _, service := range services {
+		in.ServiceNames = append(in.ServiceNames, vpc.EndpointServiceName(c.Partition, c.Region, service))
+	}
+	return c.vpcSvc.CreateInterfaceEndpoints(ctx, in)
+}
+
+// DeleteCreatedSSMEndpoints deletes endpoints and security group created by CreateSSMEndpoints, unless an instance
+// already uses them (e.g. concurrent create in the same VPC reused them)
+func (c Client) DeleteCreatedSSMEndpoints(ctx context.Context, metadata MetadataInput, created vpc.InterfaceEndpoints) error {
+	inUse, err := c.isUsedByInstance(ctx, map[string]string{"vpc-id": created.VpcId, "tag:" + SsmEndpointsTagKey: metadata.Name})
+	if err != nil {
+		return err
+	}
+	if inUse {
+		c.logger.InfoContext(ctx, fmt.Sprintf("ssm endpoints in %s vpc are used by other instances, skipping delete", created.VpcId))
+		return nil
+	}
+	return c.vpcSvc.DeleteCreatedInterfaceEndpoints(ctx, created)
+}
+
+func (c Client) GetVpcEndpoints(ctx context.Context, vpcId string) ([]vpc.VpcEndpoint, error) {
+	return c.vpcSvc.GetVpcEndpoints(ctx, vpcId)
+}
+
+func (c Client) SendShellCommand(ctx context.Context, instanceIds []string, command string, timeout time.Duration) (string, error) {
+	return c.ssmSvc.SendShellCommand(ctx, instanceIds, command, timeout)
+}
+
+func (c Client) GetCommandInvocation(ctx context.Context, commandId, instanceId string) (ssm.CommandInvocation, error) {
+	return c.ssmSvc.GetCommandInvocation(ctx, commandId, instanceId)
+}
+
+func (c Client) CancelCommand(ctx context.Context, commandId string, instanceIds []string) error {
+	return c.ssmSvc.CancelCommand(ctx, commandId, instanceIds)
+}
+
+func (c Client) PutObject(ctx context.Context, bucket, key string, body io.ReadSeeker, size int64) error {
+	return c.s3Svc.PutObject(ctx, bucket, key, body, size)
+}
+
+func (c Client) GetObject(ctx context.Context, bucket, key string, w io.Writer) error {
+	return c.s3Svc.GetObject(ctx, bucket, key, w)
+}
+
+func (c Client) HeadObjectSize(ctx context.Context, bucket, key string) (int64, error) {
+	return c.s3Svc.HeadObjectSize(ctx, bucket, key)
+}
+
+func (c Client) DeleteObject(ctx context.Context, bucket, key string) error {
+	return c.s3Svc.DeleteObject(ctx, bucket, key)
+}
+
+func (c Client) GetInstanceProfile(ctx context.Context, name string) (iam.InstanceProfile, error) {
+	return c.iamSvc.GetInstanceProfile(ctx, name)
+}
+
+func (c Client) PutRolePolicy(ctx context.Context, roleName string, policy iam.InlinePolicyInput) error {
+	return c.iamSvc.PutRolePolicy(ctx, roleName, policy)
+}
+
+func (c Client) GetRolePolicies(ctx context.Context, roleName string) ([]string, []string, error) {
+	return c.iamSvc.GetRolePolicies(ctx, roleName)
+}
+
+func (c Client) DeleteRolePolicy(ctx context.Context, roleName, policyName string) error {
+	return c.iamSvc.DeleteRolePolicy(ctx, roleName, policyName)
+}
+
 func (c Client) TerminateInstance(ctx context.Context, in Instance) error {
+	instance, err := c.TerminateInstanceAndWait(ctx, in)
+	if err != nil {
+		return err
+	}
+	return c.DeleteInstancesResources(ctx, Instances{instance})
+}
+
+// TerminateInstanceAndWait terminates instance and waits for it to terminate, security group and instance profile
+// are not deleted, use DeleteInstancesResources once the instances are terminated
+func (c Client) TerminateInstanceAndWait(ctx context.Context, in Instance) (Instance, error) {
 	// get instance that matches project tags and the name
 	instance, err := c.DescribeInstanceById(ctx, in.Id)
 	if err != nil {
-		return err
+		return Instance{}, err
 	}
 
 	if _, err := c.ec2Svc.TerminateInstances(ctx, &ec2.TerminateInstancesInput{InstanceIds: []string{instance.Id}}); err != nil {
-		return errs.FromAwsApi(err, "ec2 terminate-instance")
+		return Instance{}, errs.FromAwsApi(err, "ec2 terminate-instance")
 	}
-	c.logger.InfoContext(ctx, fmt.Sprintf("terminating instace %s", instance.Id))
+	c.logger.DebugContext(ctx, fmt.Sprintf("terminating instace %s", instance.Id))
+	progress.Report(c.reporter, progress.Event{Type: progress.Info, Instance: instance.Name, Resource: "instance", Id: instance.Id, Message: "terminating"})
 
-	if err := c.iamSvc.DeleteInstanceProfile(ctx, instance.InstanceProfile); err != nil {
-		return err
+	// wait for instance to terminate (18 polls, 3 minutes with the default interval, so the caller context has time
+	// left to delete resources), resources of not terminated instance cannot be deleted
+	state := instance.State
+	for x := 0; x < 18 && state != "terminated"; x++ {
+		if err := wait.Sleep(ctx, c.waitInterval); err != nil {
+			return Instance{}, err
+		}
+		status, err := c.DescribeInstanceStatus(ctx, instance.Id)
+		if err != nil {
+			return Instance{}, err
+		}
+		c.logger.DebugContext(ctx, fmt.Sprintf("instance %s state %s", instance.Id, status.InstanceState))
+		if status.InstanceState != state {
+			state = status.InstanceState
+			progress.Report(c.reporter, progress.Event{Type: progress.State, Instance: instance.Name, Resource: "instance", Id: instance.Id, Message: state})
+		}
+	}
+	if state != "terminated" {
+		return Instance{}, fmt.Errorf("instance %s is %s, not terminated yet", instance.Id, state)
 	}
+	return instance, nil
+}
 
-	// wait for instance to terminate
-	for x := 0; x < 10; x++ {
-		time.Sleep(10 * time.Second)
-		status, err := c.DescribeInstanceStatus(ctx, instance.Id)
+// DeleteInstancesResources deletes instance profiles, security groups, elastic IPs, SSM endpoints and managed VPCs of
+// the terminated instances. These resources can be shared by multiple instances, they are deleted only if they are not
+// used by any other instance
+func (c Client) DeleteInstancesResources(ctx context.Context, instances Instances) error {
+	var errList []error
+	profiles := make(map[string]string)
+	securityGroups := make(map[string]SecurityGroup)
+	var eips []string
+	managedVpcs := make(map[string]bool)
+	// ssm endpoints name by VPC id
+	ssmEndpoints := make(map[string]string)
+	var ids []string
+	for _, instance := range instances {
+		ids = append(ids, instance.Id)
+		if allocationId := instance.ManagedEipAllocationId(); allocationId != "" {
+			eips = append(eips, allocationId)
+		}
+		if name := instance.SsmEndpointsName(); name != "" {
+			ssmEndpoints[instance.VpcId] = name
+		}
+		if vpcId := instance.ManagedVpcId(); vpcId != "" {
+			managedVpcs[vpcId] = true
+		}
+		if instance.InstanceProfile != "" {
+			profiles[instance.InstanceProfile] = instance.InstanceProfileArn
+		}
+		for _, sg := range instance.SecurityGroups {
+			securityGroups[sg.Id] = sg
+		}
+	}
+
+	for name, arn := range profiles {
+		inUse, err := c.isUsedByOtherInstance(ctx, ids, map[string]string{"iam-instance-profile.arn": arn})
 		if err != nil {
-			return err
+			errList = append(errList, err)
+			continue
 		}
-		c.logger.InfoContext(ctx, fmt.Sprintf("instance %s state %s", instance.Id, status.InstanceState))
-		if status.InstanceState == "terminated" {
-			break
+		if inUse {
+			c.logger.InfoContext(ctx, fmt.Sprintf("instance profile %s is used by other instances, skipping delete", name))
+			c.reportSkipped("instance profile", name)
+			continue
+		}
+		if err := c.iamSvc.DeleteInstanceProfile(ctx, name); err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		c.reportDeleted("instance profile", name)
+	}
+
+	for _, sg := range securityGroups {
+		inUse, err := c.isUsedByOtherInstance(ctx, ids, map[string]string{"instance.group-id": sg.Id})
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		if inUse {
+			c.logger.InfoContext(ctx, fmt.Sprintf("security group %s is used by other instances, skipping delete", sg.Id))
+			c.reportSkipped("security group", sg.Id)
+			continue
+		}
+		if err := c.deleteSecurityGroup(ctx, sg); err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		c.reportDeleted("security group", sg.Id)
+	}
+
+	// elastic IP is disassociated when the instance is terminated
+	for _, allocationId := range eips {
+		if err := c.ReleaseElasticIp(ctx, allocationId); err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		c.reportDeleted("elastic ip", allocationId)
+	}
+
+	// endpoints have to be deleted before VPC
+	for vpcId, name := range ssmEndpoints {
+		inUse, err := c.isUsedByOtherInstance(ctx, ids, map[string]string{"vpc-id": vpcId, "tag:" + SsmEndpointsTagKey: name})
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		if inUse {
+			c.logger.InfoContext(ctx, fmt.Sprintf("ssm endpoints in %s vpc are used by other instances, skipping delete", vpcId))
+			c.reportSkipped("vpc endpoints", vpcId)
+			continue
 		}
+		if err := c.vpcSvc.DeleteInterfaceEndpoints(ctx, vpcId, name); err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		c.reportDeleted("vpc endpoints", vpcId)
 	}
 
-	// sometimes it takes longer for ENI to disappear, retry deleting of security group
-	// if this happens, add retry loop
-	for _, sg := range instance.SecurityGroups {
+	for vpcId := range managedVpcs {
+		inUse, err := c.isUsedByOtherInstance(ctx, ids, map[string]string{"vpc-id": vpcId})
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		if inUse {
+			c.logger.InfoContext(ctx, fmt.Sprintf("vpc %s is used by other instances, skipping delete", vpcId))
+			c.reportSkipped("vpc", vpcId)
+			continue
+		}
+		if err := c.vpcSvc.DeleteNetwork(ctx, vpcId); err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		c.reportDeleted("vpc", vpcId)
+	}
+	return errors.Join(errList...)
+}
+
+// reportSkipped reports shared resource that is not deleted, because it is used by other instances
+func (c Client) reportSkipped(resource, id string) {
+	progress.Report(c.reporter, progress.Event{Type: progress.Info, Resource: resource, Id: id, Message: "used by other instances, skipping delete"})
+}
+
+func (c Client) reportDeleted(resource, id string) {
+	progress.Report(c.reporter, progress.Event{Type: progress.Deleted, Resource: resource, Id: id, Message: "deleted"})
+}
+
+// deleteSecurityGroup deletes security group, sometimes it takes longer for ENI to disappear, so it retries on
+// dependency violation
+func (c Client) deleteSecurityGroup(ctx context.Context, sg SecurityGroup) error {
+	var err error
+	for x := 0; x < 6; x++ {
 		// has to use security group id, name only works in default VPC
-		if _, err := c.ec2Svc.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{GroupId: aws.String(sg.Id)}); err != nil {
-			return errs.FromAwsApi(err, "ec2 delete-security-group")
+		if _, err = c.ec2Svc.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{GroupId: aws.String(sg.Id)}); err == nil {
+			c.logger.InfoContext(ctx, fmt.Sprintf("deleted %s %s security group", sg.Name, sg.Id))
+			return nil
+		}
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "DependencyViolation" {
+			break
+		}
+		c.logger.InfoContext(ctx, fmt.Sprintf("security group %s still in use, retry in %s", sg.Id, c.waitInterval))
+		if err := wait.Sleep(ctx, c.waitInterval); err != nil {
+			return err
 		}
-		c.logger.InfoContext(ctx, fmt.Sprintf("deleted %s %s security group", sg.Name, sg.Id))
 	}
-	return nil
+	return errs.FromAwsApi(err, "ec2 delete-security-group")
 }
 
+// RunInstance creates security group and instance profile and launches instance
 func (c Client) RunInstance(ctx context.Context, v RunInstancesInput) (Instance, error) {
-	// first check if there is instance with the same tags
-	filters := append(v.Metadata.toTagFilter(), types.Filter{Name: aws.String("instance-state-name"), Values: []string{"running"}})
-	instances, err := c.describeInstances(ctx, filters)
-	if err != nil {
+	if err := c.checkInstanceNotExists(ctx, v.Metadata); err != nil {
 		return Instance{}, err
 	}
-	if len(instances) != 0 {
-		return Instance{}, fmt.Errorf("instance with %s name already exists", v.Metadata.Name)
-	}
 
-	securityGroupId, err := c.createSecurityGroup(ctx, v)
+	securityGroupId, err := c.CreateInstanceResources(ctx, v.Metadata, v.Subnet.VpcId, v.InstanceProfile)
 	if err != nil {
 		return Instance{}, err
 	}
+	v.SecurityGroupId = securityGroupId
+	return c.LaunchInstance(ctx, v)
+}
 
-	if err := c.iamSvc.CreateInstanceProfile(ctx, v.InstanceProfile); err != nil {
-		return Instance{}, err
+// CreateInstanceResources creates security group and instance profile that can be shared by multiple instances,
+// returns security group id
+func (c Client) CreateInstanceResources(ctx context.Context, metadata MetadataInput, vpcId string, profile iam.InstanceProfileInput) (string, error) {
+	securityGroupId, err := c.createSecurityGroup(ctx, metadata, vpcId)
+	if err != nil {
+		return "", err
+	}
+	progress.Report(c.reporter, progress.Event{Type: progress.Created, Instance: metadata.Name, Resource: "security group", Id: securityGroupId, Message: "created"})
+
+	if err := c.iamSvc.CreateInstanceProfile(ctx, profile); err != nil {
+		return "", err
+	}
+	progress.Report(c.reporter, progress.Event{Type: progress.Created, Instance: metadata.Name, Resource: "instance profile", Id: profile.Name, Message: "created"})
+	return securityGroupId, nil
+}
+
+// DeleteInstanceResources deletes security group and instance profile created by CreateInstanceResources, it is
+// used to roll back, when no instance has been launched
+func (c Client) DeleteInstanceResources(ctx context.Context, securityGroupId, instanceProfile string) error {
+	if err := c.iamSvc.DeleteInstanceProfile(ctx, instanceProfile); err != nil {
+		return err
 	}
+	if _, err := c.ec2Svc.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{GroupId: aws.String(securityGroupId)}); err != nil {
+		return errs.FromAwsApi(err, "ec2 delete-security-group")
+	}
+	c.logger.InfoContext(ctx, fmt.Sprintf("deleted %s security group", securityGroupId))
+	return nil
+}
 
+// LaunchInstance launches instance with existing security group and instance profile
+func (c Client) LaunchInstance(ctx context.Context, v RunInstancesInput) (Instance, error) {
 	in := &ec2.RunInstancesInput{
 		MaxCount: aws.Int32(1),
 		MinCount: aws.Int32(1),
 		IamInstanceProfile: &types.IamInstanceProfileSpecification{
-			Name: aws.String(v.Metadata.Name),
+			Name: aws.String(v.InstanceProfile.Name),
 		},
-		ImageId:          aws.String(ssmImageId),
-		InstanceType:     types.InstanceTypeT3Micro,
-		SecurityGroupIds: []string{securityGroupId},
+		ImageId:          aws.String(v.imageId()),
+		InstanceType:     types.InstanceType(v.InstanceType),
+		SecurityGroupIds: []string{v.SecurityGroupId},
 		SubnetId:         aws.String(v.Subnet.Id),
 		TagSpecifications: []types.TagSpecification{
 			{
 				ResourceType: types.ResourceTypeInstance,
-				Tags:         v.Metadata.toTags(),
+				Tags:         v.instanceTags(),
 			},
 		},
 		UserData: aws.String(base64.StdEncoding.EncodeToString([]byte(v.UserData))),
 	}
+	v.setIpv6(in)
+	v.setLaunchTemplate(in)
 
 	out, err := c.ec2Svc.RunInstances(ctx, in)
 	if err != nil {
@@ -148,9 +545,43 @@ func (c Client) RunInstance(ctx context.Context, v RunInstancesInput) (Instance,
 
 	instance := ToInstance(out.Instances[0])
 	c.logger.DebugContext(ctx, fmt.Sprintf("launching instace %s", instance.Id))
+	progress.Report(c.reporter, progress.Event{Type: progress.Created, Instance: v.Metadata.Name, Resource: "instance", Id: instance.Id, Message: "launched"})
 	return instance, nil
 }
 
+// checkInstanceNotExists returns error if there is not terminated instance with the same tags
+func (c Client) checkInstanceNotExists(ctx context.Context, metadata MetadataInput) error {
+	return c.CheckInstancesNotExist(ctx, []MetadataInput{metadata})
+}
+
+// CheckInstancesNotExist returns error if there is not terminated (e.g. stopped) instance with the same tags as any of
+// the metadata, the metadata have to differ only in name
+func (c Client) CheckInstancesNotExist(ctx context.Context, metadata []MetadataInput) error {
+	if len(metadata) == 0 {
+		return nil
+	}
+	var names []string
+	for _, m := range metadata {
+		names = append(names, m.Name)
+	}
+	var filters []types.Filter
+	for _, filter := range metadata[0].toTagFilter() {
+		if aws.ToString(filter.Name) == "tag:Name" {
+			filter.Values = names
+		}
+		filters = append(filters, filter)
+	}
+	filters = append(filters, types.Filter{Name: aws.String("instance-state-name"), Values: notTerminatedStates})
+	instances, err := c.describeInstances(ctx, filters)
+	if err != nil {
+		return err
+	}
+	if len(instances) != 0 {
+		return fmt.Errorf("%s instance with %s name %w", instances[0].State, instances[0].Name, ErrInstanceExists)
+	}
+	return nil
+}
+
 func (c Client) DescribeInstanceStatus(ctx context.Context, id string) (InstanceStatus, error) {
 	in := &ec2.DescribeInstanceStatusInput{InstanceIds: []string{id}, IncludeAllInstances: aws.Bool(true)}
 	out, err := c.ec2Svc.DescribeInstanceStatus(ctx, in)
@@ -175,11 +606,21 @@ func (c Client) DescribeInstanceById(ctx context.Context, id string) (Instance,
 	return instances[0], nil
 }
 
+// DescribeInstancesByNamePrefix returns running instances with the name prefix and tags
 func (c Client) DescribeInstancesByNamePrefix(ctx context.Context, prefix string, tags map[string]string) (Instances, error) {
+	return c.describeInstancesByNamePrefix(ctx, prefix, tags, []string{"running"})
+}
+
+// DescribeAllInstancesByNamePrefix returns instances with the name prefix and tags that are not terminated
+func (c Client) DescribeAllInstancesByNamePrefix(ctx context.Context, prefix string, tags map[string]string) (Instances, error) {
+	return c.describeInstancesByNamePrefix(ctx, prefix, tags, []string{"pending", "running", "stopping", "stopped"})
+}
+
+func (c Client) describeInstancesByNamePrefix(ctx context.Context, prefix string, tags map[string]string, states []string) (Instances, error) {
 	if _, ok := tags["Name"]; ok {
 		delete(tags, "Name")
 	}
-	filters := []types.Filter{{Name: aws.String("instance-state-name"), Values: []string{"running"}}}
+	filters := []types.Filter{{Name: aws.String("instance-state-name"), Values: states}}
 	for k, v := range tags {
 		filters = append(filters, types.Filter{Name: aws.String(fmt.Sprintf("tag:%s", k)), Values: []string{v}})
 	}
@@ -197,6 +638,57 @@ func (c Client) DescribeInstancesByNamePrefix(ctx context.Context, prefix string
 	return filteredInstances, nil
 }
 
+func (c Client) DescribeVolumes(ctx context.Context, ids []string) (Volumes, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	in := &ec2.DescribeVolumesInput{VolumeIds: ids}
+	var volumes Volumes
+	for {
+		out, err := c.ec2Svc.DescribeVolumes(ctx, in)
+		if err != nil {
+			return nil, errs.FromAwsApi(err, "ec2 describe-volumes")
+		}
+		volumes = append(volumes, toVolumes(out.Volumes)...)
+		if aws.ToString(out.NextToken) == "" {
+			break
+		}
+		in.NextToken = out.NextToken
+	}
+	c.logger.DebugContext(ctx, fmt.Sprintf("described %d volumes", len(volumes)))
+	return volumes, nil
+}
+
+// isUsedByInstance returns true if there is not terminated instance matching all filters (filter name - value)
+func (c Client) isUsedByInstance(ctx context.Context, filterValues map[string]string) (bool, error) {
+	return c.isUsedByOtherInstance(ctx, nil, filterValues)
+}
+
+// isUsedByOtherInstance returns true if there is not terminated instance matching all filters (filter name - value),
+// that is not one of the excluded instances (e.g. instances that are being deleted, but are still shutting down)
+func (c Client) isUsedByOtherInstance(ctx context.Context, excludeIds []string, filterValues map[string]string) (bool, error) {
+	filters := []types.Filter{
+		{Name: aws.String("instance-state-name"), Values: notTerminatedStates},
+	}
+	for _, name := range slices.Sorted(maps.Keys(filterValues)) {
+		value := filterValues[name]
+		if value == "" {
+			return false, nil
+		}
+		filters = append(filters, types.Filter{Name: aws.String(name), Values: []string{value}})
+	}
+	instances, err := c.describeInstances(ctx, filters)
+	if err != nil {
+		return false, err
+	}
+	for _, instance := range instances {
+		if !slices.Contains(excludeIds, instance.Id) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (c Client) describeInstances(ctx context.Context, filters []types.Filter) (Instances, error) {
 	in := &ec2.DescribeInstancesInput{Filters: filters}
 	var instances Instances
@@ -217,15 +709,15 @@ func (c Client) describeInstances(ctx context.Context, filters []types.Filter) (
 	return instances, nil
 }
 
-func (c Client) createSecurityGroup(ctx context.Context, in RunInstancesInput) (string, error) {
+func (c Client) createSecurityGroup(ctx context.Context, metadata MetadataInput, vpcId string) (string, error) {
 	sgIn := &ec2.CreateSecurityGroupInput{
-		VpcId:       aws.String(in.Subnet.VpcId),
-		GroupName:   aws.String(in.Metadata.Name),
+		VpcId:       aws.String(vpcId),
+		GroupName:   aws.String(metadata.Name),
 		Description: aws.String("ec2 project"),
 		TagSpecifications: []types.TagSpecification{
 			{
 				ResourceType: types.ResourceTypeSecurityGroup,
-				Tags:         in.Metadata.toTags(),
+				Tags:         metadata.toTags(),
 			},
 		},
 	}
@@ -236,19 +728,19 @@ func (c Client) createSecurityGroup(ctx context.Context, in RunInstancesInput) (
 	}
 
 	groupId := aws.ToString(sgOut.GroupId)
-	c.logger.DebugContext(ctx, fmt.Sprintf("creaetd %s security group with %s id", in.Metadata.Name, groupId))
+	c.logger.DebugContext(ctx, fmt.Sprintf("creaetd %s security group with %s id", metadata.Name, groupId))
 	return groupId, nil
 }
 
 // ListOptedInRegions returns list of opted in regions and default region set in AWS config (or empty string)
-func ListOptedInRegions(ctx context.Context, logger *slog.Logger) (Regions, string, error) {
+func ListOptedInRegions(ctx context.Context, logger *slog.Logger, opts Options) (Regions, string, error) {
 	logger = logger.With("component", "aws.client")
-	cfg, err := newAWSConfig("")
+	cfg, err := newAWSConfig("", opts)
 	if err != nil {
 		return nil, "", err
 	}
 
-	out, err := ec2.NewFromConfig(cfg).DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+	out, err := ec2.NewFromConfig(opts.serviceConfig(cfg, "ec2")).DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
 	if err != nil {
 		return nil, "", errs.FromAwsApi(err, "ec2 describe-regions")
 	}
@@ -258,12 +750,77 @@ func ListOptedInRegions(ctx context.Context, logger *slog.Logger) (Regions, stri
 	return regions, cfg.Region, nil
 }
 
-func newAWSConfig(profile string) (aws.Config, error) {
+// ListRegions returns list of all regions, including the ones that the account is not opted in to
+func ListRegions(ctx context.Context, logger *slog.Logger, opts Options) (Regions, error) {
+	logger = logger.With("component", "aws.client")
+	cfg, err := newAWSConfig("", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := ec2.NewFromConfig(opts.serviceConfig(cfg, "ec2")).DescribeRegions(ctx, &ec2.DescribeRegionsInput{AllRegions: aws.Bool(true)})
+	if err != nil {
+		return nil, errs.FromAwsApi(err, "ec2 describe-regions")
+	}
+
+	regions := toRegions(out.Regions)
+	logger.DebugContext(ctx, fmt.Sprintf("found %d regions", len(regions)))
+	return regions, nil
+}
+
+// DefaultRegion returns region set in AWS config (or empty string)
+func DefaultRegion() (string, error) {
+	cfg, err := newAWSConfig("", Options{})
+	if err != nil {
+		return "", err
+	}
+	return cfg.Region, nil
+}
+
+// DecodeAuthorizationMessage decodes encoded message returned with UnauthorizedOperation error
+func DecodeAuthorizationMessage(ctx context.Context, region, encodedMessage string, opts Options) (string, error) {
+	cfg, err := newAWSConfig("", opts)
+	if err != nil {
+		return "", err
+	}
+	if region != "" {
+		cfg.Region = region
+	}
+
+	in := &sts.DecodeAuthorizationMessageInput{EncodedMessage: aws.String(encodedMessage)}
+	out, err := sts.NewFromConfig(opts.serviceConfig(cfg, "sts")).DecodeAuthorizationMessage(ctx, in)
+	if err != nil {
+		return "", errs.FromAwsApi(err, "sts decode-authorization-message")
+	}
+	return aws.ToString(out.DecodedMessage), nil
+}
+
+// newAWSConfig loads AWS config, all requests are recorded, or served from the recording (replay) if set in options
+func newAWSConfig(profile string, opts Options) (aws.Config, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if profile == "" {
-		return config.LoadDefaultConfig(ctx)
+	var optFns []func(*config.LoadOptions) error
+	if profile != "" {
+		optFns = append(optFns, config.WithSharedConfigProfile(profile))
+	}
+	if opts.Replayer != nil {
+		optFns = append(optFns, config.WithCredentialsProvider(aws.AnonymousCredentials{}))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, optFns...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if opts.EndpointUrl != "" {
+		cfg.BaseEndpoint = aws.String(opts.EndpointUrl)
+	}
+
+	// HTTP client is replaced after the config is loaded, so custom CA bundle is still applied to the recorded requests
+	if opts.Recorder != nil {
+		cfg.HTTPClient = opts.Recorder.client(cfg.HTTPClient)
+	}
+	if opts.Replayer != nil {
+		cfg.HTTPClient = opts.Replayer
 	}
-	return config.LoadDefaultConfig(ctx, config.WithSharedConfigProfile(profile))
+	return cfg, nil
 }
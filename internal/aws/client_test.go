@@ -0,0 +1,40 @@
+package aws
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsUsedByOtherInstance(t *testing.T) {
+	setTestCredentials(t)
+	server := httptest.NewServer(fakeAWS(t))
+	defer server.Close()
+	c, err := NewClient(slog.New(slog.NewTextHandler(io.Discard, nil)), "eu-west-2", Options{EndpointUrl: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		excludeIds []string
+		expected   bool
+	}{
+		{name: "no excluded instances", expected: true},
+		{name: "instance being deleted", excludeIds: []string{testInstanceId}, expected: false},
+		{name: "other instance being deleted", excludeIds: []string{"i-1"}, expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inUse, err := c.isUsedByOtherInstance(context.Background(), tt.excludeIds, map[string]string{"vpc-id": "vpc-1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inUse != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, inUse)
+			}
+		})
+	}
+}
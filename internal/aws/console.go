@@ -0,0 +1,42 @@
+package aws
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/pete911/ec2/internal/errs"
+)
+
+// GetConsoleOutput returns latest serial console output of the instance (up to 64 KB)
+func (c Client) GetConsoleOutput(ctx context.Context, instanceId string) (string, error) {
+	out, err := c.ec2Svc.GetConsoleOutput(ctx, &ec2.GetConsoleOutputInput{
+		InstanceId: aws.String(instanceId),
+		Latest:     aws.Bool(true),
+	})
+	if err != nil {
+		return "", errs.FromAwsApi(err, "ec2 get-console-output")
+	}
+	output, err := base64.StdEncoding.DecodeString(aws.ToString(out.Output))
+	if err != nil {
+		return "", fmt.Errorf("decode console output: %w", err)
+	}
+	return string(output), nil
+}
+
+// GetConsoleScreenshot returns JPG screenshot of the instance console
+func (c Client) GetConsoleScreenshot(ctx context.Context, instanceId string) ([]byte, error) {
+	out, err := c.ec2Svc.GetConsoleScreenshot(ctx, &ec2.GetConsoleScreenshotInput{
+		InstanceId: aws.String(instanceId),
+		WakeUp:     aws.Bool(true),
+	})
+	if err != nil {
+		return nil, errs.FromAwsApi(err, "ec2 get-console-screenshot")
+	}
+	image, err := base64.StdEncoding.DecodeString(aws.ToString(out.ImageData))
+	if err != nil {
+		return nil, fmt.Errorf("decode console screenshot: %w", err)
+	}
+	return image, nil
+}
@@ -0,0 +1,110 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/pete911/ec2/internal/aws/vpc"
+	"github.com/pete911/ec2/internal/errs"
+)
+
+// DryRunResult is result of EC2 API call with DryRun flag, Err is nil if the caller has required permissions
+type DryRunResult struct {
+	Operation string
+	Err       error
+}
+
+// DryRunRunInstance verifies permissions to create security group and launch instance without making any changes.
+// Security group and instance profile do not exist yet, so they are not set on the run-instances call
+func (c Client) DryRunRunInstance(ctx context.Context, v RunInstancesInput) []DryRunResult {
+	sgIn := &ec2.CreateSecurityGroupInput{
+		DryRun:      aws.Bool(true),
+		VpcId:       aws.String(v.Subnet.VpcId),
+		GroupName:   aws.String(v.Metadata.Name),
+		Description: aws.String("ec2 project"),
+	}
+	_, sgErr := c.ec2Svc.CreateSecurityGroup(ctx, sgIn)
+
+	in := &ec2.RunInstancesInput{
+		DryRun:       aws.Bool(true),
+		MaxCount:     aws.Int32(1),
+		MinCount:     aws.Int32(1),
+		ImageId:      aws.String(v.imageId()),
+		InstanceType: types.InstanceType(v.InstanceType),
+		SubnetId:     aws.String(v.Subnet.Id),
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeInstance,
+				Tags:         v.Metadata.toTags(),
+			},
+		},
+	}
+	v.setIpv6(in)
+	v.setLaunchTemplate(in)
+	_, runErr := c.ec2Svc.RunInstances(ctx, in)
+
+	return []DryRunResult{
+		toDryRunResult("ec2 create-security-group", sgErr),
+		toDryRunResult("ec2 run-instances", runErr),
+	}
+}
+
+// DryRunCreateNetwork verifies permissions to create VPC and internet gateway without making any changes. Subnet and
+// route table cannot be verified, because they require existing VPC
+func (c Client) DryRunCreateNetwork(ctx context.Context, cidr string) []DryRunResult {
+	vpcCidr, _, err := vpc.NetworkCidrBlocks(cidr)
+	if err != nil {
+		return []DryRunResult{toDryRunResult("ec2 create-vpc", err)}
+	}
+	_, vpcErr := c.ec2Svc.CreateVpc(ctx, &ec2.CreateVpcInput{DryRun: aws.Bool(true), CidrBlock: aws.String(vpcCidr)})
+	_, igwErr := c.ec2Svc.CreateInternetGateway(ctx, &ec2.CreateInternetGatewayInput{DryRun: aws.Bool(true)})
+	return []DryRunResult{
+		toDryRunResult("ec2 create-vpc", vpcErr),
+		toDryRunResult("ec2 create-internet-gateway", igwErr),
+	}
+}
+
+// DryRunCreateSSMEndpoints verifies permissions to create SSM interface endpoint in the subnet without making any
+// changes
+func (c Client) DryRunCreateSSMEndpoints(ctx context.Context, subnet vpc.Subnet) []DryRunResult {
+	_, err := c.ec2Svc.CreateVpcEndpoint(ctx, &ec2.CreateVpcEndpointInput{
+		DryRun:          aws.Bool(true),
+		VpcId:           aws.String(subnet.VpcId),
+		ServiceName:     aws.String(vpc.EndpointServiceName(c.Partition, c.Region, "ssm")),
+		VpcEndpointType: types.VpcEndpointTypeInterface,
+		SubnetIds:       []string{subnet.Id},
+	})
+	return []DryRunResult{toDryRunResult("ec2 create-vpc-endpoint", err)}
+}
+
+// DryRunAllocateElasticIp verifies permissions to allocate elastic IP without making any changes
+func (c Client) DryRunAllocateElasticIp(ctx context.Context) []DryRunResult {
+	_, err := c.ec2Svc.AllocateAddress(ctx, &ec2.AllocateAddressInput{DryRun: aws.Bool(true), Domain: types.DomainTypeVpc})
+	return []DryRunResult{toDryRunResult("ec2 allocate-address", err)}
+}
+
+// DryRunTerminateInstance verifies permissions to terminate instance and delete its security groups without making
+// any changes
+func (c Client) DryRunTerminateInstance(ctx context.Context, instance Instance) []DryRunResult {
+	in := &ec2.TerminateInstancesInput{DryRun: aws.Bool(true), InstanceIds: []string{instance.Id}}
+	_, err := c.ec2Svc.TerminateInstances(ctx, in)
+	out := []DryRunResult{toDryRunResult("ec2 terminate-instances", err)}
+
+	for _, sg := range instance.SecurityGroups {
+		_, err := c.ec2Svc.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{DryRun: aws.Bool(true), GroupId: aws.String(sg.Id)})
+		out = append(out, toDryRunResult("ec2 delete-security-group", err))
+	}
+	return out
+}
+
+// toDryRunResult converts DryRunOperation error (request would have succeeded) to nil error
+func toDryRunResult(operation string, err error) DryRunResult {
+	var apiErr smithy.APIError
+	if err == nil || errors.As(err, &apiErr) && apiErr.ErrorCode() == "DryRunOperation" {
+		return DryRunResult{Operation: operation}
+	}
+	return DryRunResult{Operation: operation, Err: errs.FromAwsApi(err, operation)}
+}
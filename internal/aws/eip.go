@@ -0,0 +1,143 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/pete911/ec2/internal/errs"
+)
+
+type Address struct {
+	AllocationId  string
+	AssociationId string
+	PublicIp      string
+	InstanceId    string
+	Tags          map[string]string
+}
+
+func toAddress(in types.Address) Address {
+	return Address{
+		AllocationId:  aws.ToString(in.AllocationId),
+		AssociationId: aws.ToString(in.AssociationId),
+		PublicIp:      aws.ToString(in.PublicIp),
+		InstanceId:    aws.ToString(in.InstanceId),
+		Tags:          fromTags(in.Tags),
+	}
+}
+
+// AttachElasticIp associates elastic IP with the instance. If allocation id is empty, new elastic IP tagged by
+// metadata is allocated and recorded in the instance ManagedEipTagKey tag, so it is released with the instance
+func (c Client) AttachElasticIp(ctx context.Context, instance Instance, metadata MetadataInput, allocationId string) (Address, error) {
+	managed := allocationId == ""
+	if managed {
+		out, err := c.ec2Svc.AllocateAddress(ctx, &ec2.AllocateAddressInput{
+			Domain: types.DomainTypeVpc,
+			TagSpecifications: []types.TagSpecification{
+				{ResourceType: types.ResourceTypeElasticIp, Tags: metadata.toTags()},
+			},
+		})
+		if err != nil {
+			return Address{}, errs.FromAwsApi(err, "ec2 allocate-address")
+		}
+		allocationId = aws.ToString(out.AllocationId)
+		c.logger.InfoContext(ctx, fmt.Sprintf("allocated %s elastic ip %s", aws.ToString(out.PublicIp), allocationId))
+	}
+
+	associateOut, err := c.ec2Svc.AssociateAddress(ctx, &ec2.AssociateAddressInput{
+		AllocationId: aws.String(allocationId),
+		InstanceId:   aws.String(instance.Id),
+	})
+	if err != nil {
+		if managed {
+			c.releaseAddress(ctx, allocationId)
+		}
+		return Address{}, errs.FromAwsApi(err, "ec2 associate-address")
+	}
+
+	// without the tag, elastic IP would not be released with the instance
+	if managed {
+		if _, err := c.ec2Svc.CreateTags(ctx, &ec2.CreateTagsInput{
+			Resources: []string{instance.Id},
+			Tags:      []types.Tag{{Key: aws.String(ManagedEipTagKey), Value: aws.String(allocationId)}},
+		}); err != nil {
+			c.disassociateAddress(ctx, aws.ToString(associateOut.AssociationId))
+			c.releaseAddress(ctx, allocationId)
+			return Address{}, errs.FromAwsApi(err, "ec2 create-tags")
+		}
+	}
+
+	addresses, err := c.describeAddresses(ctx, []types.Filter{{Name: aws.String("allocation-id"), Values: []string{allocationId}}})
+	if err != nil {
+		return Address{}, err
+	}
+	if len(addresses) != 1 {
+		return Address{}, fmt.Errorf("expected 1 elastic ip, got %d", len(addresses))
+	}
+	c.logger.InfoContext(ctx, fmt.Sprintf("associated elastic ip %s with %s instance", addresses[0].PublicIp, instance.Id))
+	return addresses[0], nil
+}
+
+// DetachElasticIp disassociates elastic IPs from the instance, elastic IP allocated by AttachElasticIp is released
+func (c Client) DetachElasticIp(ctx context.Context, instance Instance) ([]Address, error) {
+	addresses, err := c.describeAddresses(ctx, []types.Filter{{Name: aws.String("instance-id"), Values: []string{instance.Id}}})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, address := range addresses {
+		if _, err := c.ec2Svc.DisassociateAddress(ctx, &ec2.DisassociateAddressInput{AssociationId: aws.String(address.AssociationId)}); err != nil {
+			return nil, errs.FromAwsApi(err, "ec2 disassociate-address")
+		}
+		c.logger.InfoContext(ctx, fmt.Sprintf("disassociated elastic ip %s from %s instance", address.PublicIp, instance.Id))
+	}
+
+	if allocationId := instance.ManagedEipAllocationId(); allocationId != "" {
+		if err := c.ReleaseElasticIp(ctx, allocationId); err != nil {
+			return nil, err
+		}
+		if _, err := c.ec2Svc.DeleteTags(ctx, &ec2.DeleteTagsInput{
+			Resources: []string{instance.Id},
+			Tags:      []types.Tag{{Key: aws.String(ManagedEipTagKey)}},
+		}); err != nil {
+			return nil, errs.FromAwsApi(err, "ec2 delete-tags")
+		}
+	}
+	return addresses, nil
+}
+
+// ReleaseElasticIp releases elastic IP, it has to be disassociated (e.g. instance is terminated)
+func (c Client) ReleaseElasticIp(ctx context.Context, allocationId string) error {
+	if _, err := c.ec2Svc.ReleaseAddress(ctx, &ec2.ReleaseAddressInput{AllocationId: aws.String(allocationId)}); err != nil {
+		return errs.FromAwsApi(err, "ec2 release-address")
+	}
+	c.logger.InfoContext(ctx, fmt.Sprintf("released elastic ip %s", allocationId))
+	return nil
+}
+
+// disassociateAddress is used to roll back association, error is only logged
+func (c Client) disassociateAddress(ctx context.Context, associationId string) {
+	if _, err := c.ec2Svc.DisassociateAddress(ctx, &ec2.DisassociateAddressInput{AssociationId: aws.String(associationId)}); err != nil {
+		c.logger.ErrorContext(ctx, fmt.Sprintf("roll back: %v", errs.FromAwsApi(err, "ec2 disassociate-address")))
+	}
+}
+
+// releaseAddress is used to roll back allocation, error is only logged
+func (c Client) releaseAddress(ctx context.Context, allocationId string) {
+	if err := c.ReleaseElasticIp(ctx, allocationId); err != nil {
+		c.logger.ErrorContext(ctx, fmt.Sprintf("roll back: %v", err))
+	}
+}
+
+func (c Client) describeAddresses(ctx context.Context, filters []types.Filter) ([]Address, error) {
+	out, err := c.ec2Svc.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{Filters: filters})
+	if err != nil {
+		return nil, errs.FromAwsApi(err, "ec2 describe-addresses")
+	}
+	var addresses []Address
+	for _, v := range out.Addresses {
+		addresses = append(addresses, toAddress(v))
+	}
+	return addresses, nil
+}
@@ -20,6 +20,11 @@ var (
 }`
 )
 
+// ManagedPolicyArn returns ARN of AWS managed policy in the partition (aws, aws-cn, aws-us-gov, ...)
+func ManagedPolicyArn(partition, name string) string {
+	return fmt.Sprintf("arn:%s:iam::aws:policy/%s", partition, name)
+}
+
 type InlinePolicyInput struct {
 	Name     string
 	Document string
@@ -33,7 +38,7 @@ func NewInlinePolicyInput(name, resource string, actions []string) InlinePolicyI
 }
 
 func newDocument(resource string, actions []string) string {
-	if resource != "" {
+	if resource == "" {
 		resource = "*"
 	}
 	actionsList := "*"
@@ -47,7 +52,7 @@ func newDocument(resource string, actions []string) string {
         {
             "Action": ["%s"],
             "Effect": "Allow",
-            "Resource": "%s",
+            "Resource": "%s"
         }
     ]
 }`, actionsList, resource)
@@ -3,6 +3,8 @@ package iam
 import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"maps"
+	"slices"
 )
 
 type InstanceProfileInput struct {
@@ -13,7 +15,8 @@ type InstanceProfileInput struct {
 
 func (i InstanceProfileInput) toTags() []types.Tag {
 	var out []types.Tag
-	for k, v := range i.Tags {
+	for _, k := range slices.Sorted(maps.Keys(i.Tags)) {
+		v := i.Tags[k]
 		out = append(out, types.Tag{Key: aws.String(k), Value: aws.String(v)})
 	}
 	return out
@@ -3,6 +3,8 @@ package iam
 import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"maps"
+	"slices"
 )
 
 type RoleInput struct {
@@ -14,7 +16,8 @@ type RoleInput struct {
 
 func (r RoleInput) toTags() []types.Tag {
 	var out []types.Tag
-	for k, v := range r.Tags {
+	for _, k := range slices.Sorted(maps.Keys(r.Tags)) {
+		v := r.Tags[k]
 		out = append(out, types.Tag{Key: aws.String(k), Value: aws.String(v)})
 	}
 	return out
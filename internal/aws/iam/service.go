@@ -5,23 +5,35 @@ import (
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/pete911/ec2/internal/aws/wait"
 	"github.com/pete911/ec2/internal/errs"
 	"log/slog"
 	"time"
 )
 
 type Service struct {
-	logger *slog.Logger
-	svc    *iam.Client
+	logger       *slog.Logger
+	svc          *iam.Client
+	partition    string
+	waitInterval time.Duration
 }
 
-func NewService(logger *slog.Logger, cfg aws.Config) Service {
+// NewService creates IAM service, partition is used in ARNs of AWS managed policies
+func NewService(logger *slog.Logger, cfg aws.Config, partition string) Service {
 	return Service{
-		logger: logger.With("component", "aws.iam.service"),
-		svc:    iam.NewFromConfig(cfg),
+		logger:       logger.With("component", "aws.iam.service"),
+		svc:          iam.NewFromConfig(cfg),
+		partition:    partition,
+		waitInterval: wait.DefaultInterval,
 	}
 }
 
+// WithWaitInterval returns service that waits the interval for created instance profile to become available
+func (s Service) WithWaitInterval(interval time.Duration) Service {
+	s.waitInterval = interval
+	return s
+}
+
 func (s Service) CreateInstanceProfile(ctx context.Context, in InstanceProfileInput) error {
 	createProfileIn := &iam.CreateInstanceProfileInput{
 		InstanceProfileName: aws.String(in.Name),
@@ -47,17 +59,38 @@ func (s Service) CreateInstanceProfile(ctx context.Context, in InstanceProfileIn
 
 	// insane shitty aws is able to list and describe instance profile, but run instance will report invalid name
 	// or similar crap. we need to do classic old school sleep to get around AWS "eventual consistency" crap
-	s.logger.DebugContext(ctx, "waiting 10 seconds for instance profile to become available")
-	time.Sleep(10 * time.Second)
+	s.logger.DebugContext(ctx, fmt.Sprintf("waiting %s for instance profile to become available", s.waitInterval))
+	return wait.Sleep(ctx, s.waitInterval)
+}
+
+func (s Service) GetInstanceProfile(ctx context.Context, name string) (InstanceProfile, error) {
+	out, err := s.svc.GetInstanceProfile(ctx, &iam.GetInstanceProfileInput{InstanceProfileName: aws.String(name)})
+	if err != nil {
+		return InstanceProfile{}, errs.FromAwsApi(err, "iam get-instance-profile")
+	}
+	return ToIamInstanceProfile(out.InstanceProfile), nil
+}
+
+// PutRolePolicy adds inline policy to existing role
+func (s Service) PutRolePolicy(ctx context.Context, roleName string, policy InlinePolicyInput) error {
+	return s.putRolePolicies(ctx, roleName, []InlinePolicyInput{policy})
+}
+
+// DeleteRolePolicy removes inline policy from role
+func (s Service) DeleteRolePolicy(ctx context.Context, roleName, policyName string) error {
+	in := &iam.DeleteRolePolicyInput{RoleName: aws.String(roleName), PolicyName: aws.String(policyName)}
+	if _, err := s.svc.DeleteRolePolicy(ctx, in); err != nil {
+		return errs.FromAwsApi(err, "iam delete-role-policy")
+	}
+	s.logger.DebugContext(ctx, fmt.Sprintf("deleted %s policy from %s role", policyName, roleName))
 	return nil
 }
 
 func (s Service) DeleteInstanceProfile(ctx context.Context, name string) error {
-	instanceProfileOut, err := s.svc.GetInstanceProfile(ctx, &iam.GetInstanceProfileInput{InstanceProfileName: aws.String(name)})
+	instanceProfile, err := s.GetInstanceProfile(ctx, name)
 	if err != nil {
-		return errs.FromAwsApi(err, "iam get-instance-profile")
+		return err
 	}
-	instanceProfile := ToIamInstanceProfile(instanceProfileOut.InstanceProfile)
 
 	for _, roleName := range instanceProfile.RoleNames {
 		if _, err := s.svc.RemoveRoleFromInstanceProfile(ctx, &iam.RemoveRoleFromInstanceProfileInput{
@@ -114,6 +147,24 @@ func (s Service) deleteRole(ctx context.Context, name string) error {
 	return nil
 }
 
+// GetRolePolicies returns inline policy names and attached managed policy ARNs
+func (s Service) GetRolePolicies(ctx context.Context, roleName string) ([]string, []string, error) {
+	inlinePolicies, err := s.svc.ListRolePolicies(ctx, &iam.ListRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return nil, nil, errs.FromAwsApi(err, "iam list-role-policies")
+	}
+	managedPolicies, err := s.svc.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return nil, nil, errs.FromAwsApi(err, "iam list-attached-role-policies")
+	}
+
+	var managedPolicyArns []string
+	for _, policy := range managedPolicies.AttachedPolicies {
+		managedPolicyArns = append(managedPolicyArns, aws.ToString(policy.PolicyArn))
+	}
+	return inlinePolicies.PolicyNames, managedPolicyArns, nil
+}
+
 func (s Service) createEc2Role(ctx context.Context, in RoleInput) error {
 	roleIn := &iam.CreateRoleInput{
 		AssumeRolePolicyDocument: aws.String(ec2AssumeRolePolicyDocument),
@@ -142,7 +193,7 @@ func (s Service) attachRolePolicy(ctx context.Context, roleName string, policyNa
 	}
 
 	for _, policyName := range policyNames {
-		policyArn := fmt.Sprintf("arn:aws:iam::aws:policy/%s", policyName)
+		policyArn := ManagedPolicyArn(s.partition, policyName)
 		in := &iam.AttachRolePolicyInput{RoleName: aws.String(roleName), PolicyArn: aws.String(policyArn)}
 		if _, err := s.svc.AttachRolePolicy(ctx, in); err != nil {
 			return errs.FromAwsApi(err, "iam attach-role-policy")
@@ -0,0 +1,124 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/pete911/ec2/internal/errs"
+	"sort"
+	"time"
+)
+
+// lineage tags link image to its source instance and the image the source instance was launched from
+const (
+	SourceInstanceIdTagKey   = "SourceInstanceId"
+	SourceInstanceNameTagKey = "SourceInstanceName"
+	BaseImageIdTagKey        = "BaseImageId"
+)
+
+type Images []Image
+
+type Image struct {
+	Id           string
+	Name         string
+	State        string
+	CreationDate string
+	SnapshotIds  []string
+	Tags         map[string]string
+}
+
+func toImage(in types.Image) Image {
+	var snapshotIds []string
+	for _, v := range in.BlockDeviceMappings {
+		if v.Ebs != nil && v.Ebs.SnapshotId != nil {
+			snapshotIds = append(snapshotIds, aws.ToString(v.Ebs.SnapshotId))
+		}
+	}
+	return Image{
+		Id:           aws.ToString(in.ImageId),
+		Name:         aws.ToString(in.Name),
+		State:        string(in.State),
+		CreationDate: aws.ToString(in.CreationDate),
+		SnapshotIds:  snapshotIds,
+		Tags:         fromTags(in.Tags),
+	}
+}
+
+// CreateImage creates image (and its snapshots) from the instance, image and snapshots are tagged by metadata and
+// lineage tags. Instance is rebooted unless noReboot is set, file system consistency is not guaranteed without reboot
+func (c Client) CreateImage(ctx context.Context, instance Instance, metadata MetadataInput, noReboot bool) (string, error) {
+	tags := metadata.toTags()
+	for k, v := range map[string]string{
+		SourceInstanceIdTagKey:   instance.Id,
+		SourceInstanceNameTagKey: instance.Name,
+		BaseImageIdTagKey:        instance.ImageId,
+	} {
+		tags = append(tags, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+
+	out, err := c.ec2Svc.CreateImage(ctx, &ec2.CreateImageInput{
+		InstanceId:  aws.String(instance.Id),
+		Name:        aws.String(metadata.Name),
+		Description: aws.String(fmt.Sprintf("ec2 project image from %s instance", instance.Name)),
+		NoReboot:    aws.Bool(noReboot),
+		TagSpecifications: []types.TagSpecification{
+			{ResourceType: types.ResourceTypeImage, Tags: tags},
+			{ResourceType: types.ResourceTypeSnapshot, Tags: tags},
+		},
+	})
+	if err != nil {
+		return "", errs.FromAwsApi(err, "ec2 create-image")
+	}
+	imageId := aws.ToString(out.ImageId)
+	c.logger.InfoContext(ctx, fmt.Sprintf("creating %s image %s from %s instance", metadata.Name, imageId, instance.Id))
+	return imageId, nil
+}
+
+// WaitForImage waits for image to become available
+func (c Client) WaitForImage(ctx context.Context, id string, maxWait time.Duration) (Image, error) {
+	in := &ec2.DescribeImagesInput{ImageIds: []string{id}}
+	out, err := ec2.NewImageAvailableWaiter(c.ec2Svc).WaitForOutput(ctx, in, maxWait)
+	if err != nil {
+		return Image{}, fmt.Errorf("wait for %s image: %w", id, err)
+	}
+	if len(out.Images) != 1 {
+		return Image{}, fmt.Errorf("expected 1 image, got %d", len(out.Images))
+	}
+	return toImage(out.Images[0]), nil
+}
+
+// DescribeImagesByTags returns images owned by the account that have all supplied tags, sorted by name
+func (c Client) DescribeImagesByTags(ctx context.Context, tags map[string]string) (Images, error) {
+	metadata := MetadataInput{Tags: tags}
+	out, err := c.ec2Svc.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Owners:  []string{"self"},
+		Filters: metadata.toTagFilter(),
+	})
+	if err != nil {
+		return nil, errs.FromAwsApi(err, "ec2 describe-images")
+	}
+
+	var images Images
+	for _, v := range out.Images {
+		images = append(images, toImage(v))
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Name < images[j].Name
+	})
+	c.logger.DebugContext(ctx, fmt.Sprintf("described %d images", len(images)))
+	return images, nil
+}
+
+// DeregisterImage deregisters image and deletes its snapshots
+func (c Client) DeregisterImage(ctx context.Context, image Image) error {
+	if _, err := c.ec2Svc.DeregisterImage(ctx, &ec2.DeregisterImageInput{
+		ImageId:                   aws.String(image.Id),
+		DeleteAssociatedSnapshots: aws.Bool(true),
+	}); err != nil {
+		return errs.FromAwsApi(err, "ec2 deregister-image")
+	}
+	c.logger.InfoContext(ctx, fmt.Sprintf("deregistered %s image %s and deleted %d snapshots", image.Name, image.Id, len(image.SnapshotIds)))
+	return nil
+}
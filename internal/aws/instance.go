@@ -3,13 +3,28 @@ package aws
 import (
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/pete911/ec2/internal/aws/iam"
 	"github.com/pete911/ec2/internal/aws/vpc"
+	"maps"
+	"slices"
 	"strings"
 	"time"
 )
 
+const (
+	// ManagedVpcTagKey is instance tag with id of the VPC created for the instance, the VPC is deleted with its last
+	// instance
+	ManagedVpcTagKey = "ManagedVpc"
+	// SsmEndpointsTagKey is instance tag with name of the SSM endpoints created for the instance, the endpoints are
+	// deleted with the last instance (in the VPC) that uses them
+	SsmEndpointsTagKey = "SsmEndpoints"
+	// ManagedEipTagKey is instance tag with allocation id of the elastic IP allocated for the instance, the elastic IP
+	// is released with the instance
+	ManagedEipTagKey = "ManagedEip"
+)
+
 type MetadataInput struct {
 	Name string
 	Tags map[string]string
@@ -17,7 +32,8 @@ type MetadataInput struct {
 
 func (m MetadataInput) toTagFilter() []types.Filter {
 	var out []types.Filter
-	for k, v := range m.Tags {
+	for _, k := range slices.Sorted(maps.Keys(m.Tags)) {
+		v := m.Tags[k]
 		out = append(out, types.Filter{Name: aws.String(fmt.Sprintf("tag:%s", k)), Values: []string{v}})
 	}
 	return out
@@ -25,17 +41,62 @@ func (m MetadataInput) toTagFilter() []types.Filter {
 
 func (m MetadataInput) toTags() []types.Tag {
 	var out []types.Tag
-	for k, v := range m.Tags {
+	for _, k := range slices.Sorted(maps.Keys(m.Tags)) {
+		v := m.Tags[k]
 		out = append(out, types.Tag{Key: aws.String(k), Value: aws.String(v)})
 	}
 	return out
 }
 
 type RunInstancesInput struct {
-	Metadata        MetadataInput
-	Subnet          vpc.Subnet
+	Metadata     MetadataInput
+	Subnet       vpc.Subnet
+	InstanceType string
+	// ImageId of the instance, DefaultImageId is used if it is empty
+	ImageId         string
 	UserData        string
 	InstanceProfile iam.InstanceProfileInput
+	// SecurityGroupId is existing security group used by LaunchInstance, RunInstance creates new one
+	SecurityGroupId string
+	// Ipv6 assigns IPv6 address to the instance, it is always assigned in IPv6-only subnets
+	Ipv6 bool
+	// Tags are additional instance tags (e.g. ManagedVpcTagKey), unlike metadata tags, they are not used to look up
+	// the instance
+	Tags map[string]string
+	// LaunchTemplate is launch template the instance is launched from, fields set by the tool are merged over it
+	LaunchTemplate LaunchTemplate
+}
+
+func (r RunInstancesInput) imageId() string {
+	if r.ImageId == "" {
+		return DefaultImageId
+	}
+	return r.ImageId
+}
+
+// instanceTags returns metadata tags and additional instance tags
+func (r RunInstancesInput) instanceTags() []types.Tag {
+	return toTags(r.tags())
+}
+
+func (r RunInstancesInput) tags() map[string]string {
+	out := make(map[string]string)
+	for k, v := range r.Metadata.Tags {
+		out[k] = v
+	}
+	for k, v := range r.Tags {
+		out[k] = v
+	}
+	return out
+}
+
+// setIpv6 assigns IPv6 address and enables IPv6 instance metadata endpoint (used by SSM agent in IPv6-only subnets)
+func (r RunInstancesInput) setIpv6(in *ec2.RunInstancesInput) {
+	if !r.Ipv6 && !r.Subnet.IsIpv6Only() {
+		return
+	}
+	in.Ipv6AddressCount = aws.Int32(1)
+	in.MetadataOptions = &types.InstanceMetadataOptionsRequest{HttpProtocolIpv6: types.InstanceMetadataProtocolStateEnabled}
 }
 
 type InstanceStatus struct {
@@ -101,21 +162,64 @@ func (i Instances) Names() []string {
 	return out
 }
 
+// FilterByTags returns instances that have all the supplied tags
+func (i Instances) FilterByTags(tags map[string]string) Instances {
+	var out Instances
+	for _, instance := range i {
+		if instance.HasTags(tags) {
+			out = append(out, instance)
+		}
+	}
+	return out
+}
+
 type Instance struct {
-	Id              string
-	Name            string
-	InstanceProfile string
-	SecurityGroups  []SecurityGroup
-	PublicDnsName   string
-	PublicIp        string
-	PrivateDnsName  string
-	PrivateIp       string
-	ImageId         string
-	InstanceType    string
-	State           string
-	StateReason     string
-	LaunchTime      time.Time
-	Tags            map[string]string
+	Id                 string
+	Name               string
+	VpcId              string
+	SubnetId           string
+	InstanceProfile    string
+	InstanceProfileArn string
+	SecurityGroups     []SecurityGroup
+	PublicDnsName      string
+	PublicIp           string
+	PublicIpElastic    bool
+	PrivateDnsName     string
+	PrivateIp          string
+	Ipv6Address        string
+	ImageId            string
+	InstanceType       string
+	VolumeIds          []string
+	State              string
+	StateReason        string
+	LaunchTime         time.Time
+	Tags               map[string]string
+}
+
+// ManagedVpcId returns id of the VPC created for the instance, or empty string if the instance uses existing VPC
+func (i Instance) ManagedVpcId() string {
+	return i.Tags[ManagedVpcTagKey]
+}
+
+// SsmEndpointsName returns name of the SSM endpoints created for the instance, or empty string if the instance does
+// not use them
+func (i Instance) SsmEndpointsName() string {
+	return i.Tags[SsmEndpointsTagKey]
+}
+
+// ManagedEipAllocationId returns allocation id of the elastic IP allocated for the instance, or empty string if the
+// instance does not have one, or it was not allocated by this tool
+func (i Instance) ManagedEipAllocationId() string {
+	return i.Tags[ManagedEipTagKey]
+}
+
+func (i Instance) HasTags(tags map[string]string) bool {
+	for k, v := range tags {
+		if i.Tags[k] != v {
+			return false
+		}
+	}
+	return true
 }
 
 type SecurityGroup struct {
@@ -132,8 +236,9 @@ func ToInstances(in []types.Instance) []Instance {
 }
 
 func ToInstance(in types.Instance) Instance {
-	var instanceProfile string
+	var instanceProfile, instanceProfileArn string
 	if in.IamInstanceProfile != nil {
+		instanceProfileArn = aws.ToString(in.IamInstanceProfile.Arn)
 		if arnParts := strings.Split(aws.ToString(in.IamInstanceProfile.Arn), "/"); len(arnParts) == 2 {
 			instanceProfile = arnParts[1]
 		}
@@ -145,6 +250,19 @@ func ToInstance(in types.Instance) Instance {
 			Name: aws.ToString(v.GroupName),
 		})
 	}
+	var volumeIds []string
+	for _, v := range in.BlockDeviceMappings {
+		if v.Ebs != nil {
+			volumeIds = append(volumeIds, aws.ToString(v.Ebs.VolumeId))
+		}
+	}
+	// public IP owned by the account (not amazon) is elastic IP
+	var publicIpElastic bool
+	for _, v := range in.NetworkInterfaces {
+		if v.Association != nil && aws.ToString(v.Association.PublicIp) == aws.ToString(in.PublicIpAddress) {
+			publicIpElastic = aws.ToString(v.Association.IpOwnerId) != "amazon"
+		}
+	}
 	var state, stateReason string
 	if in.State != nil {
 		state = string(in.State.Name)
@@ -155,20 +273,26 @@ func ToInstance(in types.Instance) Instance {
 	tags := fromTags(in.Tags)
 
 	return Instance{
-		Id:              aws.ToString(in.InstanceId),
-		Name:            tags["Name"],
-		InstanceProfile: instanceProfile,
-		SecurityGroups:  securityGroups,
-		PublicDnsName:   aws.ToString(in.PublicDnsName),
-		PublicIp:        aws.ToString(in.PublicIpAddress),
-		PrivateDnsName:  aws.ToString(in.PrivateDnsName),
-		PrivateIp:       aws.ToString(in.PrivateIpAddress),
-		ImageId:         aws.ToString(in.ImageId),
-		InstanceType:    string(in.InstanceType),
-		State:           state,
-		StateReason:     stateReason,
-		LaunchTime:      aws.ToTime(in.LaunchTime),
-		Tags:            tags,
+		Id:                 aws.ToString(in.InstanceId),
+		Name:               tags["Name"],
+		VpcId:              aws.ToString(in.VpcId),
+		SubnetId:           aws.ToString(in.SubnetId),
+		InstanceProfile:    instanceProfile,
+		InstanceProfileArn: instanceProfileArn,
+		SecurityGroups:     securityGroups,
+		PublicDnsName:      aws.ToString(in.PublicDnsName),
+		PublicIp:           aws.ToString(in.PublicIpAddress),
+		PublicIpElastic:    publicIpElastic,
+		PrivateDnsName:     aws.ToString(in.PrivateDnsName),
+		PrivateIp:          aws.ToString(in.PrivateIpAddress),
+		Ipv6Address:        aws.ToString(in.Ipv6Address),
+		ImageId:            aws.ToString(in.ImageId),
+		InstanceType:       string(in.InstanceType),
+		VolumeIds:          volumeIds,
+		State:              state,
+		StateReason:        stateReason,
+		LaunchTime:         aws.ToTime(in.LaunchTime),
+		Tags:               tags,
 	}
 }
 
@@ -179,3 +303,12 @@ func fromTags(in []types.Tag) map[string]string {
 	}
 	return out
 }
+
+func toTags(in map[string]string) []types.Tag {
+	var out []types.Tag
+	for _, k := range slices.Sorted(maps.Keys(in)) {
+		v := in[k]
+		out = append(out, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return out
+}
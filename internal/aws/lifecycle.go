@@ -0,0 +1,26 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/pete911/ec2/internal/errs"
+)
+
+// StartInstance starts stopped instance, it does not wait for the instance to be running
+func (c Client) StartInstance(ctx context.Context, instance Instance) error {
+	if _, err := c.ec2Svc.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: []string{instance.Id}}); err != nil {
+		return errs.FromAwsApi(err, "ec2 start-instances")
+	}
+	c.logger.InfoContext(ctx, fmt.Sprintf("starting instance %s", instance.Id))
+	return nil
+}
+
+// StopInstance stops running instance, it does not wait for the instance to be stopped
+func (c Client) StopInstance(ctx context.Context, instance Instance) error {
+	if _, err := c.ec2Svc.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: []string{instance.Id}}); err != nil {
+		return errs.FromAwsApi(err, "ec2 stop-instances")
+	}
+	c.logger.InfoContext(ctx, fmt.Sprintf("stopping instance %s", instance.Id))
+	return nil
+}
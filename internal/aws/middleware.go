@@ -0,0 +1,48 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	"log/slog"
+	"time"
+)
+
+// logApiCallsMiddleware logs every AWS API call with operation, latency, retry count and request id. It is added
+// at the end of the initialize step, so latency includes all retries
+func logApiCallsMiddleware(logger *slog.Logger) func(*middleware.Stack) error {
+	logger = logger.With("component", "aws.api")
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("LogApiCall", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			start := time.Now()
+			out, metadata, err := next.HandleInitialize(ctx, in)
+
+			var retries int
+			if results, ok := retry.GetAttemptResults(metadata); ok && len(results.Results) > 0 {
+				retries = len(results.Results) - 1
+			}
+			requestId, _ := awsmiddleware.GetRequestIDMetadata(metadata)
+			// request id is not set on metadata if the call failed
+			var responseErr interface{ ServiceRequestID() string }
+			if requestId == "" && errors.As(err, &responseErr) {
+				requestId = responseErr.ServiceRequestID()
+			}
+
+			attrs := []any{
+				"service", awsmiddleware.GetServiceID(ctx),
+				"operation", awsmiddleware.GetOperationName(ctx),
+				"latency_ms", time.Since(start).Milliseconds(),
+				"retries", retries,
+				"request_id", requestId,
+			}
+			if err != nil {
+				logger.WarnContext(ctx, "aws api call failed", append(attrs, "error", err)...)
+				return out, metadata, err
+			}
+			logger.InfoContext(ctx, "aws api call", attrs...)
+			return out, metadata, nil
+		}), middleware.After)
+	}
+}
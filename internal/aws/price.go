@@ -0,0 +1,28 @@
+package aws
+
+//go:generate go run ./pricegen price_data.go
+
+// hoursPerMonth is average number of hours in a month used by AWS pricing
+const hoursPerMonth = 730
+
+// InstanceHourlyPrice returns on-demand linux hourly price in USD for instance type in region, false is returned
+// if the price is not in the offline price table
+func InstanceHourlyPrice(region, instanceType string) (float64, bool) {
+	price, ok := instancePricesMap[region][instanceType]
+	return price, ok
+}
+
+// VolumeHourlyPrice returns EBS volume hourly price in USD, false is returned if the price is not in the offline
+// price table
+func VolumeHourlyPrice(region string, volume Volume) (float64, bool) {
+	price, ok := volumePricesMap[region][volume.VolumeType]
+	if !ok {
+		return 0, false
+	}
+	return price * float64(volume.Size) / hoursPerMonth, true
+}
+
+// MonthlyPrice converts hourly to monthly price
+func MonthlyPrice(hourly float64) float64 {
+	return hourly * hoursPerMonth
+}
@@ -0,0 +1,287 @@
+// Partial seed price table, it was not produced by pricegen. It covers only t3 instance types and gp2/gp3 volumes in
+// the regions listed below, other instance families (t3a, t4g, m7i, ...) and newer regions (e.g. ca-west-1,
+// eu-central-2, ap-southeast-5) have no price and their cost is shown as "-". Run `go generate ./internal/aws` (or
+// `task prices`) with AWS credentials to replace it with the full generated table.
+
+package aws
+
+// instancePricesMap on-demand linux hourly price in USD by region and instance type
+var instancePricesMap = map[string]map[string]float64{
+	"af-south-1": {
+		"t3.2xlarge": 0.4352,
+		"t3.large":   0.1088,
+		"t3.medium":  0.0544,
+		"t3.micro":   0.0136,
+		"t3.nano":    0.0068,
+		"t3.small":   0.0272,
+		"t3.xlarge":  0.2176,
+	},
+	"ap-east-1": {
+		"t3.2xlarge": 0.4672,
+		"t3.large":   0.1168,
+		"t3.medium":  0.0584,
+		"t3.micro":   0.0146,
+		"t3.nano":    0.0073,
+		"t3.small":   0.0292,
+		"t3.xlarge":  0.2336,
+	},
+	"ap-northeast-1": {
+		"t3.2xlarge": 0.4352,
+		"t3.large":   0.1088,
+		"t3.medium":  0.0544,
+		"t3.micro":   0.0136,
+		"t3.nano":    0.0068,
+		"t3.small":   0.0272,
+		"t3.xlarge":  0.2176,
+	},
+	"ap-northeast-2": {
+		"t3.2xlarge": 0.416,
+		"t3.large":   0.104,
+		"t3.medium":  0.052,
+		"t3.micro":   0.013,
+		"t3.nano":    0.0065,
+		"t3.small":   0.026,
+		"t3.xlarge":  0.208,
+	},
+	"ap-northeast-3": {
+		"t3.2xlarge": 0.4352,
+		"t3.large":   0.1088,
+		"t3.medium":  0.0544,
+		"t3.micro":   0.0136,
+		"t3.nano":    0.0068,
+		"t3.small":   0.0272,
+		"t3.xlarge":  0.2176,
+	},
+	"ap-south-1": {
+		"t3.2xlarge": 0.3584,
+		"t3.large":   0.0896,
+		"t3.medium":  0.0448,
+		"t3.micro":   0.0112,
+		"t3.nano":    0.0056,
+		"t3.small":   0.0224,
+		"t3.xlarge":  0.1792,
+	},
+	"ap-southeast-1": {
+		"t3.2xlarge": 0.4224,
+		"t3.large":   0.1056,
+		"t3.medium":  0.0528,
+		"t3.micro":   0.0132,
+		"t3.nano":    0.0066,
+		"t3.small":   0.0264,
+		"t3.xlarge":  0.2112,
+	},
+	"ap-southeast-2": {
+		"t3.2xlarge": 0.4224,
+		"t3.large":   0.1056,
+		"t3.medium":  0.0528,
+		"t3.micro":   0.0132,
+		"t3.nano":    0.0066,
+		"t3.small":   0.0264,
+		"t3.xlarge":  0.2112,
+	},
+	"ca-central-1": {
+		"t3.2xlarge": 0.3712,
+		"t3.large":   0.0928,
+		"t3.medium":  0.0464,
+		"t3.micro":   0.0116,
+		"t3.nano":    0.0058,
+		"t3.small":   0.0232,
+		"t3.xlarge":  0.1856,
+	},
+	"eu-central-1": {
+		"t3.2xlarge": 0.384,
+		"t3.large":   0.096,
+		"t3.medium":  0.048,
+		"t3.micro":   0.012,
+		"t3.nano":    0.006,
+		"t3.small":   0.024,
+		"t3.xlarge":  0.192,
+	},
+	"eu-north-1": {
+		"t3.2xlarge": 0.3456,
+		"t3.large":   0.0864,
+		"t3.medium":  0.0432,
+		"t3.micro":   0.0108,
+		"t3.nano":    0.0054,
+		"t3.small":   0.0216,
+		"t3.xlarge":  0.1728,
+	},
+	"eu-south-1": {
+		"t3.2xlarge": 0.3904,
+		"t3.large":   0.0976,
+		"t3.medium":  0.0488,
+		"t3.micro":   0.0122,
+		"t3.nano":    0.0061,
+		"t3.small":   0.0244,
+		"t3.xlarge":  0.1952,
+	},
+	"eu-west-1": {
+		"t3.2xlarge": 0.3648,
+		"t3.large":   0.0912,
+		"t3.medium":  0.0456,
+		"t3.micro":   0.0114,
+		"t3.nano":    0.0057,
+		"t3.small":   0.0228,
+		"t3.xlarge":  0.1824,
+	},
+	"eu-west-2": {
+		"t3.2xlarge": 0.3776,
+		"t3.large":   0.0944,
+		"t3.medium":  0.0472,
+		"t3.micro":   0.0118,
+		"t3.nano":    0.0059,
+		"t3.small":   0.0236,
+		"t3.xlarge":  0.1888,
+	},
+	"eu-west-3": {
+		"t3.2xlarge": 0.3776,
+		"t3.large":   0.0944,
+		"t3.medium":  0.0472,
+		"t3.micro":   0.0118,
+		"t3.nano":    0.0059,
+		"t3.small":   0.0236,
+		"t3.xlarge":  0.1888,
+	},
+	"me-south-1": {
+		"t3.2xlarge": 0.4288,
+		"t3.large":   0.1072,
+		"t3.medium":  0.0536,
+		"t3.micro":   0.0134,
+		"t3.nano":    0.0067,
+		"t3.small":   0.0268,
+		"t3.xlarge":  0.2144,
+	},
+	"sa-east-1": {
+		"t3.2xlarge": 0.5376,
+		"t3.large":   0.1344,
+		"t3.medium":  0.0672,
+		"t3.micro":   0.0168,
+		"t3.nano":    0.0084,
+		"t3.small":   0.0336,
+		"t3.xlarge":  0.2688,
+	},
+	"us-east-1": {
+		"t3.2xlarge": 0.3328,
+		"t3.large":   0.0832,
+		"t3.medium":  0.0416,
+		"t3.micro":   0.0104,
+		"t3.nano":    0.0052,
+		"t3.small":   0.0208,
+		"t3.xlarge":  0.1664,
+	},
+	"us-east-2": {
+		"t3.2xlarge": 0.3328,
+		"t3.large":   0.0832,
+		"t3.medium":  0.0416,
+		"t3.micro":   0.0104,
+		"t3.nano":    0.0052,
+		"t3.small":   0.0208,
+		"t3.xlarge":  0.1664,
+	},
+	"us-west-1": {
+		"t3.2xlarge": 0.3968,
+		"t3.large":   0.0992,
+		"t3.medium":  0.0496,
+		"t3.micro":   0.0124,
+		"t3.nano":    0.0062,
+		"t3.small":   0.0248,
+		"t3.xlarge":  0.1984,
+	},
+	"us-west-2": {
+		"t3.2xlarge": 0.3328,
+		"t3.large":   0.0832,
+		"t3.medium":  0.0416,
+		"t3.micro":   0.0104,
+		"t3.nano":    0.0052,
+		"t3.small":   0.0208,
+		"t3.xlarge":  0.1664,
+	},
+}
+
+// volumePricesMap EBS price in USD per GB-month by region and volume type
+var volumePricesMap = map[string]map[string]float64{
+	"af-south-1": {
+		"gp2": 0.130875,
+		"gp3": 0.1047,
+	},
+	"ap-east-1": {
+		"gp2": 0.132,
+		"gp3": 0.1056,
+	},
+	"ap-northeast-1": {
+		"gp2": 0.12,
+		"gp3": 0.096,
+	},
+	"ap-northeast-2": {
+		"gp2": 0.114,
+		"gp3": 0.0912,
+	},
+	"ap-northeast-3": {
+		"gp2": 0.12,
+		"gp3": 0.096,
+	},
+	"ap-south-1": {
+		"gp2": 0.114,
+		"gp3": 0.0912,
+	},
+	"ap-southeast-1": {
+		"gp2": 0.12,
+		"gp3": 0.096,
+	},
+	"ap-southeast-2": {
+		"gp2": 0.12,
+		"gp3": 0.096,
+	},
+	"ca-central-1": {
+		"gp2": 0.11,
+		"gp3": 0.088,
+	},
+	"eu-central-1": {
+		"gp2": 0.119,
+		"gp3": 0.0952,
+	},
+	"eu-north-1": {
+		"gp2": 0.1045,
+		"gp3": 0.0836,
+	},
+	"eu-south-1": {
+		"gp2": 0.1155,
+		"gp3": 0.0924,
+	},
+	"eu-west-1": {
+		"gp2": 0.11,
+		"gp3": 0.088,
+	},
+	"eu-west-2": {
+		"gp2": 0.116,
+		"gp3": 0.0928,
+	},
+	"eu-west-3": {
+		"gp2": 0.116,
+		"gp3": 0.0928,
+	},
+	"me-south-1": {
+		"gp2": 0.121,
+		"gp3": 0.0968,
+	},
+	"sa-east-1": {
+		"gp2": 0.19,
+		"gp3": 0.152,
+	},
+	"us-east-1": {
+		"gp2": 0.1,
+		"gp3": 0.08,
+	},
+	"us-east-2": {
+		"gp2": 0.1,
+		"gp3": 0.08,
+	},
+	"us-west-1": {
+		"gp2": 0.12,
+		"gp3": 0.096,
+	},
+	"us-west-2": {
+		"gp2": 0.1,
+		"gp3": 0.08,
+	},
+}
@@ -0,0 +1,190 @@
+// pricegen regenerates offline price table (internal/aws/price_data.go) from AWS Price List API. It is meant to be
+// run by maintainers with valid AWS credentials - `go generate ./internal/aws` or `task prices`
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+	"github.com/aws/aws-sdk-go-v2/service/pricing/types"
+	ec2aws "github.com/pete911/ec2/internal/aws"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	instanceFamilies = []string{"t3", "t3a", "t4g", "m7i", "m7g", "c7i", "c7g", "r7i", "r7g"}
+	instanceSizes    = []string{"nano", "micro", "small", "medium", "large", "xlarge", "2xlarge"}
+	volumeTypes      = []string{"gp3", "gp2"}
+)
+
+var tmpl = template.Must(template.New("prices").Parse(`// Code generated by "go run ./pricegen"; DO NOT EDIT.
+
+package aws
+
+// instancePricesMap on-demand linux hourly price in USD by region and instance type
+var instancePricesMap = map[string]map[string]float64{
+{{- range $region, $prices := .Instances }}
+	"{{ $region }}": {
+	{{- range $instanceType, $price := $prices }}
+		"{{ $instanceType }}": {{ $price }},
+	{{- end }}
+	},
+{{- end }}
+}
+
+// volumePricesMap EBS price in USD per GB-month by region and volume type
+var volumePricesMap = map[string]map[string]float64{
+{{- range $region, $prices := .Volumes }}
+	"{{ $region }}": {
+	{{- range $volumeType, $price := $prices }}
+		"{{ $volumeType }}": {{ $price }},
+	{{- end }}
+	},
+{{- end }}
+}
+`))
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: pricegen <output-file>")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	// price list API is available only in few regions, us-east-1 being one of them
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("us-east-1"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	client := pricing.NewFromConfig(cfg)
+
+	data := struct {
+		Instances map[string]map[string]string
+		Volumes   map[string]map[string]string
+	}{
+		Instances: make(map[string]map[string]string),
+		Volumes:   make(map[string]map[string]string),
+	}
+
+	var instanceTypes []string
+	for _, family := range instanceFamilies {
+		for _, size := range instanceSizes {
+			instanceTypes = append(instanceTypes, fmt.Sprintf("%s.%s", family, size))
+		}
+	}
+
+	for _, region := range ec2aws.RegionCodes() {
+		instancePrices, err := getPrices(ctx, client, "instanceType", []types.Filter{
+			anyOf("instanceType", instanceTypes...),
+			termMatch("regionCode", region),
+			termMatch("operatingSystem", "Linux"),
+			termMatch("tenancy", "Shared"),
+			termMatch("preInstalledSw", "NA"),
+			termMatch("capacitystatus", "Used"),
+			termMatch("licenseModel", "No License required"),
+		})
+		if err != nil {
+			log.Fatalf("%s instance prices: %v", region, err)
+		}
+		volumePrices, err := getPrices(ctx, client, "volumeApiName", []types.Filter{
+			anyOf("volumeApiName", volumeTypes...),
+			termMatch("regionCode", region),
+			termMatch("productFamily", "Storage"),
+		})
+		if err != nil {
+			log.Fatalf("%s volume prices: %v", region, err)
+		}
+		if len(instancePrices) > 0 {
+			data.Instances[region] = instancePrices
+		}
+		if len(volumePrices) > 0 {
+			data.Volumes[region] = volumePrices
+		}
+		log.Printf("%s: %d instance types, %d volume types", region, len(instancePrices), len(volumePrices))
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Fatal(err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(os.Args[1], src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// getPrices returns on-demand USD prices keyed by the supplied product attribute
+func getPrices(ctx context.Context, client *pricing.Client, attribute string, filters []types.Filter) (map[string]string, error) {
+	in := &pricing.GetProductsInput{ServiceCode: aws.String("AmazonEC2"), Filters: filters}
+	out := make(map[string]string)
+	paginator := pricing.NewGetProductsPaginator(client, in)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.PriceList {
+			var product priceListItem
+			if err := json.Unmarshal([]byte(item), &product); err != nil {
+				return nil, err
+			}
+			key := product.Product.Attributes[attribute]
+			if price, ok := product.onDemandUSD(); ok && key != "" {
+				out[key] = price
+			}
+		}
+	}
+	return out, nil
+}
+
+type priceListItem struct {
+	Product struct {
+		Attributes map[string]string `json:"attributes"`
+	} `json:"product"`
+	Terms struct {
+		OnDemand map[string]struct {
+			PriceDimensions map[string]struct {
+				PricePerUnit map[string]string `json:"pricePerUnit"`
+			} `json:"priceDimensions"`
+		} `json:"OnDemand"`
+	} `json:"terms"`
+}
+
+// onDemandUSD returns first non-zero on-demand USD price formatted without trailing zeros
+func (p priceListItem) onDemandUSD() (string, bool) {
+	var prices []float64
+	for _, term := range p.Terms.OnDemand {
+		for _, dimension := range term.PriceDimensions {
+			if v, err := strconv.ParseFloat(dimension.PricePerUnit["USD"], 64); err == nil && v > 0 {
+				prices = append(prices, v)
+			}
+		}
+	}
+	if len(prices) == 0 {
+		return "", false
+	}
+	sort.Float64s(prices)
+	return strconv.FormatFloat(prices[0], 'f', -1, 64), true
+}
+
+func termMatch(field, value string) types.Filter {
+	return types.Filter{Type: types.FilterTypeTermMatch, Field: aws.String(field), Value: aws.String(value)}
+}
+
+func anyOf(field string, values ...string) types.Filter {
+	return types.Filter{Type: types.FilterTypeAnyOf, Field: aws.String(field), Value: aws.String(strings.Join(values, ","))}
+}
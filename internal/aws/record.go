@@ -0,0 +1,276 @@
+package aws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// redactedHeaders are not recorded, they contain request signature and session token
+var redactedHeaders = []string{"Authorization", "X-Amz-Security-Token"}
+
+// redactedFields are JSON fields of SSM requests and responses that contain commands and their output, string values
+// are replaced, so the structure is kept and replayed responses can still be deserialized
+var redactedFields = map[string]bool{"Parameters": true, "StandardOutputContent": true, "StandardErrorContent": true}
+
+const (
+	redacted = "REDACTED"
+	// serviceS3 request and response bodies (object contents) are streamed and not recorded, only error responses are
+	serviceS3  = "S3"
+	serviceSSM = "SSM"
+)
+
+// Interaction is single recorded AWS API request and response
+type Interaction struct {
+	Service   string           `json:"service"`
+	Operation string           `json:"operation"`
+	Request   RecordedRequest  `json:"request"`
+	Response  RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	Url    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body,omitempty"`
+	// BodyOmitted is set when the body (S3 object) is not recorded, it is replayed as empty body
+	BodyOmitted bool `json:"body_omitted,omitempty"`
+}
+
+// key returns key used to match replayed request with recorded interaction
+func (i Interaction) key() string {
+	u, err := url.Parse(i.Request.Url)
+	if err != nil {
+		return interactionKey(i.Service, i.Operation, i.Request.Method, i.Request.Url, i.Request.Body)
+	}
+	return interactionKey(i.Service, i.Operation, i.Request.Method, u.RequestURI(), i.Request.Body)
+}
+
+// Recorder appends every AWS API request and response to the file as JSON line, credentials, SSM commands and their
+// output are redacted and S3 objects are not recorded. It is shared by all AWS configs, each config wraps its HTTP
+// client with the recorder
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewRecorder creates (or truncates) the record file
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open record file: %w", err)
+	}
+	return &Recorder{file: f}, nil
+}
+
+// client returns HTTP client that sends requests with the supplied client and records them
+func (r *Recorder) client(next aws.HTTPClient) aws.HTTPClient {
+	if next == nil {
+		next = awshttp.NewBuildableClient()
+	}
+	return recordingClient{recorder: r, next: next}
+}
+
+type recordingClient struct {
+	recorder *Recorder
+	next     aws.HTTPClient
+}
+
+func (c recordingClient) Do(req *http.Request) (*http.Response, error) {
+	service := awsmiddleware.GetServiceID(req.Context())
+	var requestBody []byte
+	if service != serviceS3 {
+		var err error
+		if requestBody, err = readBody(&req.Body); err != nil {
+			return nil, fmt.Errorf("record request: %w", err)
+		}
+	}
+	resp, err := c.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	response := RecordedResponse{StatusCode: resp.StatusCode, Header: resp.Header.Clone()}
+	// S3 objects are streamed to the caller, error responses are small and needed to replay the error
+	if service == serviceS3 && resp.StatusCode < 300 && resp.ContentLength != 0 {
+		response.BodyOmitted = true
+	} else if response.Body, err = readBody(&resp.Body); err != nil {
+		return nil, fmt.Errorf("record response: %w", err)
+	}
+	for _, h := range redactedHeaders {
+		response.Header.Del(h)
+	}
+
+	header := req.Header.Clone()
+	for _, h := range redactedHeaders {
+		header.Del(h)
+	}
+	interaction := Interaction{
+		Service:   service,
+		Operation: awsmiddleware.GetOperationName(req.Context()),
+		Request:   RecordedRequest{Method: req.Method, Url: req.URL.String(), Header: header, Body: redactBody(service, requestBody)},
+		Response:  response,
+	}
+	interaction.Response.Body = redactBody(service, interaction.Response.Body)
+	b, err := json.Marshal(interaction)
+	if err != nil {
+		return nil, fmt.Errorf("record interaction: %w", err)
+	}
+
+	c.recorder.mu.Lock()
+	defer c.recorder.mu.Unlock()
+	if _, err := c.recorder.file.Write(append(b, '\n')); err != nil {
+		return nil, fmt.Errorf("write record file: %w", err)
+	}
+	return resp, nil
+}
+
+// Replayer is HTTP client that serves responses from the record file instead of sending requests to AWS. Requests
+// are matched by service, operation, path and body, identical requests (e.g. status polling) are served in the
+// recorded order
+type Replayer struct {
+	mu           sync.Mutex
+	interactions map[string][]Interaction
+}
+
+func NewReplayer(path string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open replay file: %w", err)
+	}
+	defer f.Close()
+
+	interactions := make(map[string][]Interaction)
+	scanner := bufio.NewScanner(f)
+	// responses (e.g. describe instances) can be larger than default token size
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var interaction Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			return nil, fmt.Errorf("replay file line %d: %w", line, err)
+		}
+		key := interaction.key()
+		interactions[key] = append(interactions[key], interaction)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read replay file: %w", err)
+	}
+	return &Replayer{interactions: interactions}, nil
+}
+
+func (r *Replayer) Do(req *http.Request) (*http.Response, error) {
+	service := awsmiddleware.GetServiceID(req.Context())
+	operation := awsmiddleware.GetOperationName(req.Context())
+	var body []byte
+	if service != serviceS3 {
+		var err error
+		if body, err = readBody(&req.Body); err != nil {
+			return nil, fmt.Errorf("replay request: %w", err)
+		}
+	}
+	key := interactionKey(service, operation, req.Method, req.URL.RequestURI(), redactBody(service, body))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recorded := r.interactions[key]
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("no recorded response for %s %s request", service, operation)
+	}
+	interaction := recorded[0]
+	r.interactions[key] = recorded[1:]
+
+	header := interaction.Response.Header.Clone()
+	if interaction.Response.BodyOmitted {
+		header.Set("Content-Length", "0")
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+		StatusCode:    interaction.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(interaction.Response.Body)),
+		ContentLength: int64(len(interaction.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// readBody reads the whole body and replaces it with a reader of the same content
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	b, err := io.ReadAll(*body)
+	if err != nil {
+		return nil, err
+	}
+	if err := (*body).Close(); err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// redactBody replaces string values of redactedFields in SSM JSON bodies, other bodies are returned unchanged. Replayed
+// requests are redacted as well, so they match the recording
+func redactBody(service string, body []byte) []byte {
+	if service != serviceSSM || len(body) == 0 {
+		return body
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	b, err := json.Marshal(redactFields(v, false))
+	if err != nil {
+		return body
+	}
+	return b
+}
+
+// redactFields replaces strings of redactedFields, redact is set when the value is (part of) redacted field
+func redactFields(v any, redact bool) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for k, field := range value {
+			value[k] = redactFields(field, redact || redactedFields[k])
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = redactFields(item, redact)
+		}
+	case string:
+		if redact {
+			return redacted
+		}
+	}
+	return v
+}
+
+// interactionKey returns key of the request. Idempotency token is random for every request, so it is removed from
+// query protocol (EC2, IAM, STS) bodies
+func interactionKey(service, operation, method, uri string, body []byte) string {
+	if values, err := url.ParseQuery(string(body)); err == nil && values.Has("Action") {
+		values.Del("ClientToken")
+		body = []byte(values.Encode())
+	}
+	return strings.Join([]string{service, operation, method, uri, string(body)}, "\n")
+}
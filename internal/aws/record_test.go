@@ -0,0 +1,404 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pete911/ec2/internal/aws/iam"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// replayEndpoint is endpoint url of testdata recordings, replayed requests are matched by path, so the
+// same endpoint (S3 path style) has to be used
+const replayEndpoint = "http://localhost:4566"
+
+const (
+	testInstanceId = "i-0123456789abcdef0"
+	testCommand    = "cat /etc/app/secret"
+	testStdout     = "s3cr3t-value"
+	testObject     = "object-bytes"
+)
+
+// fakeAWS serves responses of the API calls made by recordFlow, testdata/replay.jsonl was recorded from it
+func fakeAWS(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body := string(b)
+		switch {
+		case strings.Contains(body, "Action=GetCallerIdentity"):
+			w.Header().Set("Content-Type", "text/xml")
+			io.WriteString(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><GetCallerIdentityResult><Arn>arn:aws:iam::123456789012:user/test</Arn><UserId>AIDAEXAMPLE</UserId><Account>123456789012</Account></GetCallerIdentityResult><ResponseMetadata><RequestId>req-1</RequestId></ResponseMetadata></GetCallerIdentityResponse>`)
+		case strings.Contains(body, "Action=DescribeInstances"):
+			w.Header().Set("Content-Type", "text/xml")
+			io.WriteString(w, `<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>req-2</requestId><reservationSet><item><reservationId>r-1</reservationId><instancesSet><item><instanceId>`+testInstanceId+`</instanceId><imageId>ami-1</imageId><instanceState><code>16</code><name>running</name></instanceState><instanceType>t3.micro</instanceType><subnetId>subnet-1</subnetId><vpcId>vpc-1</vpcId><privateIpAddress>10.0.0.10</privateIpAddress><tagSet><item><key>Name</key><value>ec2-test</value></item><item><key>Project</key><value>ec2</value></item></tagSet></item></instancesSet></item></reservationSet></DescribeInstancesResponse>`)
+		case r.Header.Get("X-Amz-Target") == "AmazonSSM.SendCommand":
+			w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+			io.WriteString(w, `{"Command":{"CommandId":"cmd-1","DocumentName":"AWS-RunShellScript","Parameters":{"commands":["`+testCommand+`"],"executionTimeout":["60"]},"Status":"Pending"}}`)
+		case r.Header.Get("X-Amz-Target") == "AmazonSSM.GetCommandInvocation":
+			w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+			io.WriteString(w, `{"CommandId":"cmd-1","InstanceId":"`+testInstanceId+`","Status":"Success","ResponseCode":0,"StandardOutputContent":"`+testStdout+`","StandardErrorContent":""}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/bucket/file.txt":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			io.WriteString(w, testObject)
+		default:
+			t.Errorf("unexpected request %s %s %s", r.Method, r.URL, body)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+}
+
+// setTestCredentials sets static credentials with session token and ignores shared config of the user
+func setTestCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret-access-key")
+	t.Setenv("AWS_SESSION_TOKEN", "session-token")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+}
+
+// recordFlow lists instance, runs command on it and downloads object, it returns command stdout and the object
+func recordFlow(t *testing.T, opts Options) (string, string) {
+	t.Helper()
+	c, err := NewClient(slog.New(slog.NewTextHandler(io.Discard, nil)), "eu-west-2", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.AccountId != "123456789012" {
+		t.Errorf("expected account 123456789012, got %s", c.AccountId)
+	}
+
+	ctx := context.Background()
+	instances, err := c.DescribeInstancesByNamePrefix(ctx, "ec2-test", map[string]string{"Project": "ec2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0].Id != testInstanceId {
+		t.Fatalf("expected %s instance, got %+v", testInstanceId, instances)
+	}
+	commandId, err := c.SendShellCommand(ctx, []string{testInstanceId}, testCommand, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invocation, err := c.GetCommandInvocation(ctx, commandId, testInstanceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invocation.Status != "Success" {
+		t.Errorf("expected Success command status, got %s", invocation.Status)
+	}
+	var object bytes.Buffer
+	if err := c.GetObject(ctx, "bucket", "file.txt", &object); err != nil {
+		t.Fatal(err)
+	}
+	return invocation.Stdout, object.String()
+}
+
+func TestRecord(t *testing.T) {
+	setTestCredentials(t)
+	server := httptest.NewServer(fakeAWS(t))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "record.jsonl")
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, object := recordFlow(t, Options{Recorder: recorder, EndpointUrl: server.URL})
+	if stdout != testStdout || object != testObject {
+		t.Errorf("recording should not change responses, got %q stdout and %q object", stdout, object)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var interactions []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var interaction Interaction
+		if err := json.Unmarshal([]byte(line), &interaction); err != nil {
+			t.Fatal(err)
+		}
+		interactions = append(interactions, interaction.Service+" "+interaction.Operation)
+
+		recorded := string(interaction.Request.Body) + string(interaction.Response.Body)
+		for _, secret := range []string{testCommand, testStdout, testObject} {
+			if strings.Contains(recorded, secret) {
+				t.Errorf("%s %s: %q is recorded", interaction.Service, interaction.Operation, secret)
+			}
+		}
+		for _, h := range redactedHeaders {
+			if interaction.Request.Header.Get(h) != "" {
+				t.Errorf("%s %s: %s header is recorded", interaction.Service, interaction.Operation, h)
+			}
+		}
+		if interaction.Service == serviceS3 && !interaction.Response.BodyOmitted {
+			t.Errorf("S3 object should be omitted")
+		}
+	}
+	expected := "STS GetCallerIdentity, EC2 DescribeInstances, SSM SendCommand, SSM GetCommandInvocation, S3 GetObject"
+	if strings.Join(interactions, ", ") != expected {
+		t.Errorf("expected %s interactions, got %s", expected, strings.Join(interactions, ", "))
+	}
+}
+
+func TestReplay(t *testing.T) {
+	setTestCredentials(t)
+	replayer, err := NewReplayer("testdata/replay.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// requests are served from the recording, nothing listens on the endpoint
+	stdout, object := recordFlow(t, Options{Replayer: replayer, EndpointUrl: replayEndpoint})
+	if stdout != redacted {
+		t.Errorf("expected redacted stdout, got %q", stdout)
+	}
+	if object != "" {
+		t.Errorf("expected empty object, S3 objects are not recorded, got %q", object)
+	}
+
+	// every recorded response is served only once
+	if _, err := replayer.Do(httptest.NewRequest(http.MethodPost, replayEndpoint, nil)); err == nil {
+		t.Error("expected error for request that is not recorded")
+	}
+}
+
+const (
+	ec2Namespace = "http://ec2.amazonaws.com/doc/2016-11-15/"
+	iamNamespace = "https://iam.amazonaws.com/doc/2010-05-08/"
+	testRoleArn  = "arn:aws:iam::123456789012:role/ec2-test"
+	// testProfileArn is ARN of the instance profile created by recordCreateDeleteFlow
+	testProfileArn = "arn:aws:iam::123456789012:instance-profile/ec2-test"
+	testPolicyArn  = "arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore"
+)
+
+// ec2Response returns EC2 query protocol response of the action with supplied elements
+func ec2Response(action, elements string) string {
+	return `<` + action + `Response xmlns="` + ec2Namespace + `"><requestId>req-ec2</requestId>` + elements + `</` + action + `Response>`
+}
+
+// iamResponse returns IAM query protocol response of the action with supplied result elements
+func iamResponse(action, result string) string {
+	return `<` + action + `Response xmlns="` + iamNamespace + `"><` + action + `Result>` + result + `</` + action + `Result><ResponseMetadata><RequestId>req-iam</RequestId></ResponseMetadata></` + action + `Response>`
+}
+
+// fakeCreateDeleteAWS serves responses of the API calls made by recordCreateDeleteFlow, instance state changes with run
+// and terminate instances calls and the first delete security group call fails with dependency violation.
+// testdata/replay_create_delete.jsonl was recorded from it
+func fakeCreateDeleteAWS(t *testing.T) http.Handler {
+	var mu sync.Mutex
+	var instanceState string
+	var sgDeleteAttempts int
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		b, _ := io.ReadAll(r.Body)
+		values, _ := url.ParseQuery(string(b))
+		action := values.Get("Action")
+		w.Header().Set("Content-Type", "text/xml")
+
+		instance := `<instancesSet><item><instanceId>` + testInstanceId + `</instanceId><imageId>ami-1</imageId><instanceState><name>` + instanceState + `</name></instanceState><instanceType>t3.micro</instanceType><subnetId>subnet-1</subnetId><vpcId>vpc-1</vpcId><iamInstanceProfile><arn>` + testProfileArn + `</arn></iamInstanceProfile><groupSet><item><groupId>sg-1</groupId><groupName>ec2-test</groupName></item></groupSet><tagSet><item><key>ManagedVpc</key><value>vpc-1</value></item><item><key>Name</key><value>ec2-test</value></item><item><key>Project</key><value>ec2</value></item></tagSet></item></instancesSet>`
+		subnet := `<subnetId>subnet-1</subnetId><vpcId>vpc-1</vpcId><state>available</state><cidrBlock>10.0.0.0/24</cidrBlock><availabilityZone>eu-west-2a</availabilityZone>`
+		routeTable := `<item><routeTableId>rtb-1</routeTableId><vpcId>vpc-1</vpcId><routeSet><item><destinationCidrBlock>0.0.0.0/0</destinationCidrBlock><gatewayId>igw-1</gatewayId><state>active</state></item></routeSet><associationSet><item><routeTableAssociationId>rtbassoc-1</routeTableAssociationId><subnetId>subnet-1</subnetId><main>false</main></item></associationSet></item>`
+		mainRouteTable := `<item><routeTableId>rtb-main</routeTableId><vpcId>vpc-1</vpcId><associationSet><item><routeTableAssociationId>rtbassoc-main</routeTableAssociationId><main>true</main></item></associationSet></item>`
+
+		switch action {
+		case "GetCallerIdentity":
+			io.WriteString(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><GetCallerIdentityResult><Arn>arn:aws:iam::123456789012:user/test</Arn><UserId>AIDAEXAMPLE</UserId><Account>123456789012</Account></GetCallerIdentityResult><ResponseMetadata><RequestId>req-1</RequestId></ResponseMetadata></GetCallerIdentityResponse>`)
+		// vpc
+		case "CreateVpc":
+			io.WriteString(w, ec2Response(action, `<vpc><vpcId>vpc-1</vpcId><state>pending</state><cidrBlock>10.0.0.0/16</cidrBlock></vpc>`))
+		case "DescribeVpcs":
+			io.WriteString(w, ec2Response(action, `<vpcSet><item><vpcId>vpc-1</vpcId><state>available</state><cidrBlock>10.0.0.0/16</cidrBlock></item></vpcSet>`))
+		case "CreateInternetGateway":
+			io.WriteString(w, ec2Response(action, `<internetGateway><internetGatewayId>igw-1</internetGatewayId></internetGateway>`))
+		case "CreateSubnet":
+			io.WriteString(w, ec2Response(action, `<subnet>`+subnet+`</subnet>`))
+		case "CreateRouteTable":
+			io.WriteString(w, ec2Response(action, `<routeTable><routeTableId>rtb-1</routeTableId><vpcId>vpc-1</vpcId></routeTable>`))
+		case "AssociateRouteTable":
+			io.WriteString(w, ec2Response(action, `<associationId>rtbassoc-1</associationId>`))
+		case "DescribeRouteTables":
+			// created route table is described by id, all route tables are described by vpc id on delete
+			if values.Has("RouteTableId.1") {
+				io.WriteString(w, ec2Response(action, `<routeTableSet>`+routeTable+`</routeTableSet>`))
+				return
+			}
+			io.WriteString(w, ec2Response(action, `<routeTableSet>`+routeTable+mainRouteTable+`</routeTableSet>`))
+		case "DescribeVpcEndpoints":
+			io.WriteString(w, ec2Response(action, `<vpcEndpointSet/>`))
+		case "DescribeInternetGateways":
+			io.WriteString(w, ec2Response(action, `<internetGatewaySet><item><internetGatewayId>igw-1</internetGatewayId><attachmentSet><item><vpcId>vpc-1</vpcId><state>available</state></item></attachmentSet></item></internetGatewaySet>`))
+		case "DescribeSubnets":
+			io.WriteString(w, ec2Response(action, `<subnetSet><item>`+subnet+`</item></subnetSet>`))
+		case "DescribeSecurityGroups":
+			io.WriteString(w, ec2Response(action, `<securityGroupInfo><item><groupId>sg-default</groupId><groupName>default</groupName><vpcId>vpc-1</vpcId></item></securityGroupInfo>`))
+		case "ModifyVpcAttribute", "AttachInternetGateway", "ModifySubnetAttribute", "CreateRoute", "DetachInternetGateway",
+			"DeleteInternetGateway", "DeleteSubnet", "DeleteRouteTable", "DeleteVpc":
+			io.WriteString(w, ec2Response(action, `<return>true</return>`))
+		// instance
+		case "DescribeInstances":
+			// not launched instance and instance in the state that is not in the state filter are not returned
+			if instanceState == "" || (values.Has("Filter.1.Name") && strings.Contains(string(b), "instance-state-name") && !strings.Contains(string(b), "="+instanceState)) {
+				io.WriteString(w, ec2Response(action, `<reservationSet/>`))
+				return
+			}
+			io.WriteString(w, ec2Response(action, `<reservationSet><item><reservationId>r-1</reservationId>`+instance+`</item></reservationSet>`))
+		case "CreateSecurityGroup":
+			io.WriteString(w, ec2Response(action, `<return>true</return><groupId>sg-1</groupId>`))
+		case "RunInstances":
+			instanceState = "running"
+			io.WriteString(w, ec2Response(action, `<reservationId>r-1</reservationId>`+instance))
+		case "TerminateInstances":
+			instanceState = "terminated"
+			io.WriteString(w, ec2Response(action, `<instancesSet><item><instanceId>`+testInstanceId+`</instanceId><currentState><name>shutting-down</name></currentState></item></instancesSet>`))
+		case "DescribeInstanceStatus":
+			io.WriteString(w, ec2Response(action, `<instanceStatusSet><item><instanceId>`+testInstanceId+`</instanceId><instanceState><name>`+instanceState+`</name></instanceState></item></instanceStatusSet>`))
+		case "DeleteSecurityGroup":
+			// network interface of the terminated instance is still attached
+			if sgDeleteAttempts++; sgDeleteAttempts == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `<Response><Errors><Error><Code>DependencyViolation</Code><Message>resource sg-1 has a dependent object</Message></Error></Errors><RequestID>req-sg</RequestID></Response>`)
+				return
+			}
+			io.WriteString(w, ec2Response(action, `<return>true</return>`))
+		// iam
+		case "CreateInstanceProfile":
+			io.WriteString(w, iamResponse(action, `<InstanceProfile><InstanceProfileName>ec2-test</InstanceProfileName><InstanceProfileId>AIPAEXAMPLE</InstanceProfileId><Arn>`+testProfileArn+`</Arn><Path>/</Path><CreateDate>2026-01-01T00:00:00Z</CreateDate><Roles/></InstanceProfile>`))
+		case "CreateRole":
+			io.WriteString(w, iamResponse(action, `<Role><RoleName>ec2-test</RoleName><RoleId>AROAEXAMPLE</RoleId><Arn>`+testRoleArn+`</Arn><Path>/</Path><CreateDate>2026-01-01T00:00:00Z</CreateDate></Role>`))
+		case "GetInstanceProfile":
+			io.WriteString(w, iamResponse(action, `<InstanceProfile><InstanceProfileName>ec2-test</InstanceProfileName><InstanceProfileId>AIPAEXAMPLE</InstanceProfileId><Arn>`+testProfileArn+`</Arn><Path>/</Path><CreateDate>2026-01-01T00:00:00Z</CreateDate><Roles><member><RoleName>ec2-test</RoleName><RoleId>AROAEXAMPLE</RoleId><Arn>`+testRoleArn+`</Arn><Path>/</Path><CreateDate>2026-01-01T00:00:00Z</CreateDate></member></Roles></InstanceProfile>`))
+		case "ListRolePolicies":
+			io.WriteString(w, iamResponse(action, `<PolicyNames/><IsTruncated>false</IsTruncated>`))
+		case "ListAttachedRolePolicies":
+			io.WriteString(w, iamResponse(action, `<AttachedPolicies><member><PolicyName>AmazonSSMManagedInstanceCore</PolicyName><PolicyArn>`+testPolicyArn+`</PolicyArn></member></AttachedPolicies><IsTruncated>false</IsTruncated>`))
+		case "AttachRolePolicy", "AddRoleToInstanceProfile", "RemoveRoleFromInstanceProfile", "DetachRolePolicy", "DeleteRole",
+			"DeleteInstanceProfile":
+			io.WriteString(w, iamResponse(action, ``))
+		default:
+			t.Errorf("unexpected request %s %s %s", r.Method, r.URL, string(b))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+}
+
+// recordCreateDeleteFlow creates network and instance with security group and instance profile, then terminates the
+// instance and deletes its resources and the network. It returns the deleted instance
+func recordCreateDeleteFlow(t *testing.T, opts Options) Instance {
+	t.Helper()
+	// retries and polls (instance profile, terminate, security group) do not need to wait for AWS
+	opts.WaitInterval = time.Millisecond
+	c, err := NewClient(slog.New(slog.NewTextHandler(io.Discard, nil)), "eu-west-2", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	metadata := MetadataInput{Name: "ec2-test", Tags: map[string]string{"Name": "ec2-test", "Project": "ec2"}}
+	subnet, err := c.CreateNetwork(ctx, metadata, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subnet.Id != "subnet-1" || subnet.VpcId != "vpc-1" {
+		t.Fatalf("expected subnet-1 subnet in vpc-1, got %s in %s", subnet.Id, subnet.VpcId)
+	}
+
+	instance, err := c.RunInstance(ctx, RunInstancesInput{
+		Metadata:     metadata,
+		Subnet:       subnet,
+		InstanceType: "t3.micro",
+		ImageId:      "ami-1",
+		InstanceProfile: iam.InstanceProfileInput{
+			Name: metadata.Name,
+			Tags: metadata.Tags,
+			Role: iam.RoleInput{RoleName: metadata.Name, ManagedPolicyNames: []string{"AmazonSSMManagedInstanceCore"}, Tags: metadata.Tags},
+		},
+		Tags: map[string]string{ManagedVpcTagKey: subnet.VpcId},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instance.Id != testInstanceId {
+		t.Fatalf("expected %s instance, got %s", testInstanceId, instance.Id)
+	}
+
+	terminated, err := c.TerminateInstanceAndWait(ctx, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteInstancesResources(ctx, Instances{terminated}); err != nil {
+		t.Fatal(err)
+	}
+	return terminated
+}
+
+// interactionNames returns service and operation of the recorded interactions
+func interactionNames(t *testing.T, path string) []string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var interaction Interaction
+		if err := json.Unmarshal([]byte(line), &interaction); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, interaction.Service+" "+interaction.Operation)
+	}
+	return out
+}
+
+func TestRecordCreateDelete(t *testing.T) {
+	setTestCredentials(t)
+	server := httptest.NewServer(fakeCreateDeleteAWS(t))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "record.jsonl")
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordCreateDeleteFlow(t, Options{Recorder: recorder, EndpointUrl: server.URL})
+
+	interactions := strings.Join(interactionNames(t, path), ", ")
+	for _, expected := range []string{"EC2 CreateVpc", "EC2 RunInstances", "IAM CreateInstanceProfile", "IAM CreateRole",
+		"EC2 TerminateInstances", "IAM DeleteInstanceProfile", "IAM DeleteRole", "EC2 DeleteSecurityGroup", "EC2 DeleteVpc"} {
+		if !strings.Contains(interactions, expected) {
+			t.Errorf("expected %s interaction, got %s", expected, interactions)
+		}
+	}
+}
+
+func TestReplayCreateDelete(t *testing.T) {
+	setTestCredentials(t)
+	replayer, err := NewReplayer("testdata/replay_create_delete.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// requests are served from the recording, nothing listens on the endpoint
+	instance := recordCreateDeleteFlow(t, Options{Replayer: replayer, EndpointUrl: replayEndpoint})
+	if instance.InstanceProfile != "ec2-test" || instance.ManagedVpcId() != "vpc-1" {
+		t.Errorf("expected ec2-test instance profile and vpc-1 managed vpc, got %s and %s", instance.InstanceProfile, instance.ManagedVpcId())
+	}
+
+	// all recorded responses are served, the flow made the same calls as when it was recorded
+	for key, interactions := range replayer.interactions {
+		if len(interactions) != 0 {
+			t.Errorf("%d recorded responses not replayed: %s", len(interactions), strings.SplitN(key, "\n", 2)[0])
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package aws
 
 import (
+	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"sort"
+	"strings"
 )
 
 var regionsMap = map[string]Region{
@@ -41,12 +43,28 @@ var regionsMap = map[string]Region{
 	"sa-east-1":      {Code: "sa-east-1", Name: "South America (São Paulo)", Geography: "Brazil"},
 }
 
+// geographyByPrefix is used to derive metadata for regions that are not (yet) in the regionsMap
+var geographyByPrefix = map[string]string{
+	"us": "United States of America",
+	"af": "Africa",
+	"ap": "Asia Pacific",
+	"ca": "Canada",
+	"cn": "China",
+	"eu": "Europe",
+	"il": "Israel",
+	"me": "Middle East",
+	"mx": "Mexico",
+	"sa": "South America",
+}
+
 type Regions []Region
 
 func toRegions(in []types.Region) Regions {
 	var out Regions
 	for _, region := range in {
-		out = append(out, regionsMap[aws.ToString(region.RegionName)])
+		r := RegionByCode(aws.ToString(region.RegionName))
+		r.OptInStatus = aws.ToString(region.OptInStatus)
+		out = append(out, r)
 	}
 
 	sort.Slice(out, func(i, j int) bool {
@@ -63,12 +81,57 @@ func (r Regions) Names() []string {
 	return out
 }
 
+// RegionCodes returns sorted codes of all known regions
+func RegionCodes() []string {
+	var out []string
+	for code := range regionsMap {
+		out = append(out, code)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// FilterByGeography returns regions where geography or name contains supplied (case-insensitive) string
+func (r Regions) FilterByGeography(geography string) Regions {
+	geography = strings.ToLower(geography)
+	var out Regions
+	for _, region := range r {
+		if strings.Contains(strings.ToLower(region.Geography), geography) || strings.Contains(strings.ToLower(region.Name), geography) {
+			out = append(out, region)
+		}
+	}
+	return out
+}
+
+// RegionByCode returns region from regionsMap, or region with metadata derived from the code if it is not known
 func RegionByCode(code string) Region {
-	return regionsMap[code]
+	if region, ok := regionsMap[code]; ok {
+		return region
+	}
+	return deriveRegion(code)
+}
+
+// deriveRegion creates region from code e.g. ap-southeast-9 -> "Asia Pacific (ap-southeast-9)"
+func deriveRegion(code string) Region {
+	if code == "" {
+		return Region{}
+	}
+	prefix, _, _ := strings.Cut(code, "-")
+	geography, ok := geographyByPrefix[prefix]
+	if !ok {
+		geography = "Unknown"
+	}
+	return Region{Code: code, Name: fmt.Sprintf("%s (%s)", geography, code), Geography: geography}
 }
 
 type Region struct {
-	Code      string
-	Name      string
-	Geography string
+	Code        string
+	Name        string
+	Geography   string
+	OptInStatus string // set only if the region is returned from describe-regions
+}
+
+// IsOptedIn returns true if region does not require opt-in, or the account is opted in
+func (r Region) IsOptedIn() bool {
+	return r.OptInStatus != "not-opted-in"
 }
@@ -0,0 +1,72 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pete911/ec2/internal/errs"
+	"io"
+	"log/slog"
+)
+
+type Service struct {
+	logger *slog.Logger
+	svc    *s3.Client
+}
+
+func NewService(logger *slog.Logger, cfg aws.Config) Service {
+	return Service{
+		logger: logger.With("component", "aws.s3.service"),
+		// custom endpoints (e.g. local emulators) do not resolve bucket subdomains
+		svc: s3.NewFromConfig(cfg, func(o *s3.Options) { o.UsePathStyle = cfg.BaseEndpoint != nil }),
+	}
+}
+
+// PutObject uploads body to bucket, body has to be seekable, so the SDK can compute payload checksum
+func (s Service) PutObject(ctx context.Context, bucket, key string, body io.ReadSeeker, size int64) error {
+	in := &s3.PutObjectInput{
+		Bucket:        aws.String(bucket),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	}
+	if _, err := s.svc.PutObject(ctx, in); err != nil {
+		return errs.FromAwsApi(err, "s3 put-object")
+	}
+	s.logger.DebugContext(ctx, fmt.Sprintf("uploaded %d bytes to s3://%s/%s", size, bucket, key))
+	return nil
+}
+
+// GetObject downloads object and writes it to supplied writer
+func (s Service) GetObject(ctx context.Context, bucket, key string, w io.Writer) error {
+	out, err := s.svc.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return errs.FromAwsApi(err, "s3 get-object")
+	}
+	defer out.Body.Close()
+
+	n, err := io.Copy(w, out.Body)
+	if err != nil {
+		return fmt.Errorf("s3 get-object: read s3://%s/%s: %w", bucket, key, err)
+	}
+	s.logger.DebugContext(ctx, fmt.Sprintf("downloaded %d bytes from s3://%s/%s", n, bucket, key))
+	return nil
+}
+
+// HeadObjectSize returns size of the object in bytes
+func (s Service) HeadObjectSize(ctx context.Context, bucket, key string) (int64, error) {
+	out, err := s.svc.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return 0, errs.FromAwsApi(err, "s3 head-object")
+	}
+	return aws.ToInt64(out.ContentLength), nil
+}
+
+func (s Service) DeleteObject(ctx context.Context, bucket, key string) error {
+	if _, err := s.svc.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}); err != nil {
+		return errs.FromAwsApi(err, "s3 delete-object")
+	}
+	s.logger.DebugContext(ctx, fmt.Sprintf("deleted s3://%s/%s", bucket, key))
+	return nil
+}
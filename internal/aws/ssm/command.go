@@ -0,0 +1,55 @@
+package ssm
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"strings"
+)
+
+// OutputLimit is the maximum number of characters of standard output/error returned by get-command-invocation
+const OutputLimit = 24000
+
+type CommandInvocation struct {
+	CommandId     string
+	InstanceId    string
+	Status        string
+	StatusDetails string
+	ResponseCode  int
+	Stdout        string
+	Stderr        string
+}
+
+func toCommandInvocation(in *ssm.GetCommandInvocationOutput) CommandInvocation {
+	return CommandInvocation{
+		CommandId:     aws.ToString(in.CommandId),
+		InstanceId:    aws.ToString(in.InstanceId),
+		Status:        string(in.Status),
+		StatusDetails: aws.ToString(in.StatusDetails),
+		ResponseCode:  int(in.ResponseCode),
+		Stdout:        aws.ToString(in.StandardOutputContent),
+		Stderr:        aws.ToString(in.StandardErrorContent),
+	}
+}
+
+// IsDone returns true if the invocation reached terminal state
+func (c CommandInvocation) IsDone() bool {
+	switch c.Status {
+	case "Success", "Cancelled", "TimedOut", "Failed":
+		return true
+	}
+	return false
+}
+
+// IsSuccess returns true if the command finished and exited with 0 exit code
+func (c CommandInvocation) IsSuccess() bool {
+	return c.Status == "Success" && c.ResponseCode == 0
+}
+
+// IsTruncated returns true if standard output or error exceeded SSM limit and was truncated
+func (c CommandInvocation) IsTruncated() bool {
+	return isTruncated(c.Stdout) || isTruncated(c.Stderr)
+}
+
+func isTruncated(in string) bool {
+	return len(in) >= OutputLimit || strings.HasSuffix(in, "--output truncated--")
+}
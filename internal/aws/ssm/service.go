@@ -0,0 +1,72 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/smithy-go"
+	"github.com/pete911/ec2/internal/errs"
+	"log/slog"
+	"time"
+)
+
+const shellScriptDocument = "AWS-RunShellScript"
+
+type Service struct {
+	logger *slog.Logger
+	svc    *ssm.Client
+}
+
+func NewService(logger *slog.Logger, cfg aws.Config) Service {
+	return Service{
+		logger: logger.With("component", "aws.ssm.service"),
+		svc:    ssm.NewFromConfig(cfg),
+	}
+}
+
+// SendShellCommand runs shell command on supplied instances and returns command id
+func (s Service) SendShellCommand(ctx context.Context, instanceIds []string, command string, timeout time.Duration) (string, error) {
+	in := &ssm.SendCommandInput{
+		DocumentName: aws.String(shellScriptDocument),
+		InstanceIds:  instanceIds,
+		Parameters: map[string][]string{
+			"commands":         {command},
+			"executionTimeout": {fmt.Sprintf("%d", int(timeout.Seconds()))},
+		},
+		Comment: aws.String("ec2 exec"),
+	}
+	out, err := s.svc.SendCommand(ctx, in)
+	if err != nil {
+		return "", errs.FromAwsApi(err, "ssm send-command")
+	}
+	commandId := aws.ToString(out.Command.CommandId)
+	s.logger.DebugContext(ctx, fmt.Sprintf("sent %s command to %d instances", commandId, len(instanceIds)))
+	return commandId, nil
+}
+
+// GetCommandInvocation returns command invocation for instance. Invocation is not available straight after sending
+// the command, in that case invocation with "Pending" status is returned
+func (s Service) GetCommandInvocation(ctx context.Context, commandId, instanceId string) (CommandInvocation, error) {
+	in := &ssm.GetCommandInvocationInput{CommandId: aws.String(commandId), InstanceId: aws.String(instanceId)}
+	out, err := s.svc.GetCommandInvocation(ctx, in)
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvocationDoesNotExist" {
+			return CommandInvocation{CommandId: commandId, InstanceId: instanceId, Status: "Pending"}, nil
+		}
+		return CommandInvocation{}, errs.FromAwsApi(err, "ssm get-command-invocation")
+	}
+	return toCommandInvocation(out), nil
+}
+
+// CancelCommand cancels command on supplied instances
+func (s Service) CancelCommand(ctx context.Context, commandId string, instanceIds []string) error {
+	in := &ssm.CancelCommandInput{CommandId: aws.String(commandId), InstanceIds: instanceIds}
+	if _, err := s.svc.CancelCommand(ctx, in); err != nil {
+		return errs.FromAwsApi(err, "ssm cancel-command")
+	}
+	s.logger.DebugContext(ctx, fmt.Sprintf("canceled %s command", commandId))
+	return nil
+}
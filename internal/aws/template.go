@@ -0,0 +1,357 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/pete911/ec2/internal/errs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LaunchTemplateRef is launch template name or id (lt- prefix) with optional version (number, $Latest or $Default)
+type LaunchTemplateRef struct {
+	Id      string
+	Name    string
+	Version string
+}
+
+// ParseLaunchTemplateRef parses <name|id>[:version], default version of the template is used if version is not set
+func ParseLaunchTemplateRef(in string) (LaunchTemplateRef, error) {
+	value, version, _ := strings.Cut(in, ":")
+	if value == "" {
+		return LaunchTemplateRef{}, fmt.Errorf("launch template name or id is required")
+	}
+	switch strings.ToLower(version) {
+	case "", "default", "$default":
+		version = "$Default"
+	case "latest", "$latest":
+		version = "$Latest"
+	default:
+		if n, err := strconv.ParseInt(version, 10, 64); err != nil || n < 1 {
+			return LaunchTemplateRef{}, fmt.Errorf("invalid launch template version %s, use number, $Latest or $Default", version)
+		}
+	}
+	if strings.HasPrefix(value, "lt-") {
+		return LaunchTemplateRef{Id: value, Version: version}, nil
+	}
+	return LaunchTemplateRef{Name: value, Version: version}, nil
+}
+
+func (r LaunchTemplateRef) String() string {
+	if r.Id != "" {
+		return fmt.Sprintf("%s:%s", r.Id, r.Version)
+	}
+	return fmt.Sprintf("%s:%s", r.Name, r.Version)
+}
+
+// LaunchTemplate is resolved launch template version with the fields that are also set by the tool
+type LaunchTemplate struct {
+	Id           string
+	Name         string
+	Version      int64
+	ImageId      string
+	InstanceType string
+	// SecurityGroups are ids and names of security groups set on the template or on its primary network interface
+	SecurityGroups  []string
+	InstanceProfile string
+	// SubnetId is subnet of the primary network interface
+	SubnetId string
+	UserData bool
+	// Tags are instance tags
+	Tags              map[string]string
+	networkInterfaces []types.LaunchTemplateInstanceNetworkInterfaceSpecification
+	metadataOptions   *types.LaunchTemplateInstanceMetadataOptions
+}
+
+func toLaunchTemplate(in types.LaunchTemplateVersion) LaunchTemplate {
+	out := LaunchTemplate{
+		Id:      aws.ToString(in.LaunchTemplateId),
+		Name:    aws.ToString(in.LaunchTemplateName),
+		Version: aws.ToInt64(in.VersionNumber),
+		Tags:    make(map[string]string),
+	}
+	data := in.LaunchTemplateData
+	if data == nil {
+		return out
+	}
+	out.ImageId = aws.ToString(data.ImageId)
+	out.InstanceType = string(data.InstanceType)
+	out.SecurityGroups = append(append(out.SecurityGroups, data.SecurityGroupIds...), data.SecurityGroups...)
+	if data.IamInstanceProfile != nil {
+		out.InstanceProfile = aws.ToString(data.IamInstanceProfile.Name)
+		if out.InstanceProfile == "" {
+			out.InstanceProfile = aws.ToString(data.IamInstanceProfile.Arn)
+		}
+	}
+	out.networkInterfaces = data.NetworkInterfaces
+	for _, ni := range data.NetworkInterfaces {
+		if aws.ToInt32(ni.DeviceIndex) != 0 {
+			continue
+		}
+		out.SubnetId = aws.ToString(ni.SubnetId)
+		out.SecurityGroups = append(out.SecurityGroups, ni.Groups...)
+	}
+	out.UserData = aws.ToString(data.UserData) != ""
+	for _, spec := range data.TagSpecifications {
+		if spec.ResourceType != types.ResourceTypeInstance {
+			continue
+		}
+		for _, tag := range spec.Tags {
+			out.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	}
+	out.metadataOptions = data.MetadataOptions
+	return out
+}
+
+func (t LaunchTemplate) String() string {
+	return fmt.Sprintf("%s (%s) version %d", t.Name, t.Id, t.Version)
+}
+
+// DescribeLaunchTemplate returns launch template version
+func (c Client) DescribeLaunchTemplate(ctx context.Context, ref LaunchTemplateRef) (LaunchTemplate, error) {
+	in := &ec2.DescribeLaunchTemplateVersionsInput{Versions: []string{ref.Version}}
+	if ref.Id != "" {
+		in.LaunchTemplateId = aws.String(ref.Id)
+	} else {
+		in.LaunchTemplateName = aws.String(ref.Name)
+	}
+	out, err := c.ec2Svc.DescribeLaunchTemplateVersions(ctx, in)
+	if err != nil {
+		return LaunchTemplate{}, errs.FromAwsApi(err, "ec2 describe-launch-template-versions")
+	}
+	if len(out.LaunchTemplateVersions) != 1 {
+		return LaunchTemplate{}, fmt.Errorf("expected 1 launch template version, got %d", len(out.LaunchTemplateVersions))
+	}
+	return toLaunchTemplate(out.LaunchTemplateVersions[0]), nil
+}
+
+// LaunchTemplateConflicts returns template fields that are replaced by the fields set by the tool
+func (r RunInstancesInput) LaunchTemplateConflicts() []string {
+	t := r.LaunchTemplate
+	if t.Id == "" {
+		return nil
+	}
+
+	var out []string
+	if len(t.SecurityGroups) != 0 {
+		out = append(out, fmt.Sprintf("security groups %s are replaced by %s security group", strings.Join(t.SecurityGroups, ", "), r.Metadata.Name))
+	}
+	if t.InstanceProfile != "" && t.InstanceProfile != r.InstanceProfile.Name {
+		out = append(out, fmt.Sprintf("instance profile %s is replaced by %s", t.InstanceProfile, r.InstanceProfile.Name))
+	}
+	if t.SubnetId != "" && t.SubnetId != r.Subnet.Id {
+		subnetId := r.Subnet.Id
+		if subnetId == "" {
+			subnetId = "new VPC subnet"
+		}
+		out = append(out, fmt.Sprintf("subnet %s is replaced by %s", t.SubnetId, subnetId))
+	}
+	if t.ImageId != "" && r.ImageId != "" && t.ImageId != r.ImageId {
+		out = append(out, fmt.Sprintf("image %s is replaced by %s", t.ImageId, r.ImageId))
+	}
+	if t.UserData && r.UserData != "" {
+		out = append(out, "user data is replaced")
+	}
+
+	var tags []string
+	for k, v := range r.tags() {
+		if tv, ok := t.Tags[k]; ok && tv != v {
+			tags = append(tags, fmt.Sprintf("tag %s=%s is replaced by %s=%s", k, tv, k, v))
+		}
+	}
+	sort.Strings(tags)
+	return append(out, tags...)
+}
+
+// setLaunchTemplate launches instance from the template, fields set by the tool (security group, instance profile,
+// tags and subnet) are merged over the template. Default image, instance type and empty user data are not set, so the
+// template values are used. If the template has network interfaces, security group and subnet are set on the primary
+// network interface, because they cannot be set on both the instance and network interface
+func (r RunInstancesInput) setLaunchTemplate(in *ec2.RunInstancesInput) {
+	t := r.LaunchTemplate
+	if t.Id == "" {
+		return
+	}
+
+	in.LaunchTemplate = &types.LaunchTemplateSpecification{
+		LaunchTemplateId: aws.String(t.Id),
+		Version:          aws.String(strconv.FormatInt(t.Version, 10)),
+	}
+	if r.ImageId == "" && t.ImageId != "" {
+		in.ImageId = nil
+	}
+	if t.InstanceType != "" {
+		in.InstanceType = ""
+	}
+	if r.UserData == "" {
+		in.UserData = nil
+	}
+
+	// instance tags in the request replace template instance tags
+	tags := make(map[string]string)
+	for k, v := range t.Tags {
+		tags[k] = v
+	}
+	for k, v := range r.tags() {
+		tags[k] = v
+	}
+	in.TagSpecifications = []types.TagSpecification{{ResourceType: types.ResourceTypeInstance, Tags: toTags(tags)}}
+
+	if len(t.networkInterfaces) != 0 {
+		in.NetworkInterfaces = toNetworkInterfaces(t.networkInterfaces, in)
+		in.SubnetId, in.SecurityGroupIds, in.Ipv6AddressCount = nil, nil, nil
+	}
+
+	// metadata options in the request replace all template metadata options, so template options are copied and
+	// only IPv6 endpoint, that the request enables for IPv6 instance, is set over them
+	if m := t.metadataOptions; m != nil && in.MetadataOptions != nil {
+		in.MetadataOptions = &types.InstanceMetadataOptionsRequest{
+			HttpEndpoint:            types.InstanceMetadataEndpointState(m.HttpEndpoint),
+			HttpPutResponseHopLimit: m.HttpPutResponseHopLimit,
+			HttpTokens:              types.HttpTokensState(m.HttpTokens),
+			InstanceMetadataTags:    types.InstanceMetadataTagsState(m.InstanceMetadataTags),
+			HttpProtocolIpv6:        types.InstanceMetadataProtocolStateEnabled,
+		}
+	}
+}
+
+// toNetworkInterfaces returns request network interfaces, that replace all template network interfaces. Primary
+// interface gets subnet, security group and IPv6 address count of the request, secondary interfaces are copied from
+// the template and placed in the request subnet if they do not have subnet or existing network interface set
+func toNetworkInterfaces(in []types.LaunchTemplateInstanceNetworkInterfaceSpecification, req *ec2.RunInstancesInput) []types.InstanceNetworkInterfaceSpecification {
+	primary := types.InstanceNetworkInterfaceSpecification{
+		DeviceIndex:      aws.Int32(0),
+		SubnetId:         req.SubnetId,
+		Groups:           req.SecurityGroupIds,
+		Ipv6AddressCount: req.Ipv6AddressCount,
+	}
+	var secondary []types.InstanceNetworkInterfaceSpecification
+	for _, ni := range in {
+		if aws.ToInt32(ni.DeviceIndex) == 0 {
+			primary.AssociatePublicIpAddress = ni.AssociatePublicIpAddress
+			primary.DeleteOnTermination = ni.DeleteOnTermination
+			primary.Description = ni.Description
+			primary.InterfaceType = ni.InterfaceType
+			primary.NetworkCardIndex = ni.NetworkCardIndex
+			if primary.Ipv6AddressCount == nil {
+				primary.Ipv6AddressCount = ni.Ipv6AddressCount
+			}
+			continue
+		}
+		// response and request types have the same field names, see toRequestLaunchTemplateData
+		var out types.InstanceNetworkInterfaceSpecification
+		if b, err := json.Marshal(ni); err == nil {
+			_ = json.Unmarshal(b, &out)
+		}
+		if out.SubnetId == nil && out.NetworkInterfaceId == nil {
+			out.SubnetId = req.SubnetId
+		}
+		secondary = append(secondary, out)
+	}
+	return append([]types.InstanceNetworkInterfaceSpecification{primary}, secondary...)
+}
+
+// CreateLaunchTemplateVersion creates launch template version from the instance launch configuration, template named
+// by metadata is created if it does not exist. Fields set by the tool (security groups, instance profile, subnet,
+// network interface addresses and tool tags) are removed, so the template can be used with other instances
+func (c Client) CreateLaunchTemplateVersion(ctx context.Context, instance Instance, metadata MetadataInput) (LaunchTemplate, error) {
+	out, err := c.ec2Svc.GetLaunchTemplateData(ctx, &ec2.GetLaunchTemplateDataInput{InstanceId: aws.String(instance.Id)})
+	if err != nil {
+		return LaunchTemplate{}, errs.FromAwsApi(err, "ec2 get-launch-template-data")
+	}
+	data, err := toRequestLaunchTemplateData(out.LaunchTemplateData, metadata)
+	if err != nil {
+		return LaunchTemplate{}, err
+	}
+	description := fmt.Sprintf("ec2 project template from %s instance", instance.Name)
+
+	versionOut, err := c.ec2Svc.CreateLaunchTemplateVersion(ctx, &ec2.CreateLaunchTemplateVersionInput{
+		LaunchTemplateName: aws.String(metadata.Name),
+		LaunchTemplateData: data,
+		VersionDescription: aws.String(description),
+	})
+	if err == nil {
+		template := toLaunchTemplate(*versionOut.LaunchTemplateVersion)
+		c.logger.InfoContext(ctx, fmt.Sprintf("created %s launch template version %d", template.Name, template.Version))
+		return template, nil
+	}
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "InvalidLaunchTemplateName.NotFoundException" {
+		return LaunchTemplate{}, errs.FromAwsApi(err, "ec2 create-launch-template-version")
+	}
+
+	templateOut, err := c.ec2Svc.CreateLaunchTemplate(ctx, &ec2.CreateLaunchTemplateInput{
+		LaunchTemplateName: aws.String(metadata.Name),
+		LaunchTemplateData: data,
+		VersionDescription: aws.String(description),
+		TagSpecifications:  []types.TagSpecification{{ResourceType: types.ResourceTypeLaunchTemplate, Tags: metadata.toTags()}},
+	})
+	if err != nil {
+		return LaunchTemplate{}, errs.FromAwsApi(err, "ec2 create-launch-template")
+	}
+	template := LaunchTemplate{
+		Id:      aws.ToString(templateOut.LaunchTemplate.LaunchTemplateId),
+		Name:    aws.ToString(templateOut.LaunchTemplate.LaunchTemplateName),
+		Version: aws.ToInt64(templateOut.LaunchTemplate.LatestVersionNumber),
+	}
+	c.logger.InfoContext(ctx, fmt.Sprintf("created %s launch template %s", template.Name, template.Id))
+	return template, nil
+}
+
+// toRequestLaunchTemplateData converts instance launch template data to request data. Response and request types
+// have the same field names, so they are converted through JSON instead of copying every field
+func toRequestLaunchTemplateData(in *types.ResponseLaunchTemplateData, metadata MetadataInput) (*types.RequestLaunchTemplateData, error) {
+	if in == nil {
+		return nil, fmt.Errorf("instance launch template data is empty")
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("marshal launch template data: %w", err)
+	}
+	var out types.RequestLaunchTemplateData
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("unmarshal launch template data: %w", err)
+	}
+
+	out.SecurityGroupIds, out.SecurityGroups, out.IamInstanceProfile = nil, nil, nil
+	if out.Placement != nil {
+		out.Placement.AvailabilityZone = nil
+	}
+	for i := range out.NetworkInterfaces {
+		ni := &out.NetworkInterfaces[i]
+		ni.NetworkInterfaceId, ni.SubnetId, ni.Groups = nil, nil, nil
+		ni.PrivateIpAddress, ni.PrivateIpAddresses, ni.Ipv6Addresses = nil, nil, nil
+		ni.Ipv4Prefixes, ni.Ipv6Prefixes = nil, nil
+		if ni.Ipv6AddressCount == nil && len(in.NetworkInterfaces) > i && len(in.NetworkInterfaces[i].Ipv6Addresses) != 0 {
+			ni.Ipv6AddressCount = aws.Int32(int32(len(in.NetworkInterfaces[i].Ipv6Addresses)))
+		}
+	}
+
+	// tool tags are set again when instance is launched from the template, aws: prefix is reserved
+	toolTags := map[string]bool{ManagedVpcTagKey: true, SsmEndpointsTagKey: true, ManagedEipTagKey: true}
+	for k := range metadata.Tags {
+		toolTags[k] = true
+	}
+	var specs []types.LaunchTemplateTagSpecificationRequest
+	for _, spec := range out.TagSpecifications {
+		var tags []types.Tag
+		for _, tag := range spec.Tags {
+			if key := aws.ToString(tag.Key); !toolTags[key] && !strings.HasPrefix(key, "aws:") {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) != 0 {
+			specs = append(specs, types.LaunchTemplateTagSpecificationRequest{ResourceType: spec.ResourceType, Tags: tags})
+		}
+	}
+	out.TagSpecifications = specs
+	return &out, nil
+}
@@ -0,0 +1,81 @@
+package aws
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/pete911/ec2/internal/aws/vpc"
+)
+
+func TestParseLaunchTemplateRef(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected LaunchTemplateRef
+		err      bool
+	}{
+		{in: "web", expected: LaunchTemplateRef{Name: "web", Version: "$Default"}},
+		{in: "ec2-web:3", expected: LaunchTemplateRef{Name: "ec2-web", Version: "3"}},
+		{in: "lt-0123456789abcdef0", expected: LaunchTemplateRef{Id: "lt-0123456789abcdef0", Version: "$Default"}},
+		{in: "lt-0123456789abcdef0:$Latest", expected: LaunchTemplateRef{Id: "lt-0123456789abcdef0", Version: "$Latest"}},
+		{in: "web:latest", expected: LaunchTemplateRef{Name: "web", Version: "$Latest"}},
+		{in: "web:$default", expected: LaunchTemplateRef{Name: "web", Version: "$Default"}},
+		{in: "web:-1", err: true},
+		{in: "web:0", err: true},
+		{in: "web:first", err: true},
+		{in: ":1", err: true},
+		{in: "", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			out, err := ParseLaunchTemplateRef(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, out)
+			}
+		})
+	}
+}
+
+func TestSetLaunchTemplateNetworkInterfaces(t *testing.T) {
+	template := toLaunchTemplate(types.LaunchTemplateVersion{
+		LaunchTemplateId: aws.String("lt-1"),
+		VersionNumber:    aws.Int64(2),
+		LaunchTemplateData: &types.ResponseLaunchTemplateData{
+			NetworkInterfaces: []types.LaunchTemplateInstanceNetworkInterfaceSpecification{
+				{DeviceIndex: aws.Int32(0), SubnetId: aws.String("subnet-template"), Groups: []string{"sg-template"}, DeleteOnTermination: aws.Bool(true)},
+				{DeviceIndex: aws.Int32(1), Description: aws.String("data"), SecondaryPrivateIpAddressCount: aws.Int32(2)},
+				{DeviceIndex: aws.Int32(2), SubnetId: aws.String("subnet-storage")},
+			},
+		},
+	})
+	r := RunInstancesInput{Subnet: vpc.Subnet{Id: "subnet-1"}, LaunchTemplate: template}
+	in := &ec2.RunInstancesInput{SubnetId: aws.String("subnet-1"), SecurityGroupIds: []string{"sg-1"}}
+	r.setLaunchTemplate(in)
+
+	if in.SubnetId != nil || in.SecurityGroupIds != nil {
+		t.Errorf("subnet and security groups should be set only on network interfaces, got %v %v", aws.ToString(in.SubnetId), in.SecurityGroupIds)
+	}
+	var got []string
+	for _, ni := range in.NetworkInterfaces {
+		got = append(got, fmt.Sprintf("%d %s %v %s %d", aws.ToInt32(ni.DeviceIndex), aws.ToString(ni.SubnetId), ni.Groups,
+			aws.ToString(ni.Description), aws.ToInt32(ni.SecondaryPrivateIpAddressCount)))
+	}
+	expected := []string{"0 subnet-1 [sg-1]  0", "1 subnet-1 [] data 2", "2 subnet-storage []  0"}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected network interfaces %q, got %q", expected, got)
+	}
+	if !aws.ToBool(in.NetworkInterfaces[0].DeleteOnTermination) {
+		t.Error("expected primary network interface settings from template")
+	}
+}
@@ -0,0 +1,37 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+type Volumes []Volume
+
+// ById returns map of volumes where key is volume id
+func (v Volumes) ById() map[string]Volume {
+	out := make(map[string]Volume)
+	for _, volume := range v {
+		out[volume.Id] = volume
+	}
+	return out
+}
+
+type Volume struct {
+	Id         string
+	Size       int
+	VolumeType string
+	State      string
+}
+
+func toVolumes(in []types.Volume) Volumes {
+	var out Volumes
+	for _, v := range in {
+		out = append(out, Volume{
+			Id:         aws.ToString(v.VolumeId),
+			Size:       int(aws.ToInt32(v.Size)),
+			VolumeType: string(v.VolumeType),
+			State:      string(v.State),
+		})
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package vpc
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"slices"
+	"strings"
+)
+
+// partitionDnsSuffixes are DNS suffixes of AWS partitions, partitions that are not listed use amazonaws.com
+var partitionDnsSuffixes = map[string]string{
+	"aws-cn":    "amazonaws.com.cn",
+	"aws-iso":   "c2s.ic.gov",
+	"aws-iso-b": "sc2s.sgov.gov",
+	"aws-iso-e": "cloud.adc-e.uk",
+	"aws-iso-f": "csp.hci.ic.gov",
+}
+
+// EndpointServiceName returns VPC endpoint service name of the AWS service in the partition and region, service name
+// prefix is partition DNS suffix in reverse order (e.g. com.amazonaws.eu-west-2.ssm or cn.com.amazonaws.cn-north-1.ssm)
+func EndpointServiceName(partition, region, service string) string {
+	dnsSuffix, ok := partitionDnsSuffixes[partition]
+	if !ok {
+		dnsSuffix = "amazonaws.com"
+	}
+	labels := strings.Split(dnsSuffix, ".")
+	slices.Reverse(labels)
+	return strings.Join(append(labels, region, service), ".")
+}
+
+type VpcEndpoint struct {
+	Id                string
+	VpcId             string
+	ServiceName       string
+	Type              string
+	State             string
+	PrivateDnsEnabled bool
+	SubnetIds         []string
+	Tags              map[string]string
+}
+
+func toVpcEndpoint(in types.VpcEndpoint) VpcEndpoint {
+	return VpcEndpoint{
+		Id:                aws.ToString(in.VpcEndpointId),
+		VpcId:             aws.ToString(in.VpcId),
+		ServiceName:       aws.ToString(in.ServiceName),
+		Type:              string(in.VpcEndpointType),
+		State:             string(in.State),
+		PrivateDnsEnabled: aws.ToBool(in.PrivateDnsEnabled),
+		SubnetIds:         in.SubnetIds,
+		Tags:              fromTags(in.Tags),
+	}
+}
+
+// IsUsable returns true if the endpoint is available (or pending) interface endpoint with private DNS enabled, so the default
+// service hostname resolves to the endpoint
+func (v VpcEndpoint) IsUsable() bool {
+	if v.Type != string(types.VpcEndpointTypeInterface) || !v.PrivateDnsEnabled {
+		return false
+	}
+	return strings.EqualFold(v.State, "available") || strings.EqualFold(v.State, "pending")
+}
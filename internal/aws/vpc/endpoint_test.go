@@ -0,0 +1,24 @@
+package vpc
+
+import "testing"
+
+func TestEndpointServiceName(t *testing.T) {
+	tests := []struct {
+		partition string
+		region    string
+		expected  string
+	}{
+		{partition: "aws", region: "eu-west-2", expected: "com.amazonaws.eu-west-2.ssm"},
+		{partition: "aws-cn", region: "cn-north-1", expected: "cn.com.amazonaws.cn-north-1.ssm"},
+		{partition: "aws-us-gov", region: "us-gov-west-1", expected: "com.amazonaws.us-gov-west-1.ssm"},
+		{partition: "aws-iso", region: "us-iso-east-1", expected: "gov.ic.c2s.us-iso-east-1.ssm"},
+		{partition: "", region: "eu-west-2", expected: "com.amazonaws.eu-west-2.ssm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.partition, func(t *testing.T) {
+			if got := EndpointServiceName(tt.partition, tt.region, "ssm"); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
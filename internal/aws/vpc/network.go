@@ -0,0 +1,258 @@
+package vpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/pete911/ec2/internal/aws/wait"
+	"github.com/pete911/ec2/internal/errs"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// DefaultNetworkCidr is CIDR block of VPC created by CreateNetwork if no CIDR block is supplied
+const DefaultNetworkCidr = "10.0.0.0/16"
+
+// NetworkCidrBlocks returns VPC and subnet CIDR blocks of the network created by CreateNetwork, default CIDR block is
+// used if cidr is empty. VPC CIDR block has to be IPv4 /16 to /28 (AWS limits) without host bits set, subnet is the
+// first /24 of the VPC, or the whole VPC if it is smaller
+func NetworkCidrBlocks(cidr string) (string, string, error) {
+	if cidr == "" {
+		cidr = DefaultNetworkCidr
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid cidr %s: %w", cidr, err)
+	}
+	if !prefix.Addr().Is4() || prefix.Bits() < 16 || prefix.Bits() > 28 {
+		return "", "", fmt.Errorf("invalid cidr %s: vpc cidr has to be IPv4 /16 to /28", cidr)
+	}
+	// host bits are not masked, 10.0.5.0/16 is more likely typo than 10.0.0.0/16
+	if masked := prefix.Masked(); masked != prefix {
+		return "", "", fmt.Errorf("invalid cidr %s: host bits are set, did you mean %s", cidr, masked)
+	}
+	subnet := netip.PrefixFrom(prefix.Addr(), max(prefix.Bits(), 24))
+	return prefix.String(), subnet.String(), nil
+}
+
+// CreateNetwork creates minimal VPC with internet gateway, one public subnet and route table with default route to
+// the internet gateway. VPC uses cidr (DefaultNetworkCidr if empty) and subnet the first /24 of it. All resources are
+// tagged with supplied tags. If any step fails, created resources are deleted
+func (s Service) CreateNetwork(ctx context.Context, cidr string, tags map[string]string) (Subnet, error) {
+	vpcCidr, subnetCidr, err := NetworkCidrBlocks(cidr)
+	if err != nil {
+		return Subnet{}, err
+	}
+	vpcOut, err := s.svc.CreateVpc(ctx, &ec2.CreateVpcInput{
+		CidrBlock:         aws.String(vpcCidr),
+		TagSpecifications: toTagSpecifications(ec2types.ResourceTypeVpc, tags),
+	})
+	if err != nil {
+		return Subnet{}, errs.FromAwsApi(err, "ec2 create-vpc")
+	}
+	vpcId := aws.ToString(vpcOut.Vpc.VpcId)
+	s.logger.InfoContext(ctx, fmt.Sprintf("created %s vpc", vpcId))
+
+	subnet, err := s.createNetworkResources(ctx, vpcId, subnetCidr, tags)
+	if err != nil {
+		s.logger.WarnContext(ctx, fmt.Sprintf("create network failed, deleting %s vpc", vpcId))
+		if deleteErr := s.DeleteNetwork(ctx, vpcId); deleteErr != nil {
+			s.logger.ErrorContext(ctx, fmt.Sprintf("roll back: %v", deleteErr))
+		}
+		return Subnet{}, err
+	}
+	return subnet, nil
+}
+
+func (s Service) createNetworkResources(ctx context.Context, vpcId, subnetCidr string, tags map[string]string) (Subnet, error) {
+	if err := ec2.NewVpcAvailableWaiter(s.svc).Wait(ctx, &ec2.DescribeVpcsInput{VpcIds: []string{vpcId}}, time.Minute); err != nil {
+		return Subnet{}, fmt.Errorf("wait for %s vpc: %w", vpcId, err)
+	}
+	// public DNS names are only assigned if DNS hostnames are enabled
+	if _, err := s.svc.ModifyVpcAttribute(ctx, &ec2.ModifyVpcAttributeInput{
+		VpcId:              aws.String(vpcId),
+		EnableDnsHostnames: &ec2types.AttributeBooleanValue{Value: aws.Bool(true)},
+	}); err != nil {
+		return Subnet{}, errs.FromAwsApi(err, "ec2 modify-vpc-attribute")
+	}
+
+	igwOut, err := s.svc.CreateInternetGateway(ctx, &ec2.CreateInternetGatewayInput{
+		TagSpecifications: toTagSpecifications(ec2types.ResourceTypeInternetGateway, tags),
+	})
+	if err != nil {
+		return Subnet{}, errs.FromAwsApi(err, "ec2 create-internet-gateway")
+	}
+	igwId := aws.ToString(igwOut.InternetGateway.InternetGatewayId)
+	if _, err := s.svc.AttachInternetGateway(ctx, &ec2.AttachInternetGatewayInput{
+		InternetGatewayId: aws.String(igwId),
+		VpcId:             aws.String(vpcId),
+	}); err != nil {
+		// not attached yet, so it would not be found and deleted by vpc id
+		if _, deleteErr := s.svc.DeleteInternetGateway(ctx, &ec2.DeleteInternetGatewayInput{InternetGatewayId: aws.String(igwId)}); deleteErr != nil {
+			s.logger.ErrorContext(ctx, fmt.Sprintf("delete %s internet gateway: %v", igwId, deleteErr))
+		}
+		return Subnet{}, errs.FromAwsApi(err, "ec2 attach-internet-gateway")
+	}
+	s.logger.InfoContext(ctx, fmt.Sprintf("created %s internet gateway", igwId))
+
+	subnetOut, err := s.svc.CreateSubnet(ctx, &ec2.CreateSubnetInput{
+		VpcId:             aws.String(vpcId),
+		CidrBlock:         aws.String(subnetCidr),
+		TagSpecifications: toTagSpecifications(ec2types.ResourceTypeSubnet, tags),
+	})
+	if err != nil {
+		return Subnet{}, errs.FromAwsApi(err, "ec2 create-subnet")
+	}
+	subnet := toSubnet(*subnetOut.Subnet)
+	if _, err := s.svc.ModifySubnetAttribute(ctx, &ec2.ModifySubnetAttributeInput{
+		SubnetId:            aws.String(subnet.Id),
+		MapPublicIpOnLaunch: &ec2types.AttributeBooleanValue{Value: aws.Bool(true)},
+	}); err != nil {
+		return Subnet{}, errs.FromAwsApi(err, "ec2 modify-subnet-attribute")
+	}
+	subnet.MapPublicIpOnLaunch = true
+	s.logger.InfoContext(ctx, fmt.Sprintf("created %s subnet in %s AZ", subnet.Id, subnet.AvailabilityZone))
+
+	rtbOut, err := s.svc.CreateRouteTable(ctx, &ec2.CreateRouteTableInput{
+		VpcId:             aws.String(vpcId),
+		TagSpecifications: toTagSpecifications(ec2types.ResourceTypeRouteTable, tags),
+	})
+	if err != nil {
+		return Subnet{}, errs.FromAwsApi(err, "ec2 create-route-table")
+	}
+	rtbId := aws.ToString(rtbOut.RouteTable.RouteTableId)
+	if _, err := s.svc.CreateRoute(ctx, &ec2.CreateRouteInput{
+		RouteTableId:         aws.String(rtbId),
+		DestinationCidrBlock: aws.String("0.0.0.0/0"),
+		GatewayId:            aws.String(igwId),
+	}); err != nil {
+		return Subnet{}, errs.FromAwsApi(err, "ec2 create-route")
+	}
+	if _, err := s.svc.AssociateRouteTable(ctx, &ec2.AssociateRouteTableInput{
+		RouteTableId: aws.String(rtbId),
+		SubnetId:     aws.String(subnet.Id),
+	}); err != nil {
+		return Subnet{}, errs.FromAwsApi(err, "ec2 associate-route-table")
+	}
+	s.logger.InfoContext(ctx, fmt.Sprintf("created %s route table", rtbId))
+
+	rtbs, err := s.svc.DescribeRouteTables(ctx, &ec2.DescribeRouteTablesInput{RouteTableIds: []string{rtbId}})
+	if err != nil {
+		return Subnet{}, errs.FromAwsApi(err, "ec2 describe-route-tables")
+	}
+	if len(rtbs.RouteTables) != 1 {
+		return Subnet{}, fmt.Errorf("expected 1 route table, got %d", len(rtbs.RouteTables))
+	}
+	subnet.RouteTable = toRouteTable(rtbs.RouteTables[0])
+	return subnet, nil
+}
+
+// DeleteNetwork deletes VPC created by CreateNetwork, including all its VPC endpoints, subnets, route tables, internet
+// gateways and security groups. VPC cannot have any instances
+func (s Service) DeleteNetwork(ctx context.Context, vpcId string) error {
+	vpcFilter := []ec2types.Filter{{Name: aws.String("vpc-id"), Values: []string{vpcId}}}
+
+	endpoints, err := s.describeVpcEndpoints(ctx, vpcFilter)
+	if err != nil {
+		return err
+	}
+	var endpointIds []string
+	for _, endpoint := range endpoints {
+		if !strings.EqualFold(endpoint.State, "deleted") {
+			endpointIds = append(endpointIds, endpoint.Id)
+		}
+	}
+	if len(endpointIds) > 0 {
+		if _, err := s.svc.DeleteVpcEndpoints(ctx, &ec2.DeleteVpcEndpointsInput{VpcEndpointIds: endpointIds}); err != nil {
+			return errs.FromAwsApi(err, "ec2 delete-vpc-endpoints")
+		}
+		if err := s.waitForEndpointsDeleted(ctx, endpointIds); err != nil {
+			return err
+		}
+	}
+
+	igws, err := s.svc.DescribeInternetGateways(ctx, &ec2.DescribeInternetGatewaysInput{
+		Filters: []ec2types.Filter{{Name: aws.String("attachment.vpc-id"), Values: []string{vpcId}}},
+	})
+	if err != nil {
+		return errs.FromAwsApi(err, "ec2 describe-internet-gateways")
+	}
+	for _, igw := range igws.InternetGateways {
+		igwId := igw.InternetGatewayId
+		if _, err := s.svc.DetachInternetGateway(ctx, &ec2.DetachInternetGatewayInput{InternetGatewayId: igwId, VpcId: aws.String(vpcId)}); err != nil {
+			return errs.FromAwsApi(err, "ec2 detach-internet-gateway")
+		}
+		if _, err := s.svc.DeleteInternetGateway(ctx, &ec2.DeleteInternetGatewayInput{InternetGatewayId: igwId}); err != nil {
+			return errs.FromAwsApi(err, "ec2 delete-internet-gateway")
+		}
+		s.logger.InfoContext(ctx, fmt.Sprintf("deleted %s internet gateway", aws.ToString(igwId)))
+	}
+
+	subnets, err := s.svc.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{Filters: vpcFilter})
+	if err != nil {
+		return errs.FromAwsApi(err, "ec2 describe-subnets")
+	}
+	for _, subnet := range subnets.Subnets {
+		if _, err := s.svc.DeleteSubnet(ctx, &ec2.DeleteSubnetInput{SubnetId: subnet.SubnetId}); err != nil {
+			return errs.FromAwsApi(err, "ec2 delete-subnet")
+		}
+		s.logger.InfoContext(ctx, fmt.Sprintf("deleted %s subnet", aws.ToString(subnet.SubnetId)))
+	}
+
+	rtbs, err := s.svc.DescribeRouteTables(ctx, &ec2.DescribeRouteTablesInput{Filters: vpcFilter})
+	if err != nil {
+		return errs.FromAwsApi(err, "ec2 describe-route-tables")
+	}
+	for _, rtb := range rtbs.RouteTables {
+		// main route table is deleted with the VPC
+		if toRouteTable(rtb).Main {
+			continue
+		}
+		if _, err := s.svc.DeleteRouteTable(ctx, &ec2.DeleteRouteTableInput{RouteTableId: rtb.RouteTableId}); err != nil {
+			return errs.FromAwsApi(err, "ec2 delete-route-table")
+		}
+		s.logger.InfoContext(ctx, fmt.Sprintf("deleted %s route table", aws.ToString(rtb.RouteTableId)))
+	}
+
+	sgs, err := s.svc.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{Filters: vpcFilter})
+	if err != nil {
+		return errs.FromAwsApi(err, "ec2 describe-security-groups")
+	}
+	for _, sg := range sgs.SecurityGroups {
+		// default security group is deleted with the VPC
+		if aws.ToString(sg.GroupName) == "default" {
+			continue
+		}
+		if err := s.deleteSecurityGroup(ctx, aws.ToString(sg.GroupId)); err != nil {
+			return err
+		}
+	}
+
+	return s.deleteVpc(ctx, vpcId)
+}
+
+// deleteVpc deletes VPC, network interfaces of terminated instances can take a while to disappear, so it retries on
+// dependency violation
+func (s Service) deleteVpc(ctx context.Context, vpcId string) error {
+	var err error
+	for x := 0; x < 6; x++ {
+		if _, err = s.svc.DeleteVpc(ctx, &ec2.DeleteVpcInput{VpcId: aws.String(vpcId)}); err == nil {
+			s.logger.InfoContext(ctx, fmt.Sprintf("deleted %s vpc", vpcId))
+			return nil
+		}
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "DependencyViolation" {
+			break
+		}
+		s.logger.InfoContext(ctx, fmt.Sprintf("vpc %s still has dependencies, retry in %s", vpcId, s.waitInterval))
+		if err := wait.Sleep(ctx, s.waitInterval); err != nil {
+			return err
+		}
+	}
+	return errs.FromAwsApi(err, "ec2 delete-vpc")
+}
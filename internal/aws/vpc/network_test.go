@@ -0,0 +1,40 @@
+package vpc
+
+import "testing"
+
+func TestNetworkCidrBlocks(t *testing.T) {
+	tests := []struct {
+		cidr       string
+		vpcCidr    string
+		subnetCidr string
+		err        bool
+	}{
+		{cidr: "", vpcCidr: "10.0.0.0/16", subnetCidr: "10.0.0.0/24"},
+		{cidr: "172.31.0.0/16", vpcCidr: "172.31.0.0/16", subnetCidr: "172.31.0.0/24"},
+		{cidr: "10.20.16.0/20", vpcCidr: "10.20.16.0/20", subnetCidr: "10.20.16.0/24"},
+		{cidr: "192.168.1.0/26", vpcCidr: "192.168.1.0/26", subnetCidr: "192.168.1.0/26"},
+		{cidr: "10.20.30.0/20", err: true},
+		{cidr: "10.0.5.0/16", err: true},
+		{cidr: "10.0.0.0/8", err: true},
+		{cidr: "10.0.0.0/29", err: true},
+		{cidr: "2001:db8::/56", err: true},
+		{cidr: "10.0.0.0", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			vpcCidr, subnetCidr, err := NetworkCidrBlocks(tt.cidr)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected error, got %s %s", vpcCidr, subnetCidr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vpcCidr != tt.vpcCidr || subnetCidr != tt.subnetCidr {
+				t.Errorf("expected %s %s, got %s %s", tt.vpcCidr, tt.subnetCidr, vpcCidr, subnetCidr)
+			}
+		})
+	}
+}
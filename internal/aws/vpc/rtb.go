@@ -44,16 +44,35 @@ func toRouteTable(in types.RouteTable) RouteTable {
 	}
 }
 
-// HasPublicRoute returns true if there is 0.0.0.0/0 IPv4 destination mapped to IGW
-func (r RouteTable) HasPublicRoute() bool {
-	return r.Routes.hasPublicRoute()
+// HasPublicIpv4Route returns true if there is 0.0.0.0/0 IPv4 destination mapped to IGW
+func (r RouteTable) HasPublicIpv4Route() bool {
+	return r.Routes.hasPublicRoute("ipv4", "0.0.0.0/0")
+}
+
+// HasPublicIpv6Route returns true if there is ::/0 IPv6 destination mapped to IGW
+func (r RouteTable) HasPublicIpv6Route() bool {
+	return r.Routes.hasPublicRoute("ipv6", "::/0")
+}
+
+// DefaultRoute returns active 0.0.0.0/0 (ipv4) or ::/0 (ipv6) route, false is returned if there is none
+func (r RouteTable) DefaultRoute(destinationType string) (Route, bool) {
+	cidr := "0.0.0.0/0"
+	if destinationType == "ipv6" {
+		cidr = "::/0"
+	}
+	for _, route := range r.Routes {
+		if route.DestinationType == destinationType && route.DestinationCidr == cidr && route.State == "active" {
+			return route, true
+		}
+	}
+	return Route{}, false
 }
 
 type Routes []Route
 
-func (r Routes) hasPublicRoute() bool {
+func (r Routes) hasPublicRoute(destinationType, destinationCidr string) bool {
 	for _, route := range r {
-		if route.DestinationType == "ipv4" && route.DestinationCidr == "0.0.0.0/0" {
+		if route.DestinationType == destinationType && route.DestinationCidr == destinationCidr {
 			return route.TargetType == "internet-gateway"
 		}
 	}
@@ -61,11 +80,20 @@ func (r Routes) hasPublicRoute() bool {
 }
 
 type Route struct {
-	DestinationType string
-	DestinationCidr string
-	TargetId        string
-	TargetType      string
-	State           string
+	DestinationType         string
+	DestinationCidr         string
+	DestinationPrefixListId string
+	TargetId                string
+	TargetType              string
+	State                   string
+}
+
+// Destination returns destination CIDR block, or prefix list id if the destination is prefix list
+func (r Route) Destination() string {
+	if r.DestinationCidr != "" {
+		return r.DestinationCidr
+	}
+	return r.DestinationPrefixListId
 }
 
 func toRoute(in types.Route) Route {
@@ -75,6 +103,7 @@ func toRoute(in types.Route) Route {
 	// destination
 	if id := aws.ToString(in.DestinationPrefixListId); id != "" {
 		route.DestinationType = "prefix-list"
+		route.DestinationPrefixListId = id
 	}
 	if cidr := aws.ToString(in.DestinationCidrBlock); cidr != "" {
 		route.DestinationType = "ipv4"
@@ -116,6 +145,12 @@ func toRoute(in types.Route) Route {
 			route.TargetType = "vpc-endpoint"
 			return route
 		}
+		if strings.HasPrefix(id, "vgw-") {
+			route.TargetType = "virtual-private-gateway"
+			return route
+		}
+		route.TargetType = "gateway"
+		return route
 	}
 
 	if id := aws.ToString(in.InstanceId); id != "" {
@@ -0,0 +1,35 @@
+package vpc
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"testing"
+)
+
+func TestToRoute(t *testing.T) {
+	tests := []struct {
+		name            string
+		in              types.Route
+		destinationType string
+		destination     string
+		targetType      string
+	}{
+		{name: "ipv4", in: types.Route{DestinationCidrBlock: aws.String("0.0.0.0/0"), GatewayId: aws.String("igw-1")},
+			destinationType: "ipv4", destination: "0.0.0.0/0", targetType: "internet-gateway"},
+		{name: "ipv6", in: types.Route{DestinationIpv6CidrBlock: aws.String("::/0"), EgressOnlyInternetGatewayId: aws.String("eigw-1")},
+			destinationType: "ipv6", destination: "::/0", targetType: "egress-only-internet-gateway"},
+		{name: "prefix list", in: types.Route{DestinationPrefixListId: aws.String("pl-1"), GatewayId: aws.String("vpce-1")},
+			destinationType: "prefix-list", destination: "pl-1", targetType: "vpc-endpoint"},
+		{name: "vpn", in: types.Route{DestinationCidrBlock: aws.String("192.168.0.0/16"), GatewayId: aws.String("vgw-1")},
+			destinationType: "ipv4", destination: "192.168.0.0/16", targetType: "virtual-private-gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := toRoute(tt.in)
+			if route.DestinationType != tt.destinationType || route.Destination() != tt.destination || route.TargetType != tt.targetType {
+				t.Errorf("expected %s %s %s, got %s %s %s", tt.destinationType, tt.destination, tt.targetType,
+					route.DestinationType, route.Destination(), route.TargetType)
+			}
+		})
+	}
+}
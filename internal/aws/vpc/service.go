@@ -6,35 +6,59 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/pete911/ec2/internal/aws/wait"
 	"github.com/pete911/ec2/internal/errs"
 	"log/slog"
 	"sort"
+	"sync"
+	"time"
 )
 
 type Service struct {
-	logger *slog.Logger
-	svc    *ec2.Client
+	logger       *slog.Logger
+	svc          *ec2.Client
+	waitInterval time.Duration
 }
 
 func NewService(logger *slog.Logger, cfg aws.Config) Service {
 	return Service{
-		logger: logger.With("component", "aws.vpc.service"),
-		svc:    ec2.NewFromConfig(cfg),
+		logger:       logger.With("component", "aws.vpc.service"),
+		svc:          ec2.NewFromConfig(cfg),
+		waitInterval: wait.DefaultInterval,
 	}
 }
 
+// WithWaitInterval returns service that waits the interval between retries and polls of deleted resources
+func (s Service) WithWaitInterval(interval time.Duration) Service {
+	s.waitInterval = interval
+	return s
+}
+
 // GetVpcs returns VPCs containing subnets and route tables
 func (s Service) GetVpcs(ctx context.Context) ([]Vpc, error) {
-	vpcs, err := s.describeVpcs(ctx)
-	if err != nil {
-		return nil, err
-	}
-	routeTables, err := s.describeRouteTables(ctx)
-	if err != nil {
-		return nil, err
+	// describe calls are independent, run them concurrently and cancel the rest if any of them fails
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	var vpcs []Vpc
+	var routeTables map[string]RouteTable
+	var subnets []Subnet
+	run := func(fn func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(); err != nil {
+				cancel(err)
+			}
+		}()
 	}
-	subnets, err := s.describeSubnets(ctx)
-	if err != nil {
+	run(func() (err error) { vpcs, err = s.describeVpcs(ctx); return })
+	run(func() (err error) { routeTables, err = s.describeRouteTables(ctx); return })
+	run(func() (err error) { subnets, err = s.describeSubnets(ctx); return })
+	wg.Wait()
+	// first error is the cause, the other calls fail with context canceled
+	if err := context.Cause(ctx); err != nil {
 		return nil, err
 	}
 
@@ -58,6 +82,37 @@ func (s Service) GetVpcs(ctx context.Context) ([]Vpc, error) {
 	return vpcs, nil
 }
 
+// GetVpcEndpoints returns VPC endpoints in the supplied VPC
+func (s Service) GetVpcEndpoints(ctx context.Context, vpcId string) ([]VpcEndpoint, error) {
+	endpoints, err := s.describeVpcEndpoints(ctx, []ec2types.Filter{{Name: aws.String("vpc-id"), Values: []string{vpcId}}})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.DebugContext(ctx, fmt.Sprintf("found %d vpc endpoints in %s vpc", len(endpoints), vpcId))
+	return endpoints, nil
+}
+
+func (s Service) describeVpcEndpoints(ctx context.Context, filters []ec2types.Filter) ([]VpcEndpoint, error) {
+	in := &ec2.DescribeVpcEndpointsInput{Filters: filters}
+
+	var endpoints []VpcEndpoint
+	for {
+		out, err := s.svc.DescribeVpcEndpoints(ctx, in)
+		if err != nil {
+			return nil, errs.FromAwsApi(err, "ec2 describe-vpc-endpoints")
+		}
+		for _, v := range out.VpcEndpoints {
+			endpoints = append(endpoints, toVpcEndpoint(v))
+		}
+
+		if aws.ToString(out.NextToken) == "" {
+			break
+		}
+		in.NextToken = out.NextToken
+	}
+	return endpoints, nil
+}
+
 // getRouteTableBySubnet rtbs key has to be in "<vpc-id>" (main route table) or "<vpc-id><subnet-id>" format
 func getRouteTableBySubnet(rtbs map[string]RouteTable, subnet Subnet) RouteTable {
 	if v, ok := rtbs[subnet.VpcId+subnet.Id]; ok {
@@ -128,12 +183,21 @@ func (s Service) describeRouteTables(ctx context.Context) (map[string]RouteTable
 	return routeTables, nil
 }
 
-// describeVpcs returns list of VPCs. Vpc does NOT have 'subnets' field set yet
-func (s Service) describeVpcs(ctx context.Context) ([]Vpc, error) {
+// DescribeVpcsByTags returns available VPCs that have all the tags, VPCs do not have subnets set
+func (s Service) DescribeVpcsByTags(ctx context.Context, tags map[string]string) ([]Vpc, error) {
+	var filters []ec2types.Filter
+	for k, v := range tags {
+		filters = append(filters, ec2types.Filter{Name: aws.String(fmt.Sprintf("tag:%s", k)), Values: []string{v}})
+	}
+	return s.describeVpcs(ctx, filters...)
+}
+
+// describeVpcs returns list of available VPCs matching the filters. Vpc does NOT have 'subnets' field set yet
+func (s Service) describeVpcs(ctx context.Context, filters ...ec2types.Filter) ([]Vpc, error) {
 	in := &ec2.DescribeVpcsInput{
-		Filters: []ec2types.Filter{
+		Filters: append([]ec2types.Filter{
 			{Name: aws.String("state"), Values: []string{"available"}},
-		},
+		}, filters...),
 	}
 
 	var vpcs []Vpc
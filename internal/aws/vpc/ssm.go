@@ -0,0 +1,261 @@
+package vpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/pete911/ec2/internal/aws/wait"
+	"github.com/pete911/ec2/internal/errs"
+	"strings"
+)
+
+type InterfaceEndpointsInput struct {
+	VpcId string
+	// SubnetIds where the endpoint network interfaces are created, at most one subnet per AZ
+	SubnetIds []string
+	// CidrBlocks are allowed to connect to the endpoints over HTTPS
+	CidrBlocks   []string
+	ServiceNames []string
+	// Name is name of the endpoints security group, endpoints are tagged with Name tag as well
+	Name string
+	Tags map[string]string
+}
+
+// InterfaceEndpoints are resources created by CreateInterfaceEndpoints, reused endpoints and security group are not
+// included
+type InterfaceEndpoints struct {
+	VpcId       string
+	EndpointIds []string
+	// SecurityGroupId is set only if the security group was created
+	SecurityGroupId string
+}
+
+func (e InterfaceEndpoints) IsEmpty() bool {
+	return len(e.EndpointIds) == 0 && e.SecurityGroupId == ""
+}
+
+// CreateInterfaceEndpoints creates interface endpoints with private DNS for services that do not have usable
+// endpoint in the VPC yet. Endpoints share one security group, that is created if it does not exist. Created
+// resources are returned on error as well, so the caller can roll them back
+func (s Service) CreateInterfaceEndpoints(ctx context.Context, in InterfaceEndpointsInput) (InterfaceEndpoints, error) {
+	created := InterfaceEndpoints{VpcId: in.VpcId}
+	endpoints, err := s.GetVpcEndpoints(ctx, in.VpcId)
+	if err != nil {
+		return created, err
+	}
+	usable := make(map[string]string)
+	for _, endpoint := range endpoints {
+		if endpoint.IsUsable() {
+			usable[endpoint.ServiceName] = endpoint.Id
+		}
+	}
+
+	var missing []string
+	for _, serviceName := range in.ServiceNames {
+		if id, ok := usable[serviceName]; ok {
+			s.logger.InfoContext(ctx, fmt.Sprintf("reusing %s %s vpc endpoint", serviceName, id))
+			continue
+		}
+		missing = append(missing, serviceName)
+	}
+	if len(missing) == 0 {
+		return created, nil
+	}
+
+	// private DNS of interface endpoints requires both DNS support and DNS hostnames
+	if err := s.enableDns(ctx, in.VpcId); err != nil {
+		return created, err
+	}
+	securityGroupId, isNew, err := s.getOrCreateEndpointsSecurityGroup(ctx, in)
+	if isNew {
+		created.SecurityGroupId = securityGroupId
+	}
+	if err != nil {
+		return created, err
+	}
+
+	for _, serviceName := range missing {
+		out, err := s.svc.CreateVpcEndpoint(ctx, &ec2.CreateVpcEndpointInput{
+			VpcId:             aws.String(in.VpcId),
+			ServiceName:       aws.String(serviceName),
+			VpcEndpointType:   ec2types.VpcEndpointTypeInterface,
+			SubnetIds:         in.SubnetIds,
+			SecurityGroupIds:  []string{securityGroupId},
+			PrivateDnsEnabled: aws.Bool(true),
+			TagSpecifications: toTagSpecifications(ec2types.ResourceTypeVpcEndpoint, in.Tags),
+		})
+		if err != nil {
+			return created, errs.FromAwsApi(err, "ec2 create-vpc-endpoint")
+		}
+		created.EndpointIds = append(created.EndpointIds, aws.ToString(out.VpcEndpoint.VpcEndpointId))
+		s.logger.InfoContext(ctx, fmt.Sprintf("created %s %s vpc endpoint", serviceName, aws.ToString(out.VpcEndpoint.VpcEndpointId)))
+	}
+	return created, nil
+}
+
+func (s Service) enableDns(ctx context.Context, vpcId string) error {
+	for _, in := range []*ec2.ModifyVpcAttributeInput{
+		{VpcId: aws.String(vpcId), EnableDnsSupport: &ec2types.AttributeBooleanValue{Value: aws.Bool(true)}},
+		{VpcId: aws.String(vpcId), EnableDnsHostnames: &ec2types.AttributeBooleanValue{Value: aws.Bool(true)}},
+	} {
+		if _, err := s.svc.ModifyVpcAttribute(ctx, in); err != nil {
+			return errs.FromAwsApi(err, "ec2 modify-vpc-attribute")
+		}
+	}
+	return nil
+}
+
+// getOrCreateEndpointsSecurityGroup returns id of the endpoints security group and whether it was created, id is
+// returned if the group was created, but the ingress rule failed
+func (s Service) getOrCreateEndpointsSecurityGroup(ctx context.Context, in InterfaceEndpointsInput) (string, bool, error) {
+	id, err := s.getSecurityGroupId(ctx, in.VpcId, in.Name)
+	if err != nil || id != "" {
+		return id, false, err
+	}
+
+	out, err := s.svc.CreateSecurityGroup(ctx, &ec2.CreateSecurityGroupInput{
+		VpcId:             aws.String(in.VpcId),
+		GroupName:         aws.String(in.Name),
+		Description:       aws.String("ec2 project ssm endpoints"),
+		TagSpecifications: toTagSpecifications(ec2types.ResourceTypeSecurityGroup, in.Tags),
+	})
+	if err != nil {
+		return "", false, errs.FromAwsApi(err, "ec2 create-security-group")
+	}
+	id = aws.ToString(out.GroupId)
+
+	permission := ec2types.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(443), ToPort: aws.Int32(443)}
+	for _, cidr := range in.CidrBlocks {
+		if strings.Contains(cidr, ":") {
+			permission.Ipv6Ranges = append(permission.Ipv6Ranges, ec2types.Ipv6Range{CidrIpv6: aws.String(cidr)})
+			continue
+		}
+		permission.IpRanges = append(permission.IpRanges, ec2types.IpRange{CidrIp: aws.String(cidr)})
+	}
+	if _, err := s.svc.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId:       aws.String(id),
+		IpPermissions: []ec2types.IpPermission{permission},
+	}); err != nil {
+		return id, true, errs.FromAwsApi(err, "ec2 authorize-security-group-ingress")
+	}
+	s.logger.InfoContext(ctx, fmt.Sprintf("created %s %s security group", in.Name, id))
+	return id, true, nil
+}
+
+// getSecurityGroupId returns id of the security group with the name in the VPC, or empty string if it does not exist
+func (s Service) getSecurityGroupId(ctx context.Context, vpcId, name string) (string, error) {
+	out, err := s.svc.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: []ec2types.Filter{
+			{Name: aws.String("vpc-id"), Values: []string{vpcId}},
+			{Name: aws.String("group-name"), Values: []string{name}},
+		},
+	})
+	if err != nil {
+		return "", errs.FromAwsApi(err, "ec2 describe-security-groups")
+	}
+	if len(out.SecurityGroups) == 0 {
+		return "", nil
+	}
+	return aws.ToString(out.SecurityGroups[0].GroupId), nil
+}
+
+// DeleteInterfaceEndpoints deletes endpoints created by CreateInterfaceEndpoints (identified by Name tag) and their
+// security group. Reused endpoints, that were not created by CreateInterfaceEndpoints, are not deleted
+func (s Service) DeleteInterfaceEndpoints(ctx context.Context, vpcId, name string) error {
+	endpoints, err := s.describeVpcEndpoints(ctx, []ec2types.Filter{
+		{Name: aws.String("vpc-id"), Values: []string{vpcId}},
+		{Name: aws.String("tag:Name"), Values: []string{name}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for _, endpoint := range endpoints {
+		if !strings.EqualFold(endpoint.State, "deleted") {
+			ids = append(ids, endpoint.Id)
+		}
+	}
+	if err := s.deleteVpcEndpoints(ctx, ids); err != nil {
+		return err
+	}
+
+	securityGroupId, err := s.getSecurityGroupId(ctx, vpcId, name)
+	if err != nil || securityGroupId == "" {
+		return err
+	}
+	return s.deleteSecurityGroup(ctx, securityGroupId)
+}
+
+// DeleteCreatedInterfaceEndpoints deletes only resources returned by CreateInterfaceEndpoints, it is used to roll
+// back failed create
+func (s Service) DeleteCreatedInterfaceEndpoints(ctx context.Context, created InterfaceEndpoints) error {
+	if err := s.deleteVpcEndpoints(ctx, created.EndpointIds); err != nil {
+		return err
+	}
+	if created.SecurityGroupId == "" {
+		return nil
+	}
+	return s.deleteSecurityGroup(ctx, created.SecurityGroupId)
+}
+
+func (s Service) deleteVpcEndpoints(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if _, err := s.svc.DeleteVpcEndpoints(ctx, &ec2.DeleteVpcEndpointsInput{VpcEndpointIds: ids}); err != nil {
+		return errs.FromAwsApi(err, "ec2 delete-vpc-endpoints")
+	}
+	s.logger.InfoContext(ctx, fmt.Sprintf("deleting %s vpc endpoints", strings.Join(ids, ", ")))
+	return s.waitForEndpointsDeleted(ctx, ids)
+}
+
+// waitForEndpointsDeleted waits for endpoints to be deleted, so their network interfaces do not block deletion of
+// the security group (and VPC)
+func (s Service) waitForEndpointsDeleted(ctx context.Context, ids []string) error {
+	for x := 0; x < 30; x++ {
+		endpoints, err := s.describeVpcEndpoints(ctx, []ec2types.Filter{{Name: aws.String("vpc-endpoint-id"), Values: ids}})
+		if err != nil {
+			return err
+		}
+		var pending int
+		for _, endpoint := range endpoints {
+			if !strings.EqualFold(endpoint.State, "deleted") {
+				pending++
+			}
+		}
+		if pending == 0 {
+			return nil
+		}
+		s.logger.InfoContext(ctx, fmt.Sprintf("%d vpc endpoints are still deleting, retry in %s", pending, s.waitInterval))
+		if err := wait.Sleep(ctx, s.waitInterval); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("vpc endpoints %s not deleted", strings.Join(ids, ", "))
+}
+
+// deleteSecurityGroup deletes security group, network interfaces can take a while to disappear, so it retries on
+// dependency violation
+func (s Service) deleteSecurityGroup(ctx context.Context, id string) error {
+	var err error
+	for x := 0; x < 6; x++ {
+		if _, err = s.svc.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{GroupId: aws.String(id)}); err == nil {
+			s.logger.InfoContext(ctx, fmt.Sprintf("deleted %s security group", id))
+			return nil
+		}
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "DependencyViolation" {
+			break
+		}
+		s.logger.InfoContext(ctx, fmt.Sprintf("security group %s still in use, retry in %s", id, s.waitInterval))
+		if err := wait.Sleep(ctx, s.waitInterval); err != nil {
+			return err
+		}
+	}
+	return errs.FromAwsApi(err, "ec2 delete-security-group")
+}
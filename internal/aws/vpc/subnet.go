@@ -14,7 +14,10 @@ type Subnet struct {
 	AvailabilityZoneId      string
 	AvailableIpAddressCount int
 	CidrBlock               string
+	Ipv6CidrBlocks          []string
+	Ipv6Native              bool
 	DefaultForAz            bool
+	MapPublicIpOnLaunch     bool
 	RouteTable              RouteTable // added additionally in the client
 	State                   string
 	Tags                    map[string]string
@@ -22,6 +25,12 @@ type Subnet struct {
 
 func toSubnet(in types.Subnet) Subnet {
 	tags := fromTags(in.Tags)
+	var ipv6CidrBlocks []string
+	for _, v := range in.Ipv6CidrBlockAssociationSet {
+		if v.Ipv6CidrBlockState != nil && v.Ipv6CidrBlockState.State == types.SubnetCidrBlockStateCodeAssociated {
+			ipv6CidrBlocks = append(ipv6CidrBlocks, aws.ToString(v.Ipv6CidrBlock))
+		}
+	}
 	return Subnet{
 		VpcId:                   aws.ToString(in.VpcId),
 		Id:                      aws.ToString(in.SubnetId),
@@ -31,12 +40,49 @@ func toSubnet(in types.Subnet) Subnet {
 		AvailabilityZoneId:      aws.ToString(in.AvailabilityZoneId),
 		AvailableIpAddressCount: int(aws.ToInt32(in.AvailableIpAddressCount)),
 		CidrBlock:               aws.ToString(in.CidrBlock),
+		Ipv6CidrBlocks:          ipv6CidrBlocks,
+		Ipv6Native:              aws.ToBool(in.Ipv6Native),
 		DefaultForAz:            aws.ToBool(in.DefaultForAz),
+		MapPublicIpOnLaunch:     aws.ToBool(in.MapPublicIpOnLaunch),
 		State:                   string(in.State),
 		Tags:                    tags,
 	}
 }
 
-func (s Subnet) IsPubic() bool {
-	return s.RouteTable.HasPublicRoute()
+// IsPublic returns true if instance launched in the subnet has route to internet gateway. IPv6 route is used only by
+// instances with IPv6 address (ipv6 is set, or the subnet is IPv6-only), IPv4 route only by dual-stack and IPv4 subnets
+func (s Subnet) IsPublic(ipv6 bool) bool {
+	if s.IsIpv6Only() {
+		return s.IsPublicIpv6()
+	}
+	return s.IsPublicIpv4() || (ipv6 && s.HasIpv6() && s.IsPublicIpv6())
+}
+
+// IsPublicIpv4 returns true if the subnet route table has 0.0.0.0/0 route to internet gateway
+func (s Subnet) IsPublicIpv4() bool {
+	return s.RouteTable.HasPublicIpv4Route()
+}
+
+// IsPublicIpv6 returns true if the subnet route table has ::/0 route to internet gateway
+func (s Subnet) IsPublicIpv6() bool {
+	return s.RouteTable.HasPublicIpv6Route()
+}
+
+// HasIpv6 returns true if the subnet has IPv6 CIDR block, instances launched in the subnet can have IPv6 address
+func (s Subnet) HasIpv6() bool {
+	return len(s.Ipv6CidrBlocks) > 0
+}
+
+// IsIpv6Only returns true if the subnet is IPv6 native (has no IPv4 CIDR), instances have to be launched with IPv6 address
+func (s Subnet) IsIpv6Only() bool {
+	return s.Ipv6Native
+}
+
+// CidrBlocks returns IPv4 and IPv6 CIDR blocks of the subnet
+func (s Subnet) CidrBlocks() []string {
+	var out []string
+	if s.CidrBlock != "" {
+		out = append(out, s.CidrBlock)
+	}
+	return append(out, s.Ipv6CidrBlocks...)
 }
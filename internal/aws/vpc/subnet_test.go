@@ -0,0 +1,35 @@
+package vpc
+
+import "testing"
+
+func TestSubnetIsPublic(t *testing.T) {
+	ipv4Route := Route{DestinationType: "ipv4", DestinationCidr: "0.0.0.0/0", TargetId: "igw-1", TargetType: "internet-gateway", State: "active"}
+	ipv6Route := Route{DestinationType: "ipv6", DestinationCidr: "::/0", TargetId: "igw-1", TargetType: "internet-gateway", State: "active"}
+	natRoute := Route{DestinationType: "ipv4", DestinationCidr: "0.0.0.0/0", TargetId: "nat-1", TargetType: "nat-gateway", State: "active"}
+	tests := []struct {
+		name   string
+		subnet Subnet
+		ipv4   bool
+		ipv6   bool
+	}{
+		{name: "ipv4 public", subnet: Subnet{RouteTable: RouteTable{Routes: Routes{ipv4Route}}}, ipv4: true, ipv6: true},
+		{name: "ipv4 private", subnet: Subnet{RouteTable: RouteTable{Routes: Routes{natRoute}}}},
+		{name: "dual-stack ipv6 route only", subnet: Subnet{Ipv6CidrBlocks: []string{"2001:db8::/64"}, RouteTable: RouteTable{Routes: Routes{natRoute, ipv6Route}}},
+			ipv6: true},
+		{name: "dual-stack public", subnet: Subnet{Ipv6CidrBlocks: []string{"2001:db8::/64"}, RouteTable: RouteTable{Routes: Routes{ipv4Route, ipv6Route}}},
+			ipv4: true, ipv6: true},
+		{name: "ipv6-only public", subnet: Subnet{Ipv6Native: true, Ipv6CidrBlocks: []string{"2001:db8::/64"}, RouteTable: RouteTable{Routes: Routes{ipv6Route}}},
+			ipv4: true, ipv6: true},
+		{name: "ipv6-only ipv4 route only", subnet: Subnet{Ipv6Native: true, Ipv6CidrBlocks: []string{"2001:db8::/64"}, RouteTable: RouteTable{Routes: Routes{ipv4Route}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.subnet.IsPublic(false); got != tt.ipv4 {
+				t.Errorf("expected public %t without ipv6, got %t", tt.ipv4, got)
+			}
+			if got := tt.subnet.IsPublic(true); got != tt.ipv6 {
+				t.Errorf("expected public %t with ipv6, got %t", tt.ipv6, got)
+			}
+		})
+	}
+}
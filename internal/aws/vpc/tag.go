@@ -3,6 +3,8 @@ package vpc
 import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"maps"
+	"slices"
 )
 
 func fromTags(in []types.Tag) map[string]string {
@@ -12,3 +14,16 @@ func fromTags(in []types.Tag) map[string]string {
 	}
 	return out
 }
+
+func toTags(in map[string]string) []types.Tag {
+	var out []types.Tag
+	for _, k := range slices.Sorted(maps.Keys(in)) {
+		v := in[k]
+		out = append(out, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return out
+}
+
+func toTagSpecifications(resourceType types.ResourceType, tags map[string]string) []types.TagSpecification {
+	return []types.TagSpecification{{ResourceType: resourceType, Tags: toTags(tags)}}
+}
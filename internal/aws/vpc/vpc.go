@@ -6,34 +6,47 @@ import (
 )
 
 type Vpc struct {
-	Id            string
-	Name          string
-	CidrBlock     string
-	DhcpOptionsId string
-	IsDefault     bool
-	Subnets       []Subnet // added additionally in the client
-	OwnerId       string
-	State         string
-	Tags          map[string]string
+	Id             string
+	Name           string
+	CidrBlock      string
+	Ipv6CidrBlocks []string
+	DhcpOptionsId  string
+	IsDefault      bool
+	Subnets        []Subnet // added additionally in the client
+	OwnerId        string
+	State          string
+	Tags           map[string]string
 }
 
 func toVpc(in types.Vpc) Vpc {
 	tags := fromTags(in.Tags)
+	var ipv6CidrBlocks []string
+	for _, v := range in.Ipv6CidrBlockAssociationSet {
+		if v.Ipv6CidrBlockState != nil && v.Ipv6CidrBlockState.State == types.VpcCidrBlockStateCodeAssociated {
+			ipv6CidrBlocks = append(ipv6CidrBlocks, aws.ToString(v.Ipv6CidrBlock))
+		}
+	}
 	return Vpc{
-		Id:            aws.ToString(in.VpcId),
-		Name:          tags["Name"],
-		CidrBlock:     aws.ToString(in.CidrBlock),
-		DhcpOptionsId: aws.ToString(in.DhcpOptionsId),
-		IsDefault:     aws.ToBool(in.IsDefault),
-		OwnerId:       aws.ToString(in.OwnerId),
-		State:         string(in.State),
-		Tags:          tags,
+		Id:             aws.ToString(in.VpcId),
+		Name:           tags["Name"],
+		CidrBlock:      aws.ToString(in.CidrBlock),
+		Ipv6CidrBlocks: ipv6CidrBlocks,
+		DhcpOptionsId:  aws.ToString(in.DhcpOptionsId),
+		IsDefault:      aws.ToBool(in.IsDefault),
+		OwnerId:        aws.ToString(in.OwnerId),
+		State:          string(in.State),
+		Tags:           tags,
 	}
 }
 
-func (v Vpc) HasPublicSubnet() bool {
+func (v Vpc) HasIpv6() bool {
+	return len(v.Ipv6CidrBlocks) > 0
+}
+
+// HasPublicSubnet returns true if any subnet is public for instance launched in it, see Subnet.IsPublic
+func (v Vpc) HasPublicSubnet(ipv6 bool) bool {
 	for _, v := range v.Subnets {
-		if v.IsPubic() {
+		if v.IsPublic(ipv6) {
 			return true
 		}
 	}
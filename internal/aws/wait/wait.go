@@ -0,0 +1,19 @@
+package wait
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultInterval is interval between retries and polls of eventually consistent AWS resources
+const DefaultInterval = 10 * time.Second
+
+// Sleep waits for the duration, it returns context error if the context is done first
+func Sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cache stores JSON encoded values on disk in user cache directory, values older than TTL are ignored
+type Cache struct {
+	logger  *slog.Logger
+	dir     string
+	ttl     time.Duration
+	refresh bool
+}
+
+type entry struct {
+	CreatedAt time.Time       `json:"created_at"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// New creates cache, if refresh is set to true, values are not read from the cache, but are still written to it.
+// Zero ttl disables the cache
+func New(logger *slog.Logger, ttl time.Duration, refresh bool) Cache {
+	logger = logger.With("component", "cache")
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		logger.Debug(fmt.Sprintf("user cache dir: %v, cache disabled", err))
+		return Cache{logger: logger}
+	}
+	return Cache{
+		logger:  logger,
+		dir:     filepath.Join(dir, "ec2"),
+		ttl:     ttl,
+		refresh: refresh,
+	}
+}
+
+func (c Cache) enabled() bool {
+	return c.dir != "" && c.ttl > 0
+}
+
+// Get reads value from the cache into v, returns false if the value is not cached or expired
+func (c Cache) Get(key string, v any) bool {
+	if !c.enabled() || c.refresh {
+		return false
+	}
+
+	b, err := os.ReadFile(c.path(key))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			c.logger.Debug(fmt.Sprintf("read %s: %v", key, err))
+		}
+		return false
+	}
+
+	var e entry
+	if err := json.Unmarshal(b, &e); err != nil {
+		c.logger.Debug(fmt.Sprintf("unmarshal %s: %v", key, err))
+		return false
+	}
+	if time.Since(e.CreatedAt) > c.ttl {
+		c.logger.Debug(fmt.Sprintf("%s expired", key))
+		return false
+	}
+	if err := json.Unmarshal(e.Value, v); err != nil {
+		c.logger.Debug(fmt.Sprintf("unmarshal %s value: %v", key, err))
+		return false
+	}
+	c.logger.Debug(fmt.Sprintf("%s loaded from cache", key))
+	return true
+}
+
+// Set writes value to the cache, errors are only logged, because cache is not essential
+func (c Cache) Set(key string, v any) {
+	if !c.enabled() {
+		return
+	}
+
+	value, err := json.Marshal(v)
+	if err != nil {
+		c.logger.Debug(fmt.Sprintf("marshal %s value: %v", key, err))
+		return
+	}
+	b, err := json.Marshal(entry{CreatedAt: time.Now(), Value: value})
+	if err != nil {
+		c.logger.Debug(fmt.Sprintf("marshal %s: %v", key, err))
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		c.logger.Debug(fmt.Sprintf("create cache dir: %v", err))
+		return
+	}
+	if err := os.WriteFile(c.path(key), b, 0600); err != nil {
+		c.logger.Debug(fmt.Sprintf("write %s: %v", key, err))
+	}
+}
+
+// Delete removes value from the cache
+func (c Cache) Delete(key string) {
+	if c.dir == "" {
+		return
+	}
+	if err := os.Remove(c.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.logger.Debug(fmt.Sprintf("delete %s: %v", key, err))
+	}
+}
+
+func (c Cache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
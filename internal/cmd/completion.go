@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/cache"
+	"github.com/pete911/ec2/internal/cmd/flag"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/spf13/cobra"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	completionCmd = &cobra.Command{
+		Use:   "completion bash|zsh|fish",
+		Short: "generate shell completion script",
+		Long: `generate shell completion script
+
+bash (requires bash-completion package):
+  current shell:  source <(ec2 completion bash)
+  permanently:    ec2 completion bash > /etc/bash_completion.d/ec2 (linux)
+                  ec2 completion bash > $(brew --prefix)/etc/bash_completion.d/ec2 (macOS)
+
+zsh:
+  enable completion (if not enabled yet): echo "autoload -U compinit; compinit" >> ~/.zshrc
+  permanently:    ec2 completion zsh > "${fpath[1]}/_ec2"
+
+fish:
+  current shell:  ec2 completion fish | source
+  permanently:    ec2 completion fish > ~/.config/fish/completions/ec2.fish
+
+start new shell for the permanent setup to take effect`,
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		Run:       runCompletion,
+	}
+)
+
+func init() {
+	Root.CompletionOptions.DisableDefaultCmd = true
+	Root.AddCommand(completionCmd)
+}
+
+func runCompletion(cmd *cobra.Command, args []string) {
+	var err error
+	switch args[0] {
+	case "bash":
+		err = Root.GenBashCompletionV2(os.Stdout, true)
+	case "zsh":
+		err = Root.GenZshCompletion(os.Stdout)
+	case "fish":
+		err = Root.GenFishCompletion(os.Stdout, true)
+	}
+	if err != nil {
+		exitWithError(fmt.Errorf("generate %s completion: %w", args[0], err))
+	}
+}
+
+// completeInstanceNames completes first argument with instance names without the name prefix
+func completeInstanceNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeManyInstanceNames(cmd, args, toComplete)
+}
+
+// completeManyInstanceNames completes every argument with instance names (without the name prefix) that have not
+// been supplied yet
+func completeManyInstanceNames(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	names, ok := cachedCompletions("instances", func(client ec2.Client) ([]string, error) {
+		instances, err := client.ListCached()
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, instance := range instances {
+			names = append(names, strings.TrimPrefix(instance.Name, ec2.NamePrefix))
+		}
+		return names, nil
+	})
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var out []string
+	for _, name := range names {
+		if !slices.Contains(args, name) {
+			out = append(out, name)
+		}
+	}
+	return out, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRegions completes opted-in region codes with region name as description
+func completeRegions(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	logger := completionLogger()
+	c := cache.New(logger, flag.CacheTTL, false)
+
+	key := completionScope() + "-regions"
+	var regions aws.Regions
+	if !c.Get(key, &regions) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		var err error
+		if regions, _, err = aws.ListOptedInRegions(ctx, logger, endpointOptions()); err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		c.Set(key, regions)
+	}
+
+	var out []string
+	for _, region := range regions {
+		out = append(out, fmt.Sprintf("%s\t%s", region.Code, region.Name))
+	}
+	return out, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeSubnets completes subnet ids with subnet details as description
+func completeSubnets(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	out, _ := cachedCompletions("subnets", func(client ec2.Client) ([]string, error) {
+		vpcs, err := client.GetVpcs()
+		if err != nil {
+			return nil, err
+		}
+
+		var out []string
+		for _, v := range vpcs {
+			for _, subnet := range v.Subnets {
+				description := fmt.Sprintf("%s %s %s", v.Id, strings.Join(subnet.CidrBlocks(), " "), subnet.AvailabilityZone)
+				if subnet.Name != "" {
+					description = fmt.Sprintf("%s %s", description, subnet.Name)
+				}
+				// completions are cached for all create flags, so IPv6-only public route is labeled separately
+				if subnet.IsPublic(false) {
+					description = fmt.Sprintf("%s [public]", description)
+				} else if subnet.IsPublicIpv6() {
+					description = fmt.Sprintf("%s [public-ipv6]", description)
+				}
+				out = append(out, fmt.Sprintf("%s\t%s", subnet.Id, description))
+			}
+		}
+		return out, nil
+	})
+	return out, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeVpcs completes VPC ids with VPC name and CIDR as description
+func completeVpcs(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) != 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	completions, _ := cachedCompletions("vpcs", func(client ec2.Client) ([]string, error) {
+		vpcs, err := client.GetVpcs()
+		if err != nil {
+			return nil, err
+		}
+
+		var completions []string
+		for _, v := range vpcs {
+			completions = append(completions, fmt.Sprintf("%s\t%s %s", v.Id, v.CidrBlock, v.Name))
+		}
+		return completions, nil
+	})
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeImageNames completes image names without the name prefix
+func completeImageNames(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	completions, _ := cachedCompletions("images", func(client ec2.Client) ([]string, error) {
+		images, err := client.ListImages()
+		if err != nil {
+			return nil, err
+		}
+
+		var completions []string
+		for _, image := range images {
+			completions = append(completions, fmt.Sprintf("%s\t%s", strings.TrimPrefix(image.Name, ec2.NamePrefix), image.Id))
+		}
+		return completions, nil
+	})
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// cachedCompletions returns completions from the cache, or creates client and caches completions returned by fn.
+// Cache is checked before the client is created, because creating the client calls STS on every TAB
+func cachedCompletions(name string, fn func(ec2.Client) ([]string, error)) ([]string, bool) {
+	logger := completionLogger()
+	region, ok := completionRegion()
+	if !ok {
+		return nil, false
+	}
+	c := cache.New(logger, flag.CacheTTL, false)
+	key := completionKey(region, name)
+
+	var completions []string
+	if c.Get(key, &completions) {
+		return completions, true
+	}
+	client, ok := newCompletionClient(region)
+	if !ok {
+		return nil, false
+	}
+	completions, err := fn(client)
+	if err != nil {
+		return nil, false
+	}
+	c.Set(key, completions)
+	return completions, true
+}
+
+// invalidateCompletions deletes cached completions of the selected region, it is called by commands that change
+// instances, VPCs or images, so completions are fetched again on the next TAB
+func invalidateCompletions(logger *slog.Logger) {
+	deleteCachedCompletions(logger, flag.Region)
+}
+
+// deleteCachedCompletions deletes completions of the region cached by cachedCompletions
+func deleteCachedCompletions(logger *slog.Logger, region string) {
+	c := cache.New(logger, flag.CacheTTL, false)
+	for _, name := range []string{"instances", "subnets", "vpcs", "images"} {
+		c.Delete(completionKey(region, name))
+	}
+}
+
+func completionKey(region, name string) string {
+	return fmt.Sprintf("%s-%s-%s", completionScope(), region, name)
+}
+
+// completionScope returns cache key prefix for completions. Account id is not known without STS call, so the
+// completions are scoped by AWS profile, access key id and endpoint url, hashed to keep them out of the file names
+func completionScope() string {
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{profile, os.Getenv("AWS_ACCESS_KEY_ID"), flag.EndpointUrl}, "\n")))
+	return fmt.Sprintf("completion-%x", sum[:8])
+}
+
+// completionRegion returns region from the flag or from AWS config
+func completionRegion() (string, bool) {
+	if flag.Region != "" {
+		return flag.Region, true
+	}
+	region, err := aws.DefaultRegion()
+	if err != nil || region == "" {
+		return "", false
+	}
+	return region, true
+}
+
+// newCompletionClient creates client without prompts and logs (completion output is read by the shell)
+func newCompletionClient(region string) (ec2.Client, bool) {
+	logger := completionLogger()
+	awsClient, err := aws.NewClient(logger, region, endpointOptions())
+	if err != nil {
+		return ec2.Client{}, false
+	}
+	return ec2.NewClient(logger, awsClient, cache.New(logger, flag.CacheTTL, false)), true
+}
+
+func completionLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
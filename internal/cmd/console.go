@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	consoleCmd = &cobra.Command{
+		Use:   "console [name]",
+		Short: "print serial console output of EC2 instance",
+		Long: "print latest serial console output of EC2 instance (up to 64 KB), with --follow the output is polled " +
+			"and only new lines are printed",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeInstanceNames,
+		Run:               runConsole,
+	}
+	screenshotCmd = &cobra.Command{
+		Use:               "screenshot [name]",
+		Short:             "save console screenshot of EC2 instance to JPG file",
+		Long:              "",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeInstanceNames,
+		Run:               runScreenshot,
+	}
+	consoleFollow   bool
+	consoleInterval time.Duration
+	screenshotFile  string
+)
+
+func init() {
+	consoleCmd.Flags().BoolVarP(&consoleFollow, "follow", "f", false, "poll for new console output until interrupted")
+	consoleCmd.Flags().DurationVar(&consoleInterval, "interval", 5*time.Second, "poll interval (with --follow)")
+	screenshotCmd.Flags().StringVar(&screenshotFile, "file", "", "output file, defaults to <name>-<timestamp>.jpg")
+	Root.AddCommand(consoleCmd)
+	Root.AddCommand(screenshotCmd)
+}
+
+func runConsole(cmd *cobra.Command, args []string) {
+	logger := NewLogger()
+	client := NewClient(logger)
+	instance := SelectInstance(client, firstArg(args))
+
+	output, err := client.ConsoleOutput(instance.Id)
+	if err != nil {
+		exitWithError(fmt.Errorf("get %s console output: %w", instance.Name, err))
+	}
+	fmt.Print(output)
+	if !consoleFollow {
+		if output == "" {
+			fmt.Printf("no console output available for %s yet\n", instance.Name)
+		}
+		return
+	}
+
+	for {
+		time.Sleep(consoleInterval)
+		current, err := client.ConsoleOutput(instance.Id)
+		if err != nil {
+			exitWithError(fmt.Errorf("get %s console output: %w", instance.Name, err))
+		}
+		newOutput, continuous := ec2.NewConsoleOutput(output, current)
+		if !continuous {
+			if !strings.HasSuffix(output, "\n") {
+				fmt.Println()
+			}
+			fmt.Println("--- console output lost, more output was written than the console keeps ---")
+		}
+		fmt.Print(newOutput)
+		output = current
+	}
+}
+
+func runScreenshot(cmd *cobra.Command, args []string) {
+	logger := NewLogger()
+	client := NewClient(logger)
+	instance := SelectInstance(client, firstArg(args))
+
+	image, err := client.Screenshot(instance.Id)
+	if err != nil {
+		exitWithError(fmt.Errorf("get %s console screenshot: %w", instance.Name, err))
+	}
+
+	file := screenshotFile
+	if file == "" {
+		file = fmt.Sprintf("%s-%s.jpg", instance.Name, time.Now().Format("20060102-150405"))
+	}
+	if err := os.WriteFile(file, image, 0644); err != nil {
+		exitWithError(fmt.Errorf("write %s screenshot: %w", instance.Name, err))
+	}
+	fmt.Printf("console screenshot of %s saved to %s\n", instance.Name, file)
+}
+
+// printConsoleTail prints last lines of console output if the error is caused by instance not passing status checks
+func printConsoleTail(err error) {
+	var notReady *ec2.NotReadyError
+	if !errors.As(err, &notReady) || notReady.ConsoleTail == "" {
+		return
+	}
+	fmt.Fprintf(humanOutput(), "last console output lines of %s:\n", notReady.InstanceId)
+	fmt.Fprintln(humanOutput(), notReady.ConsoleTail)
+}
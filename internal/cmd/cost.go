@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/spf13/cobra"
+)
+
+// budget monthly cost threshold in USD, warning is printed if estimated monthly cost of instances exceeds it
+var budget float64
+
+func addBudgetFlag(cmd *cobra.Command) {
+	cmd.Flags().Float64Var(&budget, "budget", 0, "warn if estimated monthly cost of all instances in USD exceeds budget")
+}
+
+// warnBudget prints warning if budget is set and supplied total cost exceeds it. Incomplete cost (instance type or
+// region missing in the offline price table) is under-counted, so it is reported even if it does not exceed budget
+func warnBudget(total ec2.Cost) {
+	if budget <= 0 {
+		return
+	}
+	if monthly := total.Monthly(); monthly > budget {
+		fmt.Fprintf(humanOutput(), "WARNING: estimated monthly cost $%.2f exceeds budget $%.2f\n", monthly, budget)
+	}
+	if !total.Complete {
+		fmt.Fprintln(humanOutput(), "WARNING: some prices are missing in the offline price table, estimated monthly cost is incomplete")
+	}
+}
+
+// addCost returns sum of the costs, sum is complete only if both costs are complete
+func addCost(a, b ec2.Cost) ec2.Cost {
+	return ec2.Cost{Hourly: a.Hourly + b.Hourly, Complete: a.Complete && b.Complete}
+}
+
+// formatPrice returns price in USD, or "-" if the price is not known. Incomplete price (e.g. missing EBS price)
+// is marked with "+"
+func formatPrice(cost ec2.Cost, price float64) string {
+	if price == 0 && !cost.Complete {
+		return "-"
+	}
+	out := fmt.Sprintf("$%.4f", price)
+	if !cost.Complete {
+		out += "+"
+	}
+	return out
+}
+
+// fleetCost returns estimated cost of all existing instances
+func fleetCost(client ec2.Client) ec2.Cost {
+	instances, err := client.List()
+	if err != nil {
+		exitWithError(err)
+	}
+	costs, err := client.Costs(instances)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	total := ec2.Cost{Complete: true}
+	for _, cost := range costs {
+		total = addCost(total, cost)
+	}
+	return total
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+var (
+	cpCmd = &cobra.Command{
+		Use:   "cp <local> <name>:<remote> | <name>:<remote> <local>",
+		Short: "copy file to or from EC2 instance",
+		Long: "copy file to or from EC2 instance over SSM, or stage it through temporary S3 object if --bucket is set. " +
+			"Instance role is granted access only to the temporary object for the duration of the transfer",
+		Args: cobra.ExactArgs(2),
+		Run:  runCp,
+	}
+	cpBucket string
+)
+
+func init() {
+	cpCmd.Flags().StringVar(&cpBucket, "bucket", "", "S3 bucket used to stage the file (recommended for large files)")
+	Root.AddCommand(cpCmd)
+}
+
+func runCp(cmd *cobra.Command, args []string) {
+	srcName, srcPath, srcRemote := parseCpArg(args[0])
+	dstName, dstPath, dstRemote := parseCpArg(args[1])
+	if srcRemote == dstRemote {
+		fmt.Println("exactly one of the arguments has to be in <name>:<remote> format")
+		os.Exit(1)
+	}
+
+	logger := NewLogger()
+	client := NewClient(logger)
+
+	in := ec2.CopyInput{Bucket: cpBucket, Progress: printProgress}
+	if dstRemote {
+		in.Instance = SelectInstance(client, dstName)
+		in.LocalPath = srcPath
+		in.RemotePath = dstPath
+		if err := client.Upload(in); err != nil {
+			fmt.Println()
+			exitWithError(fmt.Errorf("cp %s: %w", args[0], err))
+		}
+	} else {
+		in.Instance = SelectInstance(client, srcName)
+		in.LocalPath = dstPath
+		in.RemotePath = srcPath
+		if err := client.Download(in); err != nil {
+			fmt.Println()
+			exitWithError(fmt.Errorf("cp %s: %w", args[0], err))
+		}
+	}
+	fmt.Println()
+}
+
+// parseCpArg returns instance name, path and true if the argument is remote (<name>:<path>)
+func parseCpArg(arg string) (string, string, bool) {
+	name, path, ok := strings.Cut(arg, ":")
+	if !ok || name == "" || strings.ContainsAny(name, `/\`) {
+		return "", arg, false
+	}
+	return name, path, true
+}
+
+func printProgress(done, total int64) {
+	var percent int64 = 100
+	if total > 0 {
+		percent = done * 100 / total
+	}
+	fmt.Printf("\r%d / %d bytes (%d%%)", done, total, percent)
+}
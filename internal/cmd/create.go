@@ -1,10 +1,17 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"github.com/pete911/ec2/internal/aws/vpc"
+	"github.com/pete911/ec2/internal/cmd/out"
 	"github.com/pete911/ec2/internal/cmd/prompt"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/pete911/ec2/internal/errs"
 	"github.com/spf13/cobra"
+	"log/slog"
 	"os"
+	"strings"
 )
 
 var (
@@ -15,25 +22,213 @@ var (
 		Args:  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
 		Run:   runCreate,
 	}
+	createSubnet      string
+	createCount       int
+	createConcurrency int
+	createIpv6        bool
+	createNewVpc      bool
+	createCidr        string
+	createEndpoints   bool
+	createEip         bool
+	createImage       string
+	createTemplate    string
 )
 
 func init() {
+	addBudgetFlag(createCmd)
+	addDryRunFlag(createCmd)
+	addEventsFlag(createCmd)
+	createCmd.Flags().StringVar(&createSubnet, "subnet", "", "subnet id, user is prompted to select one if not set")
+	if err := createCmd.RegisterFlagCompletionFunc("subnet", completeSubnets); err != nil {
+		panic(err)
+	}
+	createCmd.Flags().IntVar(&createCount, "count", 1, "number of instances to create, instances are named <name>-1 to <name>-<count>")
+	createCmd.Flags().BoolVar(&createIpv6, "ipv6", false, "assign IPv6 address, subnet has to have IPv6 CIDR block (always assigned in IPv6-only subnets)")
+	createCmd.Flags().BoolVar(&createNewVpc, "new-vpc", false, "create new VPC with public subnet, VPC is deleted with its last instance")
+	createCmd.Flags().StringVar(&createCidr, "cidr", "", fmt.Sprintf("CIDR block of the new VPC (with --new-vpc, default %s), subnet is the first /24 of it", vpc.DefaultNetworkCidr))
+	createCmd.Flags().BoolVar(&createEndpoints, "ssm-endpoints", false, "create (or reuse) SSM VPC endpoints, so instance is reachable without internet access")
+	createCmd.Flags().BoolVar(&createEip, "eip", false, "allocate and associate elastic IP, released when the instance is deleted")
+	createCmd.Flags().StringVar(&createImage, "image", "", "launch from image created by ec2 image create (name or id)")
+	if err := createCmd.RegisterFlagCompletionFunc("image", completeImageNames); err != nil {
+		panic(err)
+	}
+	createCmd.Flags().StringVar(&createTemplate, "launch-template", "", "launch from launch template <name|id>[:version], security group, instance profile, tags and subnet are merged over it")
+	createCmd.Flags().IntVar(&createConcurrency, "concurrency", 5, "maximum number of instances created in parallel (with --count)")
 	Root.AddCommand(createCmd)
 }
 
 func runCreate(cmd *cobra.Command, args []string) {
 	name := args[0]
-	logger := NewLogger()
-	client := NewClient(logger)
-	subnet := SelectSubnet(client)
-	if !prompt.Prompt(fmt.Sprintf("create %s EC2 instance in %s region %s - %q subnet", name, client.Region, subnet.Id, subnet.Name)) {
+	if createCount < 1 {
+		fmt.Fprintln(humanOutput(), "count has to be at least 1")
+		os.Exit(1)
+	}
+
+	if createNewVpc && (createSubnet != "" || createIpv6) {
+		fmt.Fprintln(humanOutput(), "--new-vpc cannot be used with --subnet or --ipv6")
+		os.Exit(1)
+	}
+	if createCidr != "" {
+		if !createNewVpc {
+			fmt.Fprintln(humanOutput(), "--cidr can only be used with --new-vpc")
+			os.Exit(1)
+		}
+		if _, _, err := vpc.NetworkCidrBlocks(createCidr); err != nil {
+			fmt.Fprintln(humanOutput(), err)
+			os.Exit(1)
+		}
+	}
+
+	progress, logLevel := newProgress(cmd)
+	logger := newLogger(logLevel)
+	client := NewClient(logger).WithReporter(progress)
+	invalidateCompletions(logger)
+	opts := ec2.CreateOptions{Ipv6: createIpv6, NewVpc: createNewVpc, NewVpcCidr: createCidr, SsmEndpoints: createEndpoints, Eip: createEip}
+	if createImage != "" {
+		image, err := client.GetImage(createImage)
+		if err != nil {
+			exitWithError(err)
+		}
+		opts.ImageId = image.Id
+	}
+	if createTemplate != "" {
+		template, err := client.GetLaunchTemplate(createTemplate)
+		if err != nil {
+			exitWithError(fmt.Errorf("launch template %s: %w", createTemplate, err))
+		}
+		opts.LaunchTemplate = template
+	}
+
+	// subnet is not selected if new VPC is created
+	var subnet vpc.Subnet
+	var subnets []vpc.Subnet
+	location := "new VPC"
+	if !createNewVpc {
+		subnet = SelectSubnet(client, createSubnet, createIpv6)
+		if createIpv6 && !subnet.HasIpv6() {
+			fmt.Fprintf(humanOutput(), "subnet %s does not have IPv6 CIDR block\n", subnet.Id)
+			os.Exit(1)
+		}
+		subnets = []vpc.Subnet{subnet}
+		location = fmt.Sprintf("%s - %q subnet", subnet.Id, subnet.Name)
+		if createCount > 1 {
+			var err error
+			if subnets, err = client.SpreadSubnets(subnet); err != nil {
+				exitWithError(err)
+			}
+			var azs []string
+			for _, s := range subnets {
+				azs = append(azs, s.AvailabilityZone)
+			}
+			location = fmt.Sprintf("%s VPC across %s", subnet.VpcId, strings.Join(azs, ", "))
+		}
+		if !createEndpoints {
+			warnSSMReachability(client, subnets)
+		}
+	}
+
+	for _, conflict := range client.LaunchTemplateConflicts(name, subnet, opts) {
+		fmt.Fprintf(humanOutput(), "WARNING: launch template %s %s\n", opts.LaunchTemplate.Name, conflict)
+	}
+
+	cost := client.EstimateCost(opts)
+	cost.Hourly *= float64(createCount)
+	if budget > 0 {
+		warnBudget(addCost(fleetCost(client), cost))
+	}
+
+	plan := client.PlanCreate(name, createCount, subnets, opts)
+	if dryRun {
+		printDryRun(logger, plan, client.DryRunCreate(name, subnet, opts))
+		return
+	}
+
+	if createCount > 1 {
+		runCreateBatch(logger, client, progress, name, subnets, location, opts, plan, cost)
 		return
 	}
 
-	instance, err := client.Create(name, subnet)
+	if !prompt.PromptDetails(fmt.Sprintf("create %s EC2 instance in %s region %s, estimated cost %s/hr %s/month",
+		name, client.Region, location, formatPrice(cost, cost.Hourly), formatPrice(cost, cost.Monthly())), plan.String()) {
+		return
+	}
+
+	instance, err := client.Create(name, subnet, opts)
+	progress.Stop()
+	var eipErr *ec2.ElasticIpError
+	if errors.As(err, &eipErr) {
+		fmt.Fprintln(humanOutput(), eipErr)
+		fmt.Fprintf(humanOutput(), "hint: instance is kept, attach elastic ip with ec2 eip attach %s\n", name)
+		os.Exit(errs.ExitCode(err))
+	}
 	if err != nil {
-		fmt.Printf("create %s EC2: %v\n", name, err)
+		printConsoleTail(err)
+		exitWithError(fmt.Errorf("create %s EC2: %w", name, err))
+	}
+	if events != eventsNdjson {
+		fmt.Printf("EC2 instance %s created\n", instance.Id)
+	}
+}
+
+func runCreateBatch(logger *slog.Logger, client ec2.Client, progress out.Progress, name string, subnets []vpc.Subnet, location string, opts ec2.CreateOptions, plan ec2.Plan, cost ec2.Cost) {
+	names := ec2.BatchNames(name, createCount)
+	if !prompt.PromptDetails(fmt.Sprintf("create %d EC2 instances (%s to %s) in %s region %s, estimated cost %s/hr %s/month",
+		createCount, names[0], names[len(names)-1], client.Region, location,
+		formatPrice(cost, cost.Hourly), formatPrice(cost, cost.Monthly())), plan.String()) {
+		return
+	}
+
+	results, err := client.CreateBatch(name, createCount, createConcurrency, subnets, opts)
+	progress.Stop()
+	if err != nil {
+		exitWithError(fmt.Errorf("create %s EC2 batch: %w", name, err))
+	}
+
+	// results are already written as events
+	if events != eventsNdjson {
+		table := out.NewTable(logger, os.Stdout)
+		table.AddRow("NAME", "ID", "SUBNET", "AZ", "PUBLIC IP", "PRIVATE IP", "IPV6", "RESULT")
+		for _, result := range results {
+			status := "created"
+			if result.Err != nil {
+				status = result.Err.Error()
+			}
+			table.AddRow(
+				result.Name,
+				result.Instance.Id,
+				result.Subnet.Id,
+				result.Subnet.AvailabilityZone,
+				formatPublicIp(result.Instance),
+				result.Instance.PrivateIp,
+				result.Instance.Ipv6Address,
+				status,
+			)
+		}
+		table.Print()
+	}
+
+	for _, result := range results {
+		printConsoleTail(result.Err)
+	}
+
+	if failed := results.Failed(); failed > 0 {
+		fmt.Fprintf(humanOutput(), "%d out of %d instances failed, instances that were launched are kept, delete them with ec2 delete\n", failed, len(results))
 		os.Exit(1)
 	}
-	fmt.Printf("EC2 instance %s created\n", instance.Id)
+}
+
+// warnSSMReachability prints warning for every subnet, where launched instance would not be able to reach SSM
+// endpoints and would not be accessible by exec and cp commands
+func warnSSMReachability(client ec2.Client, subnets []vpc.Subnet) {
+	for _, subnet := range subnets {
+		reachability, err := client.CheckSSMReachability(subnet)
+		if err != nil {
+			fmt.Fprintf(humanOutput(), "WARNING: cannot verify SSM reachability from %s subnet: %v\n", subnet.Id, err)
+			continue
+		}
+		if !reachability.Reachable {
+			fmt.Fprintf(humanOutput(), "WARNING: instance in %s subnet will not be able to reach SSM (%s)\n", subnet.Id, reachability.Reason)
+			fmt.Fprintf(humanOutput(), "hint: %s (or use --ssm-endpoints)\n", reachability.Hint())
+		}
+	}
 }
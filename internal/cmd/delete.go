@@ -2,39 +2,143 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/cmd/out"
 	"github.com/pete911/ec2/internal/cmd/prompt"
+	"github.com/pete911/ec2/internal/ec2"
 	"github.com/spf13/cobra"
 	"os"
+	"path"
+	"strings"
 )
 
 var (
 	deleteCmd = &cobra.Command{
-		Use:   "delete",
-		Short: "delete EC2 instance",
-		Long:  "",
-		Run:   runDelete,
+		Use:               "delete [name|pattern...]",
+		Short:             "delete EC2 instances",
+		Long:              "delete EC2 instances by name or glob pattern (e.g. 'loadtest-*'), user is prompted to select instances if none is supplied",
+		ValidArgsFunction: completeManyInstanceNames,
+		Run:               runDelete,
 	}
+	deleteAll         bool
+	deleteConcurrency int
 )
 
 func init() {
+	addDryRunFlag(deleteCmd)
+	addEventsFlag(deleteCmd)
+	deleteCmd.Flags().BoolVar(&deleteAll, "all", false, "delete all instances")
+	deleteCmd.Flags().IntVar(&deleteConcurrency, "concurrency", 10, "maximum number of instances terminated in parallel")
 	Root.AddCommand(deleteCmd)
 }
 
 func runDelete(cmd *cobra.Command, args []string) {
-	var name string
-	if len(args) > 0 {
-		name = args[0]
+	if deleteAll && len(args) > 0 {
+		fmt.Fprintln(humanOutput(), "instance names cannot be combined with --all flag")
+		os.Exit(1)
+	}
+
+	progress, logLevel := newProgress(cmd)
+	logger := newLogger(logLevel)
+	client := NewClient(logger).WithReporter(progress)
+	invalidateCompletions(logger)
+	instances := selectDeleteInstances(client, args)
+	if len(instances) == 0 {
+		fmt.Fprintln(humanOutput(), "no instances selected")
+		return
 	}
 
-	logger := NewLogger()
-	client := NewClient(logger)
-	instance := SelectInstance(client, name)
-	if !prompt.Prompt(fmt.Sprintf("delete %s EC2 instance in %s region", instance, client.Region)) {
+	plan := client.PlanDelete(instances)
+	if dryRun {
+		printDryRun(logger, plan, client.DryRunDelete(instances))
 		return
 	}
 
-	if err := client.Delete(instance); err != nil {
-		fmt.Printf("delete %s EC2: %v\n", instance.Name, err)
+	if len(instances) == 1 {
+		instance := instances[0]
+		if !prompt.PromptDetails(fmt.Sprintf("delete %s EC2 instance in %s region", instance.Name, client.Region), plan.String()) {
+			return
+		}
+		err := client.Delete(instance)
+		progress.Stop()
+		if err != nil {
+			exitWithError(fmt.Errorf("delete %s EC2: %w", instance.Name, err))
+		}
+		return
+	}
+
+	if !prompt.PromptDetails(fmt.Sprintf("delete %d EC2 instances in %s region", len(instances), client.Region), plan.String()) {
+		return
+	}
+	results, err := client.DeleteBatch(instances, deleteConcurrency)
+	progress.Stop()
+
+	// results are already written as events
+	if events != eventsNdjson {
+		table := out.NewTable(logger, os.Stdout)
+		table.AddRow("ID", "NAME", "RESULT")
+		for _, result := range results {
+			status := "deleted"
+			if result.Err != nil {
+				status = result.Err.Error()
+			}
+			table.AddRow(result.Instance.Id, result.Instance.Name, status)
+		}
+		table.Print()
+	}
+
+	if err != nil {
+		exitWithError(fmt.Errorf("delete security groups and instance profiles: %w", err))
+	}
+	if failed := results.Failed(); failed > 0 {
+		fmt.Fprintf(humanOutput(), "%d out of %d instances failed to delete\n", failed, len(results))
 		os.Exit(1)
 	}
 }
+
+// selectDeleteInstances returns all instances (--all), instances matching supplied names/patterns, or instances
+// selected by user if no argument is supplied
+func selectDeleteInstances(client ec2.Client, args []string) aws.Instances {
+	instances, err := client.List()
+	if err != nil {
+		exitWithError(err)
+	}
+	if deleteAll {
+		return instances
+	}
+
+	if len(args) == 0 {
+		var selected aws.Instances
+		for _, i := range prompt.MultiSelect("instances", instances.Names()) {
+			selected = append(selected, instances[i])
+		}
+		return selected
+	}
+
+	var selected aws.Instances
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		pattern := strings.TrimPrefix(arg, ec2.NamePrefix)
+		if _, err := path.Match(pattern, ""); err != nil {
+			fmt.Fprintf(humanOutput(), "invalid pattern %q: %v\n", arg, err)
+			os.Exit(1)
+		}
+
+		var matched bool
+		for _, instance := range instances {
+			if ok, _ := path.Match(pattern, strings.TrimPrefix(instance.Name, ec2.NamePrefix)); !ok {
+				continue
+			}
+			matched = true
+			if !seen[instance.Id] {
+				seen[instance.Id] = true
+				selected = append(selected, instance)
+			}
+		}
+		if !matched {
+			fmt.Fprintf(humanOutput(), "instance %s not found\n", arg)
+			os.Exit(1)
+		}
+	}
+	return selected
+}
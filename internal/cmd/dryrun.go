@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/cmd/out"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+)
+
+// dryRun prints plan and verifies permissions without making any changes
+var dryRun bool
+
+func addDryRunFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print plan and verify EC2 permissions without making any changes")
+}
+
+// printDryRun prints plan and results of the dry run API calls and exits with non-zero exit code if any of the
+// permissions is missing
+func printDryRun(logger *slog.Logger, plan ec2.Plan, results []aws.DryRunResult) {
+	fmt.Println(plan)
+	fmt.Println()
+
+	var failed int
+	table := out.NewTable(logger, os.Stdout)
+	table.AddRow("OPERATION", "RESULT")
+	for _, result := range results {
+		status := "allowed"
+		if result.Err != nil {
+			status = result.Err.Error()
+			failed++
+		}
+		table.AddRow(result.Operation, status)
+	}
+	table.Print()
+	fmt.Println("IAM does not support dry run, IAM permissions were not verified")
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+var (
+	eipCmd = &cobra.Command{
+		Use:   "eip",
+		Short: "attach or detach elastic IP",
+		Long:  "",
+	}
+	eipAttachCmd = &cobra.Command{
+		Use:   "attach [name]",
+		Short: "allocate and associate elastic IP with EC2 instance",
+		Long: "allocate and associate elastic IP with EC2 instance, elastic IP is released when the instance is deleted " +
+			"or elastic IP detached. Existing elastic IP can be associated with --allocation-id, it is never released",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeInstanceNames,
+		Run:               runEipAttach,
+	}
+	eipDetachCmd = &cobra.Command{
+		Use:               "detach [name]",
+		Short:             "disassociate elastic IP from EC2 instance and release it if it was allocated by attach",
+		Long:              "",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeInstanceNames,
+		Run:               runEipDetach,
+	}
+	eipAllocationId string
+)
+
+func init() {
+	eipAttachCmd.Flags().StringVar(&eipAllocationId, "allocation-id", "", "associate existing elastic IP instead of allocating new one")
+	eipCmd.AddCommand(eipAttachCmd)
+	eipCmd.AddCommand(eipDetachCmd)
+	Root.AddCommand(eipCmd)
+}
+
+func runEipAttach(cmd *cobra.Command, args []string) {
+	logger := NewLogger()
+	client := NewClient(logger)
+	invalidateCompletions(logger)
+	instance := SelectInstance(client, firstArg(args))
+
+	address, err := client.AttachElasticIp(instance, eipAllocationId)
+	if err != nil {
+		exitWithError(fmt.Errorf("attach elastic ip to %s: %w", instance.Name, err))
+	}
+	fmt.Printf("elastic ip %s (%s) attached to %s\n", address.PublicIp, address.AllocationId, instance.Name)
+}
+
+func runEipDetach(cmd *cobra.Command, args []string) {
+	logger := NewLogger()
+	client := NewClient(logger)
+	invalidateCompletions(logger)
+	instance := SelectInstance(client, firstArg(args))
+
+	addresses, err := client.DetachElasticIp(instance)
+	if err != nil {
+		exitWithError(fmt.Errorf("detach elastic ip from %s: %w", instance.Name, err))
+	}
+	if len(addresses) == 0 {
+		fmt.Printf("instance %s does not have elastic ip\n", instance.Name)
+		return
+	}
+	for _, address := range addresses {
+		fmt.Printf("elastic ip %s (%s) detached from %s\n", address.PublicIp, address.AllocationId, instance.Name)
+	}
+}
+
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
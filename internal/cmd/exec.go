@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/cmd/out"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	execCmd = &cobra.Command{
+		Use:               "exec [name] -- <command>",
+		Short:             "run shell command on EC2 instances via SSM",
+		Long:              "",
+		Args:              execArgs,
+		ValidArgsFunction: completeInstanceNames,
+		Run:               runExec,
+	}
+	execAll     bool
+	execTags    map[string]string
+	execTimeout time.Duration
+)
+
+func init() {
+	execCmd.Flags().BoolVar(&execAll, "all", false, "run command on all instances")
+	execCmd.Flags().StringToStringVar(&execTags, "tag", nil, "run command on instances with tag (key=value), can be repeated")
+	execCmd.Flags().DurationVar(&execTimeout, "timeout", 10*time.Minute, "command execution timeout")
+	Root.AddCommand(execCmd)
+}
+
+// execArgs validates that command is supplied after -- and that only instance name is supplied before it
+func execArgs(cmd *cobra.Command, args []string) error {
+	dash := cmd.ArgsLenAtDash()
+	if dash < 0 || dash == len(args) {
+		return errors.New("command has to be supplied after --")
+	}
+	if dash > 1 {
+		return fmt.Errorf("only instance name can be supplied before --, got %q", strings.Join(args[:dash], " "))
+	}
+	return nil
+}
+
+func runExec(cmd *cobra.Command, args []string) {
+	dash := cmd.ArgsLenAtDash()
+	var name string
+	if dash > 0 {
+		name = args[0]
+	}
+	command := strings.Join(args[dash:], " ")
+
+	logger := NewLogger()
+	client := NewClient(logger)
+	instances := selectExecInstances(client, name)
+
+	output := func(instance aws.Instance, line string, stderr bool) {
+		w := os.Stdout
+		if stderr {
+			w = os.Stderr
+		}
+		fmt.Fprintf(w, "[%s] %s\n", instance.Name, line)
+	}
+
+	results, err := client.Exec(instances, command, execTimeout, output)
+	if err != nil {
+		exitWithError(fmt.Errorf("exec %q: %w", command, err))
+	}
+
+	fmt.Println()
+	table := out.NewTable(logger, os.Stdout)
+	table.AddRow("ID", "NAME", "STATUS", "EXIT CODE", "DETAILS")
+	for _, result := range results {
+		table.AddRow(
+			result.Instance.Id,
+			result.Instance.Name,
+			result.Status(),
+			strconv.Itoa(result.Invocation.ResponseCode),
+			result.Details(),
+		)
+	}
+	table.Print()
+
+	if failed := results.Failed(); len(failed) > 0 {
+		fmt.Printf("command failed or its output was truncated on %d out of %d instances\n", len(failed), len(results))
+		os.Exit(1)
+	}
+}
+
+// selectExecInstances returns instances matching --all or --tag flags, or single instance selected by name/prompt
+func selectExecInstances(client ec2.Client, name string) aws.Instances {
+	if !execAll && len(execTags) == 0 {
+		return aws.Instances{SelectInstance(client, name)}
+	}
+	if name != "" {
+		fmt.Println("instance name cannot be combined with --all or --tag flags")
+		os.Exit(1)
+	}
+
+	instances, err := client.List()
+	if err != nil {
+		exitWithError(err)
+	}
+	instances = instances.FilterByTags(execTags)
+	if len(instances) == 0 {
+		fmt.Println("no instances found")
+		os.Exit(1)
+	}
+	return instances
+}
@@ -4,11 +4,23 @@ import (
 	"fmt"
 	"github.com/spf13/cobra"
 	"os"
+	"strings"
+	"time"
 )
 
 var (
-	Region   string
-	LogLevel string
+	Region      string
+	LogLevel    string
+	LogFormat   string
+	LogFile     string
+	LogApiCalls bool
+	Refresh     bool
+	CacheTTL    time.Duration
+	Record      string
+	Replay      string
+	EndpointUrl string
+	// ServiceEndpointUrls endpoint url per service (ec2, iam, sts, ssm), overrides EndpointUrl
+	ServiceEndpointUrls = make(map[string]*string)
 )
 
 func InitPersistentFlags(cmd *cobra.Command) {
@@ -21,9 +33,64 @@ func InitPersistentFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringVar(
 		&LogLevel,
 		"log-level",
-		GetStringEnv("LOG", "debug"),
+		GetStringEnv("LOG", "info"),
 		"log level - debug, info, warn, error",
 	)
+	cmd.PersistentFlags().StringVar(
+		&LogFormat,
+		"log-format",
+		GetStringEnv("LOG_FORMAT", "text"),
+		"log format - text, json",
+	)
+	cmd.PersistentFlags().StringVar(
+		&LogFile,
+		"log-file",
+		GetStringEnv("LOG_FILE", ""),
+		"append logs to the file instead of stderr",
+	)
+	cmd.PersistentFlags().BoolVar(
+		&LogApiCalls,
+		"log-api-calls",
+		false,
+		"log every AWS API call with operation, latency, retry count and request id (info level)",
+	)
+	cmd.PersistentFlags().BoolVar(
+		&Refresh,
+		"refresh",
+		false,
+		"ignore cached VPCs and completion suggestions and fetch them from AWS",
+	)
+	cmd.PersistentFlags().DurationVar(
+		&CacheTTL,
+		"cache-ttl",
+		GetDurationEnv("CACHE_TTL", 5*time.Minute),
+		"how long are VPCs and instances (for shell completion) cached, 0 disables the cache",
+	)
+	cmd.PersistentFlags().StringVar(
+		&Record,
+		"record",
+		"",
+		"record AWS API requests and responses (credentials, SSM commands and S3 objects redacted) to the file",
+	)
+	cmd.PersistentFlags().StringVar(
+		&Replay,
+		"replay",
+		"",
+		"serve AWS API responses from the file created by --record instead of calling AWS",
+	)
+	cmd.PersistentFlags().StringVar(
+		&EndpointUrl,
+		"endpoint-url",
+		"",
+		"AWS endpoint url for all services, e.g. http://localhost:4566 for LocalStack",
+	)
+	for _, service := range []string{"ec2", "iam", "sts", "ssm"} {
+		ServiceEndpointUrls[service] = cmd.PersistentFlags().String(
+			fmt.Sprintf("endpoint-url-%s", service),
+			"",
+			fmt.Sprintf("%s endpoint url, overrides --endpoint-url", strings.ToUpper(service)),
+		)
+	}
 }
 
 func GetStringEnv(envName string, defaultValue string) string {
@@ -33,3 +100,16 @@ func GetStringEnv(envName string, defaultValue string) string {
 	}
 	return env
 }
+
+func GetDurationEnv(envName string, defaultValue time.Duration) time.Duration {
+	env := GetStringEnv(envName, "")
+	if env == "" {
+		return defaultValue
+	}
+	v, err := time.ParseDuration(env)
+	if err != nil {
+		fmt.Printf("invalid AWS_EC2_%s duration %q, using default %s\n", envName, env, defaultValue)
+		return defaultValue
+	}
+	return v
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/cmd/out"
+	"github.com/pete911/ec2/internal/cmd/prompt"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+var (
+	imageCmd = &cobra.Command{
+		Use:   "image",
+		Short: "create, list and delete images (AMIs) baked from EC2 instances",
+		Long:  "",
+	}
+	imageCreateCmd = &cobra.Command{
+		Use:   "create [name] --image-name <image-name>",
+		Short: "create image from EC2 instance",
+		Long: "create image from EC2 instance and wait for it to become available. Image is tagged with source " +
+			"instance and base image, launch instance from the image with ec2 create --image <image-name>",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeInstanceNames,
+		Run:               runImageCreate,
+	}
+	imageListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "list images",
+		Long:  "",
+		Args:  cobra.NoArgs,
+		Run:   runImageList,
+	}
+	imageDeleteCmd = &cobra.Command{
+		Use:               "delete <image-name>",
+		Short:             "deregister image and delete its snapshots",
+		Long:              "",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeImageNames,
+		Run:               runImageDelete,
+	}
+	imageName     string
+	imageNoReboot bool
+)
+
+func init() {
+	imageCreateCmd.Flags().StringVar(&imageName, "image-name", "", "image name (required)")
+	imageCreateCmd.Flags().BoolVar(&imageNoReboot, "no-reboot", false, "do not reboot instance, file system consistency is not guaranteed")
+	if err := imageCreateCmd.MarkFlagRequired("image-name"); err != nil {
+		panic(err)
+	}
+	imageCmd.AddCommand(imageCreateCmd)
+	imageCmd.AddCommand(imageListCmd)
+	imageCmd.AddCommand(imageDeleteCmd)
+	Root.AddCommand(imageCmd)
+}
+
+func runImageCreate(cmd *cobra.Command, args []string) {
+	logger := NewLogger()
+	client := NewClient(logger)
+	invalidateCompletions(logger)
+	instance := SelectInstance(client, firstArg(args))
+
+	label := fmt.Sprintf("create %s image from %s EC2 instance", imageName, instance.Name)
+	if !imageNoReboot {
+		label = fmt.Sprintf("%s (instance will be rebooted)", label)
+	}
+	if !prompt.Prompt(label) {
+		return
+	}
+
+	image, err := client.CreateImage(instance, imageName, imageNoReboot)
+	if err != nil {
+		exitWithError(fmt.Errorf("create %s image: %w", imageName, err))
+	}
+	fmt.Printf("image %s %s created\n", image.Name, image.Id)
+}
+
+func runImageList(cmd *cobra.Command, _ []string) {
+	logger := NewLogger()
+	client := NewClient(logger)
+
+	images, err := client.ListImages()
+	if err != nil {
+		exitWithError(fmt.Errorf("list images: %w", err))
+	}
+
+	table := out.NewTable(logger, os.Stdout)
+	table.AddRow("ID", "NAME", "STATE", "CREATED", "SOURCE INSTANCE", "BASE IMAGE", "SNAPSHOTS")
+	for _, image := range images {
+		table.AddRow(
+			image.Id,
+			image.Name,
+			image.State,
+			image.CreationDate,
+			fmt.Sprintf("%s %s", image.Tags[aws.SourceInstanceNameTagKey], image.Tags[aws.SourceInstanceIdTagKey]),
+			image.Tags[aws.BaseImageIdTagKey],
+			strings.Join(image.SnapshotIds, ", "),
+		)
+	}
+	table.Print()
+}
+
+func runImageDelete(cmd *cobra.Command, args []string) {
+	logger := NewLogger()
+	client := NewClient(logger)
+	invalidateCompletions(logger)
+
+	image, err := client.GetImage(args[0])
+	if err != nil {
+		exitWithError(err)
+	}
+	if !prompt.Prompt(fmt.Sprintf("delete %s image %s and %d snapshots", image.Name, image.Id, len(image.SnapshotIds))) {
+		return
+	}
+	if err := client.DeleteImage(image); err != nil {
+		exitWithError(fmt.Errorf("delete %s image: %w", image.Name, err))
+	}
+	fmt.Printf("image %s deleted\n", image.Name)
+}
@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/pete911/ec2/internal/aws"
 	"github.com/pete911/ec2/internal/cmd/out"
+	"github.com/pete911/ec2/internal/ec2"
 	"github.com/spf13/cobra"
 	"os"
 	"time"
@@ -18,6 +20,7 @@ var (
 )
 
 func init() {
+	addBudgetFlag(listCmd)
 	Root.AddCommand(listCmd)
 }
 
@@ -27,22 +30,41 @@ func runList(cmd *cobra.Command, _ []string) {
 
 	instances, err := client.List()
 	if err != nil {
-		fmt.Printf("list instances: %v\n", err)
-		os.Exit(1)
+		exitWithError(fmt.Errorf("list instances: %w", err))
 	}
 
+	costs, err := client.Costs(instances)
+	if err != nil {
+		exitWithError(fmt.Errorf("list instances cost: %w", err))
+	}
+
+	total := ec2.Cost{Complete: true}
 	table := out.NewTable(logger, os.Stdout)
-	table.AddRow("ID", "NAME", "HOST", "PUBLIC IP", "PRIVATE IP", "TYPE", "LAUNCH TIME")
+	table.AddRow("ID", "NAME", "HOST", "PUBLIC IP", "PRIVATE IP", "IPV6", "TYPE", "LAUNCH TIME", "COST/HR", "ACCRUED")
 	for _, instance := range instances {
+		cost := costs[instance.Id]
+		total = addCost(total, cost)
 		table.AddRow(
 			instance.Id,
 			instance.Name,
 			instance.PublicDnsName,
-			instance.PublicIp,
+			formatPublicIp(instance),
 			instance.PrivateIp,
+			instance.Ipv6Address,
 			instance.InstanceType,
 			instance.LaunchTime.Format(time.RFC822),
+			formatPrice(cost, cost.Hourly),
+			formatPrice(cost, cost.Accrued(instance.LaunchTime)),
 		)
 	}
 	table.Print()
+	warnBudget(total)
+}
+
+// formatPublicIp returns public IP, elastic IP is marked with "(eip)"
+func formatPublicIp(instance aws.Instance) string {
+	if instance.PublicIpElastic {
+		return instance.PublicIp + " (eip)"
+	}
+	return instance.PublicIp
 }
@@ -0,0 +1,44 @@
+package out
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+)
+
+const (
+	FormatTable = "table"
+	FormatJson  = "json"
+	FormatYaml  = "yaml"
+)
+
+// ValidateFormat returns error if the output format is not one of table, json or yaml
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatTable, FormatJson, FormatYaml:
+		return nil
+	}
+	return fmt.Errorf("invalid output format %q, supported formats are %s, %s and %s", format, FormatTable, FormatJson, FormatYaml)
+}
+
+// Print writes v in json or yaml format. Yaml is converted from json, so both formats have the same field names
+func Print(w io.Writer, format string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal json: %w", err)
+	}
+	if format == FormatYaml {
+		var data any
+		if err := json.Unmarshal(b, &data); err != nil {
+			return fmt.Errorf("unmarshal json: %w", err)
+		}
+		if b, err = yaml.Marshal(data); err != nil {
+			return fmt.Errorf("marshal yaml: %w", err)
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
@@ -0,0 +1,207 @@
+package out
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pete911/ec2/internal/progress"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sharedResources = "shared resources"
+
+var spinner = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Progress renders progress events, Stop has to be called before anything else is written to the output
+type Progress interface {
+	progress.Reporter
+	Stop()
+}
+
+// NewNdjsonProgress writes every event as JSON line
+func NewNdjsonProgress(w io.Writer) Progress {
+	return &ndjsonProgress{encoder: json.NewEncoder(w)}
+}
+
+type ndjsonProgress struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func (p *ndjsonProgress) Report(e progress.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// output can be closed by the consumer, there is nothing to do about it
+	_ = p.encoder.Encode(e)
+}
+
+func (p *ndjsonProgress) Stop() {}
+
+// NewPlainProgress writes every event as line prefixed with elapsed time, it is used when output is not a terminal
+func NewPlainProgress(w io.Writer) Progress {
+	return &plainProgress{w: w, start: time.Now()}
+}
+
+type plainProgress struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+}
+
+func (p *plainProgress) Report(e progress.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "[%6s] %s: %s\n", formatElapsed(e.Time.Sub(p.start)), rowName(e), formatEvent(e))
+}
+
+func (p *plainProgress) Stop() {}
+
+// NewLiveProgress renders one line per instance (and shared resources) with spinner, last event and elapsed time,
+// lines are redrawn in place, so the output has to be a terminal
+func NewLiveProgress(w io.Writer) Progress {
+	return &liveProgress{w: w, rows: make(map[string]*progressRow), done: make(chan struct{})}
+}
+
+type progressRow struct {
+	name     string
+	start    time.Time
+	end      time.Time
+	last     string
+	finished bool
+	failed   bool
+}
+
+type liveProgress struct {
+	mu      sync.Mutex
+	w       io.Writer
+	order   []string
+	rows    map[string]*progressRow
+	drawn   int
+	frame   int
+	started bool
+	stopped bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func (p *liveProgress) Report(e progress.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return
+	}
+
+	name := rowName(e)
+	row, ok := p.rows[name]
+	if !ok {
+		row = &progressRow{name: name, start: e.Time}
+		p.rows[name] = row
+		p.order = append(p.order, name)
+	}
+	// shared resources row can be finished by create and reopened by delete of the next resource
+	row.finished, row.failed = false, false
+	row.last = formatEvent(e)
+	if e.Type == progress.Done || e.Type == progress.Failed {
+		row.finished, row.failed, row.end = true, e.Type == progress.Failed, e.Time
+	}
+
+	// ticker is started on the first event, so the view does not interfere with prompts
+	if !p.started {
+		p.started = true
+		p.wg.Add(1)
+		go p.tick()
+	}
+	p.draw()
+}
+
+func (p *liveProgress) Stop() {
+	p.mu.Lock()
+	if p.stopped || !p.started {
+		p.stopped = true
+		p.mu.Unlock()
+		return
+	}
+	p.stopped = true
+	close(p.done)
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.draw()
+}
+
+func (p *liveProgress) tick() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.frame++
+			p.draw()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// draw moves cursor to the first line of the view and redraws every row, it has to be called with the lock held
+func (p *liveProgress) draw() {
+	var b strings.Builder
+	if p.drawn > 0 {
+		fmt.Fprintf(&b, "\033[%dA", p.drawn)
+	}
+
+	width := 0
+	for _, name := range p.order {
+		width = max(width, len(name))
+	}
+	now := time.Now()
+	for _, name := range p.order {
+		row := p.rows[name]
+		symbol, end := spinner[p.frame%len(spinner)], now
+		if p.stopped {
+			// create or delete returned without finishing the row, e.g. shared resources that are kept
+			symbol = "-"
+		}
+		if row.finished {
+			symbol, end = "✓", row.end
+			if row.failed {
+				symbol = "✗"
+			}
+		}
+		fmt.Fprintf(&b, "\033[2K%s %-*s  %6s  %s\n", symbol, width, row.name, formatElapsed(end.Sub(row.start)), row.last)
+	}
+	p.drawn = len(p.order)
+	fmt.Fprint(p.w, b.String())
+}
+
+func rowName(e progress.Event) string {
+	if e.Instance == "" {
+		return sharedResources
+	}
+	return e.Instance
+}
+
+// formatEvent returns event as "<resource> <id>: <message>" on single line
+func formatEvent(e progress.Event) string {
+	message := strings.ReplaceAll(e.Message, "\n", "; ")
+	resource := strings.TrimSpace(fmt.Sprintf("%s %s", e.Resource, e.Id))
+	if resource == "" {
+		return message
+	}
+	return fmt.Sprintf("%s: %s", resource, message)
+}
+
+func formatElapsed(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+}
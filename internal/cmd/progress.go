@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pete911/ec2/internal/cmd/flag"
+	"github.com/pete911/ec2/internal/cmd/out"
+	"github.com/pete911/ec2/internal/cmd/prompt"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+const eventsNdjson = "ndjson"
+
+var events string
+
+func addEventsFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&events, "events", "", "write progress events to stdout as JSON lines (ndjson) instead of progress view")
+}
+
+// newProgress returns progress view on terminal, plain lines otherwise, or JSON lines with --events ndjson, and log
+// level of the logger. Log lines would break the live view, so default log level is raised to warn, unless it is set
+// explicitly or logs are written to file. API calls are logged on purpose, so plain lines are used with
+// --log-api-calls. With --events ndjson, stdout contains only events and prompts are written to stderr
+func newProgress(cmd *cobra.Command) (out.Progress, string) {
+	switch {
+	case events == eventsNdjson:
+		prompt.Output = os.Stderr
+		return out.NewNdjsonProgress(os.Stdout), flag.LogLevel
+	case events != "":
+		fmt.Printf("invalid events format %s, only %s is supported\n", events, eventsNdjson)
+		os.Exit(1)
+	}
+
+	if !isTerminal(os.Stdout) || (flag.LogApiCalls && flag.LogFile == "") {
+		return out.NewPlainProgress(os.Stdout), flag.LogLevel
+	}
+	if flag.LogFile != "" {
+		return out.NewLiveProgress(os.Stdout), flag.LogLevel
+	}
+	if _, ok := os.LookupEnv("AWS_EC2_LOG"); !ok && !cmd.Flags().Changed("log-level") {
+		return out.NewLiveProgress(os.Stdout), "warn"
+	}
+	return out.NewLiveProgress(os.Stdout), flag.LogLevel
+}
+
+// humanOutput returns writer of human readable output (warnings, hints and errors), it is stderr with --events ndjson,
+// so stdout contains only JSON lines
+func humanOutput() *os.File {
+	if events == eventsNdjson {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
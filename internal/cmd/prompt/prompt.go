@@ -9,15 +9,19 @@ import (
 
 var bold = promptui.Styler(promptui.FGBold)
 
+// Output is where prompts and details are written, it is set to stderr when stdout is used for machine readable output
+var Output = os.Stdout
+
 func Prompt(label string) bool {
 	prompt := promptui.Prompt{
 		Label:     label,
 		IsConfirm: true,
+		Stdout:    Output,
 	}
 
 	if _, err := prompt.Run(); err != nil {
 		// error is returned if the result is not "y"
-		fmt.Println("operation canceled")
+		fmt.Fprintln(Output, "operation canceled")
 		return false
 	}
 	return true
@@ -31,7 +35,7 @@ func Select(label string, items []string, defaultItem string) (int, string) {
 	// no need for prompt if there is only one item to chose from
 	if len(items) == 1 {
 		// replicate prompt ui selected item
-		fmt.Printf("%s %s\n", bold(promptui.IconGood), bold(items[0]))
+		fmt.Fprintf(Output, "%s %s\n", bold(promptui.IconGood), bold(items[0]))
 		return 0, items[0]
 	}
 
@@ -48,6 +52,7 @@ func Select(label string, items []string, defaultItem string) (int, string) {
 		Items:     items,
 		CursorPos: cursorPos,
 		Size:      10,
+		Stdout:    Output,
 		Searcher: func(input string, index int) bool {
 			item := items[index]
 			name := strings.Replace(strings.ToLower(item), " ", "", -1)
@@ -57,8 +62,69 @@ func Select(label string, items []string, defaultItem string) (int, string) {
 	}
 	i, result, err := p.Run()
 	if err != nil {
-		fmt.Printf("%s: %v\n", label, err)
+		fmt.Fprintf(Output, "%s: %v\n", label, err)
 		os.Exit(1)
 	}
 	return i, result
 }
+
+// MultiSelect prompts user to toggle items and returns indexes of selected items (in the original order). Selection
+// is confirmed by choosing "done" item
+func MultiSelect(label string, items []string) []int {
+	if len(items) == 0 {
+		return nil
+	}
+
+	selected := make([]bool, len(items))
+	var cursorPos, scrollPos int
+	for {
+		var count int
+		options := make([]string, len(items)+1)
+		for i, item := range items {
+			checkbox := "[ ]"
+			if selected[i] {
+				checkbox = "[x]"
+				count++
+			}
+			options[i+1] = fmt.Sprintf("%s %s", checkbox, item)
+		}
+		options[0] = fmt.Sprintf("done (%d selected)", count)
+
+		p := promptui.Select{
+			Label:  label,
+			Items:  options,
+			Size:   10,
+			Stdout: Output,
+			Searcher: func(input string, index int) bool {
+				item := options[index]
+				name := strings.Replace(strings.ToLower(item), " ", "", -1)
+				input = strings.Replace(strings.ToLower(input), " ", "", -1)
+				return strings.Contains(name, input)
+			},
+		}
+		i, _, err := p.RunCursorAt(cursorPos, scrollPos)
+		if err != nil {
+			fmt.Fprintf(Output, "%s: %v\n", label, err)
+			os.Exit(1)
+		}
+		if i == 0 {
+			break
+		}
+		selected[i-1] = !selected[i-1]
+		cursorPos, scrollPos = i, max(0, i-p.Size+1)
+	}
+
+	var out []int
+	for i, ok := range selected {
+		if ok {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// PromptDetails prints details (e.g. plan of changes) and asks user to confirm
+func PromptDetails(label, details string) bool {
+	fmt.Fprintln(Output, details)
+	return Prompt(label)
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/cmd/out"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+var (
+	regionsCmd = &cobra.Command{
+		Use:   "regions",
+		Short: "list AWS regions",
+		Long:  "",
+		Run:   runRegions,
+	}
+	regionsGeography string
+)
+
+func init() {
+	regionsCmd.Flags().StringVar(&regionsGeography, "geography", "", "filter regions by geography (e.g. europe, japan)")
+	Root.AddCommand(regionsCmd)
+}
+
+func runRegions(cmd *cobra.Command, _ []string) {
+	logger := NewLogger()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	regions, err := aws.ListRegions(ctx, logger, awsOptions())
+	if err != nil {
+		exitWithError(fmt.Errorf("list regions: %w", err))
+	}
+	if regionsGeography != "" {
+		regions = regions.FilterByGeography(regionsGeography)
+	}
+
+	table := out.NewTable(logger, os.Stdout)
+	table.AddRow("CODE", "NAME", "GEOGRAPHY", "OPTED IN")
+	for _, region := range regions {
+		optedIn := "no"
+		if region.IsOptedIn() {
+			optedIn = "yes"
+		}
+		table.AddRow(region.Code, region.Name, region.Geography, optedIn)
+	}
+	table.Print()
+}
@@ -1,88 +1,235 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/pete911/ec2/internal/aws"
 	"github.com/pete911/ec2/internal/aws/vpc"
+	"github.com/pete911/ec2/internal/cache"
 	"github.com/pete911/ec2/internal/cmd/flag"
 	"github.com/pete911/ec2/internal/cmd/prompt"
 	"github.com/pete911/ec2/internal/ec2"
+	"github.com/pete911/ec2/internal/errs"
+	"github.com/pete911/ec2/internal/state"
 	"github.com/spf13/cobra"
+	"io"
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
 var (
-	Root      = &cobra.Command{}
+	Root      = &cobra.Command{Use: "ec2"}
 	logLevels = map[string]slog.Level{"debug": slog.LevelDebug, "info": slog.LevelInfo, "warn": slog.LevelWarn, "error": slog.LevelError}
 	Version   string
 )
 
 func init() {
 	flag.InitPersistentFlags(Root)
+	if err := Root.RegisterFlagCompletionFunc("region", completeRegions); err != nil {
+		panic(err)
+	}
 }
 
 func NewLogger() *slog.Logger {
-	if level, ok := logLevels[strings.ToLower(flag.LogLevel)]; ok {
-		opts := &slog.HandlerOptions{Level: level}
-		return slog.New(slog.NewTextHandler(os.Stderr, opts))
+	return newLogger(flag.LogLevel)
+}
+
+// newLogger returns logger with the level, that can differ from --log-level flag (e.g. raised by newProgress)
+func newLogger(logLevel string) *slog.Logger {
+	level, ok := logLevels[strings.ToLower(logLevel)]
+	if !ok {
+		fmt.Printf("invalid log level %s\n", logLevel)
+		os.Exit(1)
 	}
 
-	fmt.Printf("invalid log level %s", flag.LogLevel)
+	var w io.Writer = os.Stderr
+	if flag.LogFile != "" {
+		// file is closed on exit
+		f, err := os.OpenFile(flag.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			fmt.Printf("open log file: %v\n", err)
+			os.Exit(1)
+		}
+		w = f
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(flag.LogFormat) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts))
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	fmt.Printf("invalid log format %s\n", flag.LogFormat)
 	os.Exit(1)
 	return nil
 }
 
+// exitWithError prints error with hint and exits with exit code mapped to the error class. Encoded authorization
+// failure message is decoded, so the user can see which permission is missing
+func exitWithError(err error) {
+	fmt.Fprintln(humanOutput(), err)
+	var apiErr *errs.ApiError
+	if errors.As(err, &apiErr) {
+		if hint := apiErr.Hint(); hint != "" {
+			fmt.Fprintf(humanOutput(), "hint: %s\n", hint)
+		}
+		if apiErr.EncodedMessage != "" {
+			printAuthorizationMessage(apiErr.EncodedMessage)
+		}
+	}
+	os.Exit(errs.ExitCode(err))
+}
+
+func printAuthorizationMessage(encodedMessage string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	msg, err := aws.DecodeAuthorizationMessage(ctx, flag.Region, encodedMessage, awsOptions())
+	if err != nil {
+		fmt.Fprintf(humanOutput(), "unable to decode authorization failure message: %v\n", err)
+		return
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(msg), "", "  "); err != nil {
+		fmt.Fprintf(humanOutput(), "authorization failure: %s\n", msg)
+		return
+	}
+	fmt.Fprintf(humanOutput(), "authorization failure:\n%s\n", out.String())
+}
+
 func NewClient(logger *slog.Logger) ec2.Client {
 	// prompt region if user did not select any and set it on client
 	if flag.Region == "" {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 		defer cancel()
 
-		regions, region, err := aws.ListOptedInRegions(ctx, logger)
+		regions, region, err := aws.ListOptedInRegions(ctx, logger, awsOptions())
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			exitWithError(err)
+		}
+
+		// last used region takes precedence over region set in aws config
+		st, err := state.Load()
+		if err != nil {
+			logger.Debug(fmt.Sprintf("load state: %v", err))
+		}
+		if st.LastRegion != "" {
+			region = st.LastRegion
 		}
 
 		i, _ := prompt.Select("region", regions.Names(), aws.RegionByCode(region).Name)
 		selectedRegionCode := regions[i].Code
 		flag.Region = selectedRegionCode
 	}
+	saveLastRegion(logger, flag.Region)
 
-	awsClient, err := aws.NewClient(logger, flag.Region)
+	awsClient, err := aws.NewClient(logger, flag.Region, awsOptions())
 	if err != nil {
-		fmt.Println(err)
+		exitWithError(err)
+	}
+	// cache would serve responses that are not recorded, or store replayed ones
+	cacheTTL := flag.CacheTTL
+	if flag.Record != "" || flag.Replay != "" {
+		cacheTTL = 0
+	}
+	return ec2.NewClient(logger, awsClient, cache.New(logger, cacheTTL, flag.Refresh))
+}
+
+// awsOptions returns AWS options set by flags, record file is created only once, so all AWS configs write to it
+var awsOptions = sync.OnceValue(func() aws.Options {
+	opts := endpointOptions()
+	opts.LogApiCalls = flag.LogApiCalls
+	if flag.Record != "" && flag.Replay != "" {
+		fmt.Println("--record cannot be used with --replay")
 		os.Exit(1)
 	}
-	return ec2.NewClient(logger, awsClient)
+
+	var err error
+	if flag.Record != "" {
+		if opts.Recorder, err = aws.NewRecorder(flag.Record); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if flag.Replay != "" {
+		if opts.Replayer, err = aws.NewReplayer(flag.Replay); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	return opts
+})
+
+// endpointOptions returns AWS options with endpoint urls set by flags
+func endpointOptions() aws.Options {
+	opts := aws.Options{EndpointUrl: flag.EndpointUrl, ServiceEndpointUrls: make(map[string]string)}
+	for service, url := range flag.ServiceEndpointUrls {
+		if *url != "" {
+			opts.ServiceEndpointUrls[service] = *url
+		}
+	}
+	return opts
 }
 
-func SelectSubnet(client ec2.Client) vpc.Subnet {
+func saveLastRegion(logger *slog.Logger, region string) {
+	st, err := state.Load()
+	if err != nil {
+		logger.Debug(fmt.Sprintf("load state: %v", err))
+	}
+	if st.LastRegion == region {
+		return
+	}
+	st.LastRegion = region
+	if err := state.Save(st); err != nil {
+		logger.Debug(fmt.Sprintf("save state: %v", err))
+	}
+}
+
+// SelectSubnet either finds subnet by supplied id, or prompts user to select VPC and subnet if id is empty. Subnets
+// are labeled public for instance with (ipv6 set) or without IPv6 address
+func SelectSubnet(client ec2.Client, subnetId string, ipv6 bool) vpc.Subnet {
 	vpcs, err := client.GetVpcs()
 	if err != nil {
-		fmt.Println(err)
+		exitWithError(err)
+	}
+
+	if subnetId != "" {
+		for _, v := range vpcs {
+			for _, subnet := range v.Subnets {
+				if subnet.Id == subnetId {
+					return subnet
+				}
+			}
+		}
+		fmt.Fprintf(humanOutput(), "subnet %s not found\n", subnetId)
 		os.Exit(1)
 	}
 
-	i, _ := prompt.Select("vpc", vpcLabels(vpcs), "")
+	i, _ := prompt.Select("vpc", vpcLabels(vpcs, ipv6), "")
 	selectedVpc := vpcs[i]
 
-	k, _ := prompt.Select("subnet", subnetLabels(selectedVpc.Subnets), "")
+	k, _ := prompt.Select("subnet", subnetLabels(selectedVpc.Subnets, ipv6), "")
 	return selectedVpc.Subnets[k]
 }
 
-func vpcLabels(in []vpc.Vpc) []string {
+func vpcLabels(in []vpc.Vpc, ipv6 bool) []string {
 	var out []string
 	for _, v := range in {
 		label := fmt.Sprintf("%s %s", v.CidrBlock, v.Id)
 		if v.Name != "" {
 			label = fmt.Sprintf("%s %s", label, v.Name)
 		}
-		if v.HasPublicSubnet() {
+		if v.HasIpv6() {
+			label = fmt.Sprintf("%s %s", label, strings.Join(v.Ipv6CidrBlocks, " "))
+		}
+		if v.HasPublicSubnet(ipv6) {
 			label = fmt.Sprintf("%s [public]", label)
 		}
 		if v.IsDefault {
@@ -93,16 +240,21 @@ func vpcLabels(in []vpc.Vpc) []string {
 	return out
 }
 
-func subnetLabels(in []vpc.Subnet) []string {
+func subnetLabels(in []vpc.Subnet, ipv6 bool) []string {
 	var out []string
 	for _, v := range in {
-		label := fmt.Sprintf("%s %s", v.CidrBlock, v.Id)
+		label := fmt.Sprintf("%s %s", strings.Join(v.CidrBlocks(), " "), v.Id)
 		if v.Name != "" {
 			label = fmt.Sprintf("%s %s", label, v.Name)
 		}
-		if v.IsPubic() {
+		if v.IsPublic(ipv6) {
 			label = fmt.Sprintf("%s [public]", label)
 		}
+		if v.IsIpv6Only() {
+			label = fmt.Sprintf("%s [ipv6-only]", label)
+		} else if v.HasIpv6() {
+			label = fmt.Sprintf("%s [dual-stack]", label)
+		}
 		out = append(out, label)
 	}
 	return out
@@ -112,8 +264,7 @@ func subnetLabels(in []vpc.Subnet) []string {
 func SelectInstance(client ec2.Client, instanceName string) aws.Instance {
 	instances, err := client.List()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		exitWithError(err)
 	}
 
 	if !strings.HasPrefix(instanceName, ec2.NamePrefix) {
@@ -127,7 +278,7 @@ func SelectInstance(client ec2.Client, instanceName string) aws.Instance {
 				return i
 			}
 		}
-		fmt.Printf("instance %s not found\n", instanceName)
+		fmt.Fprintf(humanOutput(), "instance %s not found\n", instanceName)
 		os.Exit(1)
 	}
 
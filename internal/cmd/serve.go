@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/cache"
+	"github.com/pete911/ec2/internal/cmd/flag"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/pete911/ec2/internal/server"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "serve REST API to list, create, delete, start and stop instances",
+		Long: "serve REST API to list, create, delete, start and stop instances, create and delete run as background " +
+			"jobs with progress events. OpenAPI document is served at /openapi.json",
+		Args: cobra.NoArgs,
+		Run:  runServe,
+	}
+	serveAddr     string
+	serveToken    string
+	serveMaxCount int
+)
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", flag.GetStringEnv("SERVE_ADDR", "localhost:8080"), "address to listen on")
+	serveCmd.Flags().StringVar(&serveToken, "token", flag.GetStringEnv("SERVE_TOKEN", ""), "bearer token required by every request (prefer AWS_EC2_SERVE_TOKEN env var)")
+	serveCmd.Flags().IntVar(&serveMaxCount, "max-count", 10, "maximum number of instances created by one create request")
+	Root.AddCommand(serveCmd)
+}
+
+func runServe(_ *cobra.Command, _ []string) {
+	if serveToken == "" {
+		fmt.Println("--token or AWS_EC2_SERVE_TOKEN is required")
+		os.Exit(1)
+	}
+	if serveMaxCount < 1 {
+		fmt.Println("--max-count has to be at least 1")
+		os.Exit(1)
+	}
+	logger := NewLogger()
+	srv := server.NewServer(logger, newServeClients(logger), flag.Region, serveToken, serveMaxCount)
+	httpServer := &http.Server{Addr: serveAddr, Handler: srv.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// second signal kills the process
+		stop()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.Warn(fmt.Sprintf("shutdown: %v", err))
+		}
+	}()
+
+	logger.Info(fmt.Sprintf("listening on %s", serveAddr))
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		exitWithError(err)
+	}
+	// running jobs would leave partially created or deleted resources
+	logger.Info("waiting for running jobs to finish")
+	srv.Wait()
+}
+
+// newServeClients returns client factory that creates client per region once, without prompts and cache
+func newServeClients(logger *slog.Logger) server.ClientFactory {
+	var mu sync.Mutex
+	clients := make(map[string]ec2.Client)
+	return func(region string) (ec2.Client, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if client, ok := clients[region]; ok {
+			return client, nil
+		}
+		awsClient, err := aws.NewClient(logger, region, awsOptions())
+		if err != nil {
+			return ec2.Client{}, err
+		}
+		// instances are changed by other users, so they are always fetched from AWS
+		client := ec2.NewClient(logger, awsClient, cache.New(logger, 0, false))
+		clients[region] = client
+		return client, nil
+	}
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+var (
+	templateCmd = &cobra.Command{
+		Use:   "template",
+		Short: "export EC2 instances to launch templates",
+		Long:  "",
+	}
+	templateExportCmd = &cobra.Command{
+		Use:   "export [name] [--template-name <template-name>]",
+		Short: "create launch template version from EC2 instance",
+		Long: "create launch template version from EC2 instance launch configuration, template is created if it does " +
+			"not exist. Security groups, instance profile, subnet and tags set by this tool are not exported, launch " +
+			"instance from the template with ec2 create --launch-template <template-name>",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeInstanceNames,
+		Run:               runTemplateExport,
+	}
+	templateName string
+)
+
+func init() {
+	templateExportCmd.Flags().StringVar(&templateName, "template-name", "", "template name, instance name is used if not set")
+	templateCmd.AddCommand(templateExportCmd)
+	Root.AddCommand(templateCmd)
+}
+
+func runTemplateExport(cmd *cobra.Command, args []string) {
+	logger := NewLogger()
+	client := NewClient(logger)
+	instance := SelectInstance(client, firstArg(args))
+
+	name := templateName
+	if name == "" {
+		name = instance.Name
+	}
+	template, err := client.ExportLaunchTemplate(instance, name)
+	if err != nil {
+		exitWithError(fmt.Errorf("export %s launch template: %w", name, err))
+	}
+	fmt.Printf("launch template %s created\n", template)
+}
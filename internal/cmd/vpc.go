@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pete911/ec2/internal/aws/vpc"
+	"github.com/pete911/ec2/internal/cmd/out"
+	"github.com/pete911/ec2/internal/cmd/prompt"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	vpcCmd = &cobra.Command{
+		Use:   "vpc",
+		Short: "inspect VPCs, subnets and route tables, delete orphaned VPCs",
+		Long:  "",
+	}
+	vpcListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "list VPCs",
+		Long:  "",
+		Args:  cobra.NoArgs,
+		Run:   runVpcList,
+	}
+	vpcShowCmd = &cobra.Command{
+		Use:               "show <vpc-id>",
+		Short:             "show VPC subnets, route tables and VPC endpoints",
+		Long:              "",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeVpcs,
+		Run:               runVpcShow,
+	}
+	vpcCleanupCmd = &cobra.Command{
+		Use:   "cleanup",
+		Short: "delete orphaned VPCs created with create --new-vpc",
+		Long: `delete VPCs created with create --new-vpc that are not used by any instance anymore (e.g. instance was
+terminated outside this tool or its delete failed), including their subnets, route tables, internet gateway and VPC
+endpoints. Do not run it while create --new-vpc is in progress, new VPC has no instance until it is launched`,
+		Args: cobra.NoArgs,
+		Run:  runVpcCleanup,
+	}
+	vpcOutput        string
+	vpcCleanupDryRun bool
+)
+
+func init() {
+	vpcCmd.PersistentFlags().StringVarP(&vpcOutput, "output", "o", out.FormatTable, "output format - table, json, yaml")
+	vpcCmd.AddCommand(vpcListCmd)
+	vpcCmd.AddCommand(vpcShowCmd)
+	vpcCleanupCmd.Flags().BoolVar(&vpcCleanupDryRun, "dry-run", false, "print orphaned VPCs without deleting them")
+	vpcCmd.AddCommand(vpcCleanupCmd)
+	Root.AddCommand(vpcCmd)
+}
+
+// vpcDetails is VPC with its VPC endpoints, endpoints are not part of the VPC, because they are not cached
+type vpcDetails struct {
+	vpc.Vpc
+	Endpoints []vpc.VpcEndpoint
+}
+
+func runVpcList(cmd *cobra.Command, _ []string) {
+	if err := out.ValidateFormat(vpcOutput); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	logger := NewLogger()
+	client := NewClient(logger)
+
+	vpcs, err := client.GetVpcs()
+	if err != nil {
+		exitWithError(fmt.Errorf("list vpcs: %w", err))
+	}
+	if vpcOutput != out.FormatTable {
+		printOutput(vpcs)
+		return
+	}
+
+	table := out.NewTable(logger, os.Stdout)
+	table.AddRow("ID", "NAME", "CIDR", "IPV6 CIDR", "SUBNETS", "PUBLIC", "DEFAULT")
+	for _, v := range vpcs {
+		table.AddRow(
+			v.Id,
+			v.Name,
+			v.CidrBlock,
+			strings.Join(v.Ipv6CidrBlocks, ", "),
+			strconv.Itoa(len(v.Subnets)),
+			yesNo(v.HasPublicSubnet(false)),
+			yesNo(v.IsDefault),
+		)
+	}
+	table.Print()
+}
+
+func runVpcShow(cmd *cobra.Command, args []string) {
+	if err := out.ValidateFormat(vpcOutput); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	logger := NewLogger()
+	client := NewClient(logger)
+
+	v, err := client.GetVpc(args[0])
+	if err != nil {
+		exitWithError(fmt.Errorf("show vpc: %w", err))
+	}
+	endpoints, err := client.GetVpcEndpoints(v.Id)
+	if err != nil {
+		exitWithError(fmt.Errorf("show vpc: %w", err))
+	}
+	if vpcOutput != out.FormatTable {
+		printOutput(vpcDetails{Vpc: v, Endpoints: endpoints})
+		return
+	}
+
+	fmt.Printf("VPC:  %s %s\n", v.Id, v.Name)
+	fmt.Printf("CIDR: %s\n\n", strings.Join(append([]string{v.CidrBlock}, v.Ipv6CidrBlocks...), ", "))
+	printSubnets(logger, v.Subnets)
+	fmt.Println()
+	printRouteTables(logger, v.Subnets)
+	fmt.Println()
+	printVpcEndpoints(logger, endpoints)
+}
+
+func runVpcCleanup(_ *cobra.Command, _ []string) {
+	logger := NewLogger()
+	client := NewClient(logger)
+	invalidateCompletions(logger)
+
+	vpcs, err := client.ListOrphanedVpcs()
+	if err != nil {
+		exitWithError(fmt.Errorf("list orphaned vpcs: %w", err))
+	}
+	if len(vpcs) == 0 {
+		fmt.Println("no orphaned vpcs")
+		return
+	}
+
+	var details []string
+	for _, v := range vpcs {
+		details = append(details, fmt.Sprintf("%s %s %s", v.Id, v.CidrBlock, v.Name))
+	}
+	if vpcCleanupDryRun {
+		fmt.Println(strings.Join(details, "\n"))
+		return
+	}
+	if !prompt.PromptDetails(fmt.Sprintf("delete %d orphaned VPCs in %s region", len(vpcs), client.Region), strings.Join(details, "\n")) {
+		return
+	}
+	if err := client.DeleteOrphanedVpcs(vpcs); err != nil {
+		exitWithError(fmt.Errorf("delete orphaned vpcs: %w", err))
+	}
+	fmt.Printf("deleted %d vpcs\n", len(vpcs))
+}
+
+func printSubnets(logger *slog.Logger, subnets []vpc.Subnet) {
+	table := out.NewTable(logger, os.Stdout)
+	table.AddRow("SUBNET", "NAME", "AZ", "CIDR", "FREE IPS", "TYPE", "ROUTE TABLE")
+	for _, subnet := range subnets {
+		table.AddRow(
+			subnet.Id,
+			subnet.Name,
+			subnet.AvailabilityZone,
+			strings.Join(subnet.CidrBlocks(), ", "),
+			strconv.Itoa(subnet.AvailableIpAddressCount),
+			subnetType(subnet),
+			subnet.RouteTable.Id,
+		)
+	}
+	table.Print()
+}
+
+// printRouteTables prints routes of route tables used by the subnets, every route table is printed once
+func printRouteTables(logger *slog.Logger, subnets []vpc.Subnet) {
+	printed := make(map[string]bool)
+	table := out.NewTable(logger, os.Stdout)
+	table.AddRow("ROUTE TABLE", "MAIN", "DESTINATION TYPE", "DESTINATION", "TARGET TYPE", "TARGET", "STATE")
+	for _, subnet := range subnets {
+		rtb := subnet.RouteTable
+		if rtb.Id == "" || printed[rtb.Id] {
+			continue
+		}
+		printed[rtb.Id] = true
+		for _, route := range rtb.Routes {
+			table.AddRow(rtb.Id, yesNo(rtb.Main), orDash(route.DestinationType), orDash(route.Destination()), orDash(route.TargetType),
+				orDash(route.TargetId), route.State)
+		}
+	}
+	table.Print()
+}
+
+func printVpcEndpoints(logger *slog.Logger, endpoints []vpc.VpcEndpoint) {
+	table := out.NewTable(logger, os.Stdout)
+	table.AddRow("ENDPOINT", "SERVICE", "TYPE", "STATE", "PRIVATE DNS")
+	for _, endpoint := range endpoints {
+		table.AddRow(endpoint.Id, endpoint.ServiceName, endpoint.Type, endpoint.State, yesNo(endpoint.PrivateDnsEnabled))
+	}
+	table.Print()
+}
+
+// subnetType returns public (IPv4 or IPv6 for IPv6-only subnet), public-ipv6 (dual-stack subnet with only IPv6 route
+// to internet gateway) or private and IPv6 classification of the subnet
+func subnetType(subnet vpc.Subnet) string {
+	out := "private"
+	if subnet.IsPublic(false) {
+		out = "public"
+	} else if subnet.IsPublicIpv6() {
+		out = "public-ipv6"
+	}
+	if subnet.IsIpv6Only() {
+		return out + " ipv6-only"
+	}
+	if subnet.HasIpv6() {
+		return out + " dual-stack"
+	}
+	return out
+}
+
+func printOutput(v any) {
+	if err := out.Print(os.Stdout, vpcOutput, v); err != nil {
+		exitWithError(err)
+	}
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
+
+// orDash returns "-" for empty value, so empty cells do not shift table columns
+func orDash(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
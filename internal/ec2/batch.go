@@ -0,0 +1,308 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/aws/vpc"
+	"sort"
+	"sync"
+	"time"
+)
+
+type CreateResult struct {
+	Name     string
+	Subnet   vpc.Subnet
+	Instance aws.Instance
+	Err      error
+}
+
+type CreateResults []CreateResult
+
+// Failed returns number of instances that failed to launch or did not become ready
+func (c CreateResults) Failed() int {
+	var out int
+	for _, result := range c {
+		if result.Err != nil {
+			out++
+		}
+	}
+	return out
+}
+
+// batchResourcesSuffix is added to the batch name to name security group and instance profile shared by the batch
+// instances, so they do not collide with resources of single instance with the same name
+const batchResourcesSuffix = ".batch"
+
+// BatchResourcesName returns name of security group and instance profile (without prefix) shared by the batch
+// instances
+func BatchResourcesName(name string) string {
+	return name + batchResourcesSuffix
+}
+
+// BatchNames returns names of instances created by CreateBatch
+func BatchNames(name string, count int) []string {
+	var out []string
+	for i := 1; i <= count; i++ {
+		out = append(out, fmt.Sprintf("%s-%d", name, i))
+	}
+	return out
+}
+
+// SpreadSubnets returns supplied subnet and other subnets from the same VPC with the same public/private and IPv6
+// classification, one per availability zone, so instances created in batch can be spread across AZs
+func (c Client) SpreadSubnets(subnet vpc.Subnet) ([]vpc.Subnet, error) {
+	vpcs, err := c.GetVpcs()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []vpc.Subnet{subnet}
+	azs := map[string]bool{subnet.AvailabilityZone: true}
+	for _, v := range vpcs {
+		if v.Id != subnet.VpcId {
+			continue
+		}
+		subnets := v.Subnets
+		sort.Slice(subnets, func(i, j int) bool {
+			return subnets[i].AvailabilityZone < subnets[j].AvailabilityZone
+		})
+		for _, s := range subnets {
+			if azs[s.AvailabilityZone] || s.IsPublicIpv4() != subnet.IsPublicIpv4() || s.IsPublicIpv6() != subnet.IsPublicIpv6() {
+				continue
+			}
+			if s.HasIpv6() != subnet.HasIpv6() || s.IsIpv6Only() != subnet.IsIpv6Only() {
+				continue
+			}
+			azs[s.AvailabilityZone] = true
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// CreateBatch creates count instances named <name>-1 to <name>-<count> in parallel (limited by concurrency),
+// instances are distributed across supplied subnets and share one security group and instance profile. If none of
+// the instances is launched, shared resources are rolled back
+func (c Client) CreateBatch(name string, count, concurrency int, subnets []vpc.Subnet, opts CreateOptions) (CreateResults, error) {
+	if count < 1 || (len(subnets) == 0 && !opts.NewVpc) {
+		return nil, fmt.Errorf("at least one instance and subnet is required")
+	}
+	defer c.cache.Delete(c.cacheKey("instances"))
+
+	results, err := c.createBatch(name, count, concurrency, subnets, opts)
+	// shared resources are reported under the batch name
+	c.reportResult(GetMetadataInput(name).Name, "shared resources created", err)
+	return results, err
+}
+
+func (c Client) createBatch(name string, count, concurrency int, subnets []vpc.Subnet, opts CreateOptions) (CreateResults, error) {
+	if err := c.checkInstancesNotExist(BatchNames(name, count)); err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string)
+	if opts.NewVpc {
+		subnet, err := c.createNetwork(name, opts.NewVpcCidr)
+		if err != nil {
+			return nil, err
+		}
+		subnets = []vpc.Subnet{subnet}
+		tags[aws.ManagedVpcTagKey] = subnet.VpcId
+	}
+	var endpoints vpc.InterfaceEndpoints
+	if opts.SsmEndpoints {
+		var err error
+		if endpoints, err = c.createSSMEndpoints(name, subnets); err != nil {
+			if opts.NewVpc {
+				c.deleteNetwork(subnets[0].VpcId)
+			}
+			return nil, err
+		}
+		tags[aws.SsmEndpointsTagKey] = GetMetadataInput(ssmEndpointsName).Name
+	}
+
+	config := NewConfig(BatchResourcesName(name), c.awsClient.AccountId, c.awsClient.Region)
+	profile := config.GetInstanceProfileInput()
+	securityGroupId, err := c.createInstanceResources(config, subnets[0].VpcId)
+	if err != nil {
+		c.deleteSSMEndpoints(endpoints)
+		if opts.NewVpc {
+			c.deleteNetwork(subnets[0].VpcId)
+		}
+		return nil, err
+	}
+
+	results := make(CreateResults, count)
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	var launched int
+	var mu sync.Mutex
+	for i, instanceName := range BatchNames(name, count) {
+		subnet := subnets[i%len(subnets)]
+		results[i] = CreateResult{Name: instanceName, Subnet: subnet}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			input := aws.RunInstancesInput{
+				Metadata:        GetMetadataInput(instanceName),
+				Subnet:          subnet,
+				InstanceType:    defaultInstanceType,
+				ImageId:         opts.ImageId,
+				InstanceProfile: profile,
+				SecurityGroupId: securityGroupId,
+				Ipv6:            opts.Ipv6,
+				Tags:            tags,
+				LaunchTemplate:  opts.LaunchTemplate,
+			}
+			defer func() { c.reportResult(input.Metadata.Name, "ready", results[i].Err) }()
+			instance, err := c.launchInstance(input)
+			if err != nil {
+				results[i].Err = err
+				return
+			}
+			mu.Lock()
+			launched++
+			mu.Unlock()
+
+			results[i].Instance = instance
+			if instance, err = c.waitForReady(input.Metadata.Name, instance, subnet); err != nil {
+				results[i].Err = err
+				return
+			}
+			results[i].Instance = instance
+			if opts.Eip {
+				if instance, err = c.attachNewElasticIp(instance); err != nil {
+					results[i].Err = err
+					return
+				}
+				results[i].Instance = instance
+			}
+		}()
+	}
+	wg.Wait()
+
+	if launched == 0 {
+		c.logger.Warn("no instance launched, rolling back security group and instance profile")
+		if err := c.deleteInstanceResources(securityGroupId, profile.Name); err != nil {
+			c.logger.Error(fmt.Sprintf("roll back: %v", err))
+		}
+		c.deleteSSMEndpoints(endpoints)
+		if opts.NewVpc {
+			c.deleteNetwork(subnets[0].VpcId)
+		}
+	}
+	return results, nil
+}
+
+// checkInstancesNotExist returns error if any of the instances already exists, so no shared resources are created
+func (c Client) checkInstancesNotExist(names []string) error {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*10)
+	defer cancel()
+
+	var metadata []aws.MetadataInput
+	for _, name := range names {
+		metadata = append(metadata, GetMetadataInput(name))
+	}
+	return c.awsClient.CheckInstancesNotExist(ctx, metadata)
+}
+
+func (c Client) createInstanceResources(config Config, vpcId string) (string, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*30)
+	defer cancel()
+	return c.awsClient.CreateInstanceResources(ctx, config.meta, vpcId, config.GetInstanceProfileInput())
+}
+
+func (c Client) deleteInstanceResources(securityGroupId, instanceProfile string) error {
+	ctx, cancel := context.WithTimeout(c.cleanupContext(), time.Second*30)
+	defer cancel()
+	return c.awsClient.DeleteInstanceResources(ctx, securityGroupId, instanceProfile)
+}
+
+func (c Client) launchInstance(input aws.RunInstancesInput) (aws.Instance, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*30)
+	defer cancel()
+	return c.awsClient.LaunchInstance(ctx, input)
+}
+
+type DeleteResult struct {
+	Instance aws.Instance
+	Err      error
+}
+
+type DeleteResults []DeleteResult
+
+// Failed returns number of instances that failed to terminate
+func (d DeleteResults) Failed() int {
+	var out int
+	for _, result := range d {
+		if result.Err != nil {
+			out++
+		}
+	}
+	return out
+}
+
+// DeleteBatch terminates instances in parallel (limited by concurrency) and once they are terminated, deletes their
+// security groups and instance profiles. Error is returned if the clean-up of the shared resources failed
+func (c Client) DeleteBatch(instances aws.Instances, concurrency int) (DeleteResults, error) {
+	defer c.cache.Delete(c.cacheKey("instances"))
+	for _, instance := range instances {
+		if instance.ManagedVpcId() != "" {
+			defer c.cache.Delete(c.cacheKey("vpcs"))
+			break
+		}
+	}
+
+	results := make(DeleteResults, len(instances))
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, instance := range instances {
+		results[i] = DeleteResult{Instance: instance}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			terminated, err := c.terminateInstanceAndWait(instance)
+			c.reportResult(instance.Name, "terminated", err)
+			if err != nil {
+				results[i].Err = err
+				return
+			}
+			results[i].Instance = terminated
+		}()
+	}
+	wg.Wait()
+
+	var terminated aws.Instances
+	for _, result := range results {
+		if result.Err == nil {
+			terminated = append(terminated, result.Instance)
+		}
+	}
+	err := c.deleteInstancesResources(terminated)
+	c.reportResult("", "resources deleted", err)
+	return results, err
+}
+
+func (c Client) terminateInstanceAndWait(instance aws.Instance) (aws.Instance, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*300)
+	defer cancel()
+	return c.awsClient.TerminateInstanceAndWait(ctx, instance)
+}
+
+func (c Client) deleteInstancesResources(instances aws.Instances) error {
+	if len(instances) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*300)
+	defer cancel()
+	return c.awsClient.DeleteInstancesResources(ctx, instances)
+}
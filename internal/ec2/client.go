@@ -2,10 +2,14 @@ package ec2
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/pete911/ec2/internal/aws"
 	"github.com/pete911/ec2/internal/aws/vpc"
+	"github.com/pete911/ec2/internal/cache"
+	"github.com/pete911/ec2/internal/progress"
 	"log/slog"
+	"strings"
 	"time"
 )
 
@@ -13,88 +17,385 @@ type Client struct {
 	Region    string
 	logger    *slog.Logger
 	awsClient aws.Client
+	cache     cache.Cache
+	reporter  progress.Reporter
+	// ctx is parent of the operation contexts, background context is used if it is not set
+	ctx context.Context
 }
 
-func NewClient(logger *slog.Logger, awsClient aws.Client) Client {
+func NewClient(logger *slog.Logger, awsClient aws.Client, cache cache.Cache) Client {
 	return Client{
 		Region:    awsClient.Region,
 		logger:    logger.With("component", "ec2.client"),
 		awsClient: awsClient,
+		cache:     cache,
+	}
+}
+
+// WithReporter returns client that reports create and delete progress events (resource created, instance state
+// changed, status check passed) to the reporter
+func (c Client) WithReporter(reporter progress.Reporter) Client {
+	c.reporter = reporter
+	c.awsClient = c.awsClient.WithReporter(reporter)
+	return c
+}
+
+// WithContext returns client that derives operation contexts from the supplied context, so operations are canceled
+// with it
+func (c Client) WithContext(ctx context.Context) Client {
+	c.ctx = ctx
+	return c
+}
+
+func (c Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// cleanupContext is used by roll back and clean-up, they have to finish even if the client context is canceled
+func (c Client) cleanupContext() context.Context {
+	return context.WithoutCancel(c.context())
+}
+
+// sleep waits for the duration, or returns error if the client context is canceled
+func (c Client) sleep(d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-c.context().Done():
+		return c.context().Err()
 	}
 }
 
 func (c Client) GetVpcs() ([]vpc.Vpc, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*300)
+	var vpcs []vpc.Vpc
+	if c.cache.Get(c.cacheKey("vpcs"), &vpcs) {
+		return vpcs, nil
+	}
+
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*300)
 	defer cancel()
 
-	return c.awsClient.GetVpcs(ctx)
+	vpcs, err := c.awsClient.GetVpcs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.Set(c.cacheKey("vpcs"), vpcs)
+	return vpcs, nil
 }
 
 func (c Client) Delete(instance aws.Instance) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*300)
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*300)
 	defer cancel()
 
-	return c.awsClient.TerminateInstance(ctx, instance)
+	defer c.cache.Delete(c.cacheKey("instances"))
+	if instance.ManagedVpcId() != "" {
+		defer c.cache.Delete(c.cacheKey("vpcs"))
+	}
+	terminated, err := c.awsClient.TerminateInstanceAndWait(ctx, instance)
+	c.reportResult(instance.Name, "terminated", err)
+	if err != nil {
+		return err
+	}
+	err = c.awsClient.DeleteInstancesResources(ctx, aws.Instances{terminated})
+	c.reportResult("", "resources deleted", err)
+	return err
 }
 
+// List returns instances from AWS, commands act on the instances, so the cache is not used. Cache is refreshed for
+// ListCached
 func (c Client) List() (aws.Instances, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*5)
 	defer cancel()
 
 	// we don't care about name in the tags (it will be stripped anyway), so providing just empty string to get tags
-	return c.awsClient.DescribeInstancesByNamePrefix(ctx, NamePrefix, GetMetadataInput("").Tags)
+	instances, err := c.awsClient.DescribeInstancesByNamePrefix(ctx, NamePrefix, GetMetadataInput("").Tags)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.Set(c.cacheKey("instances"), instances)
+	return instances, nil
+}
+
+// ListCached returns cached instances, or instances from AWS if they are not cached. Instances can be stale, so it is
+// used only for suggestions (shell completion)
+func (c Client) ListCached() (aws.Instances, error) {
+	var instances aws.Instances
+	if c.cache.Get(c.cacheKey("instances"), &instances) {
+		return instances, nil
+	}
+	return c.List()
+}
+
+// cacheKey returns cache key scoped to account and region
+func (c Client) cacheKey(name string) string {
+	return fmt.Sprintf("%s-%s-%s", c.awsClient.AccountId, c.Region, name)
+}
+
+func (c Client) Create(name string, subnet vpc.Subnet, opts CreateOptions) (aws.Instance, error) {
+	if strings.HasSuffix(name, batchResourcesSuffix) {
+		return aws.Instance{}, fmt.Errorf("instance name cannot end with %s, it is used by batch resources", batchResourcesSuffix)
+	}
+	defer c.cache.Delete(c.cacheKey("instances"))
+
+	instance, err := c.create(name, subnet, opts)
+	c.reportResult(GetMetadataInput(name).Name, "ready", err)
+	return instance, err
 }
 
-func (c Client) Create(name string, subnet vpc.Subnet) (aws.Instance, error) {
+func (c Client) create(name string, subnet vpc.Subnet, opts CreateOptions) (aws.Instance, error) {
+	tags := make(map[string]string)
+	if opts.NewVpc {
+		var err error
+		if subnet, err = c.createNetwork(name, opts.NewVpcCidr); err != nil {
+			return aws.Instance{}, err
+		}
+		tags[aws.ManagedVpcTagKey] = subnet.VpcId
+	}
+	var endpoints vpc.InterfaceEndpoints
+	if opts.SsmEndpoints {
+		var err error
+		if endpoints, err = c.createSSMEndpoints(name, []vpc.Subnet{subnet}); err != nil {
+			if opts.NewVpc {
+				c.deleteNetwork(subnet.VpcId)
+			}
+			return aws.Instance{}, err
+		}
+		tags[aws.SsmEndpointsTagKey] = GetMetadataInput(ssmEndpointsName).Name
+	}
+
 	// TODO - add option to supply custom user data
-	instance, err := c.runInstance(name, subnet, "")
+	instance, err := c.runInstance(name, subnet, "", opts, tags)
 	if err != nil {
+		c.deleteSSMEndpoints(endpoints)
+		if opts.NewVpc {
+			c.deleteNetwork(subnet.VpcId)
+		}
+		return aws.Instance{}, err
+	}
+	if instance, err = c.waitForReady(GetMetadataInput(name).Name, instance, subnet); err != nil || !opts.Eip {
+		return instance, err
+	}
+	return c.attachNewElasticIp(instance)
+}
+
+// waitForReady waits for instance to pass status checks and returns fresh instance with public IP and dns set, name
+// is instance name used in progress events
+func (c Client) waitForReady(name string, instance aws.Instance, subnet vpc.Subnet) (aws.Instance, error) {
+	c.logger.Debug(fmt.Sprintf("starting instance %s in subnet %s AZ %s", instance.Id, subnet.Id, subnet.AvailabilityZone))
+	c.report(progress.Info, name, instance.Id, fmt.Sprintf("initializing in %s (%s)", subnet.Id, subnet.AvailabilityZone))
+	if err := c.sleep(60 * time.Second); err != nil {
 		return aws.Instance{}, err
 	}
-	c.logger.Info(fmt.Sprintf("starting instance %s in subnet %s AZ %s", instance.Id, subnet.Id, subnet.AvailabilityZone))
-	c.logger.Info("waiting 60 seconds for instance to initialize")
-	time.Sleep(60 * time.Second)
 
 	// wait for instance to start
+	var last aws.InstanceStatus
 	for x := 0; x < 30; x++ {
-		time.Sleep(15 * time.Second)
+		if err := c.sleep(15 * time.Second); err != nil {
+			return aws.Instance{}, err
+		}
 		status, err := c.describeInstanceStatus(instance.Id)
 		if err != nil {
 			return aws.Instance{}, err
 		}
 
-		c.logger.Info(fmt.Sprintf("instance %s - %s", instance.Id, status))
+		c.logger.Debug(fmt.Sprintf("instance %s - %s", instance.Id, status))
+		if status.InstanceState != last.InstanceState {
+			c.report(progress.State, name, instance.Id, status.InstanceState)
+		}
+		if status.SystemStatus == "ok" && last.SystemStatus != "ok" {
+			c.report(progress.Check, name, instance.Id, "system status check passed")
+		}
+		if status.InstanceStatus == "ok" && last.InstanceStatus != "ok" {
+			c.report(progress.Check, name, instance.Id, "instance status check passed")
+		}
+		last = status
 		if status.IsReady() {
 			// get fresh initialized instance with public IP and dns set
 			return c.describeInstanceById(instance.Id)
 		}
-		c.logger.Info("retry in 15 seconds")
+		c.logger.Debug("retry in 15 seconds")
 	}
-	return aws.Instance{}, fmt.Errorf("instance %s not ready", instance.Id)
+	return aws.Instance{}, c.newNotReadyError(instance.Id)
 }
 
 func (c Client) describeInstanceStatus(id string) (aws.InstanceStatus, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*5)
 	defer cancel()
 	return c.awsClient.DescribeInstanceStatus(ctx, id)
 }
 
 func (c Client) describeInstanceById(id string) (aws.Instance, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*5)
 	defer cancel()
 	return c.awsClient.DescribeInstanceById(ctx, id)
 }
 
-func (c Client) runInstance(name string, subnet vpc.Subnet, userData string) (aws.Instance, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+func (c Client) runInstance(name string, subnet vpc.Subnet, userData string, opts CreateOptions, tags map[string]string) (aws.Instance, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*30)
 	defer cancel()
 
+	return c.awsClient.RunInstance(ctx, c.runInstancesInput(name, subnet, userData, opts, tags))
+}
+
+func (c Client) runInstancesInput(name string, subnet vpc.Subnet, userData string, opts CreateOptions, tags map[string]string) aws.RunInstancesInput {
 	config := NewConfig(name, c.awsClient.AccountId, c.awsClient.Region)
-	input := aws.RunInstancesInput{
+	return aws.RunInstancesInput{
 		Metadata:        config.meta,
 		Subnet:          subnet,
+		InstanceType:    defaultInstanceType,
+		ImageId:         opts.ImageId,
 		UserData:        userData,
 		InstanceProfile: config.GetInstanceProfileInput(),
+		Ipv6:            opts.Ipv6,
+		Tags:            tags,
+		LaunchTemplate:  opts.LaunchTemplate,
+	}
+}
+
+// createNetwork creates VPC with public subnet for the instance(s), VPC uses cidr or the default CIDR block if empty
+func (c Client) createNetwork(name, cidr string) (vpc.Subnet, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*300)
+	defer cancel()
+
+	defer c.cache.Delete(c.cacheKey("vpcs"))
+	c.logger.Debug(fmt.Sprintf("creating new vpc for %s", name))
+	metadata := GetMetadataInput(name)
+	subnet, err := c.awsClient.CreateNetwork(ctx, metadata, cidr)
+	if err != nil {
+		return vpc.Subnet{}, err
+	}
+	progress.Report(c.reporter, progress.Event{Type: progress.Created, Instance: metadata.Name, Resource: "vpc", Id: subnet.VpcId, Message: "created"})
+	return subnet, nil
+}
+
+// createSSMEndpoints creates SSM endpoints in the subnets VPC, endpoints accept HTTPS from the whole VPC. Name is
+// instance (or batch) name used in progress events. Returned resources created by this call are rolled back with
+// deleteSSMEndpoints, if no instance is launched. Partially created resources are rolled back on error
+func (c Client) createSSMEndpoints(name string, subnets []vpc.Subnet) (vpc.InterfaceEndpoints, error) {
+	v, err := c.GetVpc(subnets[0].VpcId)
+	if err != nil {
+		return vpc.InterfaceEndpoints{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*60)
+	defer cancel()
+
+	cidrBlocks := append([]string{v.CidrBlock}, v.Ipv6CidrBlocks...)
+	endpoints, err := c.awsClient.CreateSSMEndpoints(ctx, GetMetadataInput(ssmEndpointsName), subnets, cidrBlocks, ssmEndpointServices)
+	if err != nil {
+		c.deleteSSMEndpoints(endpoints)
+		return vpc.InterfaceEndpoints{}, err
+	}
+	progress.Report(c.reporter, progress.Event{Type: progress.Created, Instance: GetMetadataInput(name).Name, Resource: "vpc endpoints", Id: v.Id, Message: "created or reused"})
+	return endpoints, nil
+}
+
+// deleteSSMEndpoints deletes endpoints created by createSSMEndpoints, it is used to roll back, when no instance has
+// been launched. Reused endpoints are kept
+func (c Client) deleteSSMEndpoints(endpoints vpc.InterfaceEndpoints) {
+	if endpoints.IsEmpty() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.cleanupContext(), time.Second*360)
+	defer cancel()
+
+	c.logger.Warn(fmt.Sprintf("no instance launched, deleting ssm endpoints created in %s vpc", endpoints.VpcId))
+	if err := c.awsClient.DeleteCreatedSSMEndpoints(ctx, GetMetadataInput(ssmEndpointsName), endpoints); err != nil {
+		c.logger.Error(fmt.Sprintf("roll back: %v", err))
+	}
+}
+
+// report reports instance progress event
+func (c Client) report(eventType progress.Type, name, instanceId, message string) {
+	progress.Report(c.reporter, progress.Event{Type: eventType, Instance: name, Resource: "instance", Id: instanceId, Message: message})
+}
+
+// reportResult reports done or failed event, name is empty for resources shared by instances. Instance that is
+// ready without elastic IP is reported as done with the error message
+func (c Client) reportResult(name, message string, err error) {
+	var eipErr *ElasticIpError
+	if errors.As(err, &eipErr) {
+		progress.Report(c.reporter, progress.Event{Type: progress.Done, Instance: name, Message: fmt.Sprintf("%s, elastic ip not attached: %v", message, eipErr.Err)})
+		return
+	}
+	if err != nil {
+		progress.Report(c.reporter, progress.Event{Type: progress.Failed, Instance: name, Message: err.Error()})
+		return
+	}
+	progress.Report(c.reporter, progress.Event{Type: progress.Done, Instance: name, Message: message})
+}
+
+// deleteNetwork deletes VPC created by createNetwork, it is used to roll back, when no instance has been launched
+func (c Client) deleteNetwork(vpcId string) {
+	ctx, cancel := context.WithTimeout(c.cleanupContext(), time.Second*300)
+	defer cancel()
+
+	defer c.cache.Delete(c.cacheKey("vpcs"))
+	c.logger.Warn(fmt.Sprintf("no instance launched, deleting %s vpc", vpcId))
+	if err := c.awsClient.DeleteNetwork(ctx, vpcId); err != nil {
+		c.logger.Error(fmt.Sprintf("roll back: %v", err))
+	}
+}
+
+// ListOrphanedVpcs returns VPCs created for instances (--new-vpc) that are not used by any instance anymore
+func (c Client) ListOrphanedVpcs() ([]vpc.Vpc, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*30)
+	defer cancel()
+
+	return c.awsClient.DescribeOrphanedNetworks(ctx, GetMetadataInput(""))
+}
+
+// DeleteOrphanedVpcs deletes VPCs returned by ListOrphanedVpcs with all their resources, VPC that is used by instance
+// again is not deleted
+func (c Client) DeleteOrphanedVpcs(vpcs []vpc.Vpc) error {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*300)
+	defer cancel()
+
+	defer c.cache.Delete(c.cacheKey("vpcs"))
+	var errList []error
+	for _, v := range vpcs {
+		if err := c.awsClient.DeleteOrphanedNetwork(ctx, v.Id); err != nil {
+			errList = append(errList, err)
+		}
 	}
-	return c.awsClient.RunInstance(ctx, input)
+	return errors.Join(errList...)
+}
+
+// GetSubnet returns subnet by id
+func (c Client) GetSubnet(id string) (vpc.Subnet, error) {
+	vpcs, err := c.GetVpcs()
+	if err != nil {
+		return vpc.Subnet{}, err
+	}
+	for _, v := range vpcs {
+		for _, subnet := range v.Subnets {
+			if subnet.Id == id {
+				return subnet, nil
+			}
+		}
+	}
+	return vpc.Subnet{}, fmt.Errorf("subnet %s %w", id, ErrNotFound)
+}
+
+// GetVpc returns VPC with subnets and route tables
+func (c Client) GetVpc(id string) (vpc.Vpc, error) {
+	vpcs, err := c.GetVpcs()
+	if err != nil {
+		return vpc.Vpc{}, err
+	}
+	for _, v := range vpcs {
+		if v.Id == id {
+			return v, nil
+		}
+	}
+	return vpc.Vpc{}, fmt.Errorf("vpc %s not found", id)
+}
+
+func (c Client) GetVpcEndpoints(vpcId string) ([]vpc.VpcEndpoint, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*10)
+	defer cancel()
+	return c.awsClient.GetVpcEndpoints(ctx, vpcId)
 }
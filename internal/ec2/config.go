@@ -6,7 +6,37 @@ import (
 	"github.com/pete911/ec2/internal/aws/iam"
 )
 
-const NamePrefix = "ec2-"
+const (
+	NamePrefix          = "ec2-"
+	defaultInstanceType = "t3.micro"
+	// ssmEndpointsName is name of the SSM endpoints and their security group, shared by all instances in the VPC
+	ssmEndpointsName = "ssm-endpoints"
+)
+
+// defaultRootVolume is root volume of the al2023 AMI, used only to estimate cost
+var defaultRootVolume = aws.Volume{Size: 8, VolumeType: "gp3"}
+
+// CreateOptions are optional settings of created instances
+type CreateOptions struct {
+	// Ipv6 assigns IPv6 address to instances, subnet has to have IPv6 CIDR block
+	Ipv6 bool
+	// NewVpc creates new VPC with one public subnet for the instances, supplied subnet is ignored. VPC is deleted
+	// together with its last instance
+	NewVpc bool
+	// NewVpcCidr is CIDR block of the new VPC (vpc.DefaultNetworkCidr if empty), subnet is the first /24 of it
+	NewVpcCidr string
+	// SsmEndpoints creates (or reuses) SSM interface endpoints in the VPC, so instances are reachable by SSM without
+	// internet access. Endpoints are deleted with the last instance that uses them
+	SsmEndpoints bool
+	// ImageId is image used to launch instances (e.g. image created by CreateImage), default al2023 image is used
+	// if it is not set
+	ImageId string
+	// Eip allocates and associates elastic IP with every instance, elastic IP is released with the instance
+	Eip bool
+	// LaunchTemplate launches instances from the template, security group, instance profile, tags and subnet are
+	// merged over it
+	LaunchTemplate aws.LaunchTemplate
+}
 
 type Config struct {
 	meta      aws.MetadataInput
@@ -0,0 +1,90 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// consoleTailLines is number of console output lines attached to NotReadyError
+const consoleTailLines = 30
+
+// NotReadyError is returned when instance does not pass status checks, it contains last lines of the console output
+type NotReadyError struct {
+	InstanceId  string
+	ConsoleTail string
+}
+
+func (e *NotReadyError) Error() string {
+	return fmt.Sprintf("instance %s not ready", e.InstanceId)
+}
+
+// ConsoleOutput returns latest serial console output of the instance
+func (c Client) ConsoleOutput(instanceId string) (string, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*10)
+	defer cancel()
+	return c.awsClient.GetConsoleOutput(ctx, instanceId)
+}
+
+// Screenshot returns JPG screenshot of the instance console
+func (c Client) Screenshot(instanceId string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*30)
+	defer cancel()
+	return c.awsClient.GetConsoleScreenshot(ctx, instanceId)
+}
+
+// newNotReadyError returns error with console output tail, failure to get console output is only logged
+func (c Client) newNotReadyError(instanceId string) error {
+	err := &NotReadyError{InstanceId: instanceId}
+	output, consoleErr := c.ConsoleOutput(instanceId)
+	if consoleErr != nil {
+		c.logger.Error(fmt.Sprintf("get %s console output: %v", instanceId, consoleErr))
+		return err
+	}
+	err.ConsoleTail = Tail(output, consoleTailLines)
+	return err
+}
+
+// Tail returns last n lines of the output
+func Tail(output string, n int) string {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// minConsoleOverlap is minimum number of bytes the previous and current console output have to share to be considered
+// continuous, shorter overlap (e.g. single new line) can match by chance
+const minConsoleOverlap = 32
+
+// NewConsoleOutput returns part of the current console output that was not in the previous output. Console output
+// is limited in size, so the beginning of the previous output can be missing in the current one, the outputs are
+// joined on the longest suffix of the previous output that is prefix of the current one. False is returned with the
+// whole current output if they do not overlap (e.g. more output was written between the calls than the console keeps)
+func NewConsoleOutput(previous, current string) (string, bool) {
+	overlap := longestOverlap(previous, current)
+	if overlap < min(len(previous), minConsoleOverlap) {
+		return current, false
+	}
+	return current[overlap:], true
+}
+
+// longestOverlap returns length of the longest suffix of a that is prefix of b, it uses KMP prefix function of
+// b + separator + a, so it runs in linear time even for the full console output
+func longestOverlap(a, b string) int {
+	s := b + "\x00" + a
+	pi := make([]int, len(s))
+	for i := 1; i < len(s); i++ {
+		k := pi[i-1]
+		for k > 0 && s[i] != s[k] {
+			k = pi[k-1]
+		}
+		if s[i] == s[k] {
+			k++
+		}
+		pi[i] = k
+	}
+	return min(pi[len(s)-1], len(a), len(b))
+}
@@ -0,0 +1,34 @@
+package ec2
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewConsoleOutput(t *testing.T) {
+	boot := "[    0.000000] Linux version 6.1.0 (builder@localhost)\n[    0.100000] Command line: console=ttyS0\n"
+	tests := []struct {
+		name       string
+		previous   string
+		current    string
+		expected   string
+		continuous bool
+	}{
+		{name: "first output", previous: "", current: boot, expected: boot, continuous: true},
+		{name: "no new output", previous: boot, current: boot, expected: "", continuous: true},
+		{name: "appended", previous: boot, current: boot + "login:\n", expected: "login:\n", continuous: true},
+		{name: "partial line continued", previous: boot + "log", current: boot + "login:\n", expected: "in:\n", continuous: true},
+		{name: "buffer wrapped", previous: boot, current: boot[20:] + "login:\n", expected: "login:\n", continuous: true},
+		{name: "repeated lines", previous: "a\na\na\n" + boot, current: boot + "a\na\n", expected: "a\na\n", continuous: true},
+		{name: "continuity lost", previous: boot, current: "cloud-init finished\n", expected: "cloud-init finished\n", continuous: false},
+		{name: "short overlap", previous: boot, current: "\n" + strings.Repeat("x", 10), expected: "\n" + strings.Repeat("x", 10), continuous: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, continuous := NewConsoleOutput(tt.previous, tt.current)
+			if actual != tt.expected || continuous != tt.continuous {
+				t.Errorf("expected %q %t, got %q %t", tt.expected, tt.continuous, actual, continuous)
+			}
+		})
+	}
+}
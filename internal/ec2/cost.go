@@ -0,0 +1,69 @@
+package ec2
+
+import (
+	"context"
+	"github.com/pete911/ec2/internal/aws"
+	"time"
+)
+
+type Cost struct {
+	Hourly float64
+	// Complete is false if price of the instance or any of its volumes is missing in the offline price table
+	Complete bool
+}
+
+func (c Cost) Monthly() float64 {
+	return aws.MonthlyPrice(c.Hourly)
+}
+
+// Accrued returns cost accrued since supplied time
+func (c Cost) Accrued(since time.Time) float64 {
+	return c.Hourly * time.Since(since).Hours()
+}
+
+// EstimateCost returns estimated cost of new instance, instance type of the launch template is used if it is set
+// (template volumes are not included)
+func (c Client) EstimateCost(opts CreateOptions) Cost {
+	if opts.LaunchTemplate.InstanceType != "" {
+		return c.cost(opts.LaunchTemplate.InstanceType, aws.Volumes{defaultRootVolume})
+	}
+	return c.cost(defaultInstanceType, aws.Volumes{defaultRootVolume})
+}
+
+// Costs returns cost of the supplied instances including EBS volumes, key is instance id
+func (c Client) Costs(instances aws.Instances) (map[string]Cost, error) {
+	var volumeIds []string
+	for _, instance := range instances {
+		volumeIds = append(volumeIds, instance.VolumeIds...)
+	}
+
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*5)
+	defer cancel()
+	volumes, err := c.awsClient.DescribeVolumes(ctx, volumeIds)
+	if err != nil {
+		return nil, err
+	}
+	volumesById := volumes.ById()
+
+	out := make(map[string]Cost)
+	for _, instance := range instances {
+		var instanceVolumes aws.Volumes
+		for _, id := range instance.VolumeIds {
+			instanceVolumes = append(instanceVolumes, volumesById[id])
+		}
+		out[instance.Id] = c.cost(instance.InstanceType, instanceVolumes)
+	}
+	return out, nil
+}
+
+func (c Client) cost(instanceType string, volumes aws.Volumes) Cost {
+	hourly, complete := aws.InstanceHourlyPrice(c.Region, instanceType)
+	for _, volume := range volumes {
+		price, ok := aws.VolumeHourlyPrice(c.Region, volume)
+		if !ok {
+			complete = false
+		}
+		hourly += price
+	}
+	return Cost{Hourly: hourly, Complete: complete}
+}
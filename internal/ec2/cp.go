@@ -0,0 +1,365 @@
+package ec2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/aws/iam"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// cpChunkSize is size of the raw chunk transferred in single SSM command. Base64 encoded chunk has to fit into
+	// send-command parameters (upload) and get-command-invocation output limit (download)
+	cpChunkSize      = 12000
+	cpCommandTimeout = 5 * time.Minute
+	cpS3Timeout      = time.Hour
+)
+
+// Progress is called with number of transferred bytes and total size of the file
+type Progress func(done, total int64)
+
+type CopyInput struct {
+	Instance   aws.Instance
+	LocalPath  string
+	RemotePath string
+	// Bucket is optional, if set, file is staged through temporary S3 object instead of SSM commands
+	Bucket   string
+	Progress Progress
+}
+
+// Upload copies local file to the instance and verifies sha256 checksum
+func (c Client) Upload(in CopyInput) error {
+	if in.Progress == nil {
+		in.Progress = func(int64, int64) {}
+	}
+	if strings.HasSuffix(in.RemotePath, "/") {
+		in.RemotePath = in.RemotePath + filepath.Base(in.LocalPath)
+	}
+
+	checksum, size, err := fileChecksum(in.LocalPath)
+	if err != nil {
+		return err
+	}
+
+	var remoteChecksum string
+	if in.Bucket != "" {
+		remoteChecksum, err = c.uploadS3(in, size)
+	} else {
+		remoteChecksum, err = c.uploadSSM(in, size)
+	}
+	if err != nil {
+		return err
+	}
+	if remoteChecksum != checksum {
+		return fmt.Errorf("checksum mismatch: local %s, remote %s", checksum, remoteChecksum)
+	}
+	c.logger.Info(fmt.Sprintf("uploaded %s to %s:%s, sha256 %s", in.LocalPath, in.Instance.Name, in.RemotePath, checksum))
+	return nil
+}
+
+// Download copies file from the instance to local path and verifies sha256 checksum
+func (c Client) Download(in CopyInput) error {
+	if in.Progress == nil {
+		in.Progress = func(int64, int64) {}
+	}
+	if info, err := os.Stat(in.LocalPath); err == nil && info.IsDir() {
+		in.LocalPath = filepath.Join(in.LocalPath, path.Base(in.RemotePath))
+	}
+
+	// download to temporary file first, so we don't leave partial file behind if the transfer fails
+	tmpPath := in.LocalPath + ".ec2-cp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", tmpPath, err)
+	}
+	defer os.Remove(tmpPath)
+
+	h := sha256.New()
+	w := io.MultiWriter(f, h)
+	var remoteChecksum string
+	if in.Bucket != "" {
+		remoteChecksum, err = c.downloadS3(in, w)
+	} else {
+		remoteChecksum, err = c.downloadSSM(in, w)
+	}
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("close %s: %w", tmpPath, closeErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	checksum := hex.EncodeToString(h.Sum(nil))
+	if remoteChecksum != checksum {
+		return fmt.Errorf("checksum mismatch: local %s, remote %s", checksum, remoteChecksum)
+	}
+	if err := os.Rename(tmpPath, in.LocalPath); err != nil {
+		return fmt.Errorf("rename %s: %w", tmpPath, err)
+	}
+	c.logger.Info(fmt.Sprintf("downloaded %s:%s to %s, sha256 %s", in.Instance.Name, in.RemotePath, in.LocalPath, checksum))
+	return nil
+}
+
+// uploadSSM sends file in base64 encoded chunks as SSM commands and returns remote checksum
+func (c Client) uploadSSM(in CopyInput, size int64) (string, error) {
+	f, err := os.Open(in.LocalPath)
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", in.LocalPath, err)
+	}
+	defer f.Close()
+
+	tmpPath := shellQuote(in.RemotePath + ".ec2-cp")
+	if _, err := c.runCommand(in.Instance, fmt.Sprintf(": > %s", tmpPath)); err != nil {
+		return "", err
+	}
+
+	var done int64
+	buf := make([]byte, cpChunkSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			chunk := base64.StdEncoding.EncodeToString(buf[:n])
+			if _, err := c.runCommand(in.Instance, fmt.Sprintf("echo '%s' | base64 -d >> %s", chunk, tmpPath)); err != nil {
+				return "", err
+			}
+			done += int64(n)
+			in.Progress(done, size)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("read %s: %w", in.LocalPath, err)
+		}
+	}
+
+	remotePath := shellQuote(in.RemotePath)
+	return c.remoteChecksum(in.Instance, fmt.Sprintf("mv %s %s && sha256sum %s", tmpPath, remotePath, remotePath))
+}
+
+// downloadSSM reads remote file in base64 encoded chunks as SSM commands and returns remote checksum
+func (c Client) downloadSSM(in CopyInput, w io.Writer) (string, error) {
+	remotePath := shellQuote(in.RemotePath)
+	out, err := c.runCommand(in.Instance, fmt.Sprintf("stat -c %%s %s", remotePath))
+	if err != nil {
+		return "", err
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("parse %s size: %w", in.RemotePath, err)
+	}
+
+	var done int64
+	for chunk := 0; done < size; chunk++ {
+		out, err := c.runCommand(in.Instance, fmt.Sprintf("dd if=%s bs=%d skip=%d count=1 2>/dev/null | base64 -w0", remotePath, cpChunkSize, chunk))
+		if err != nil {
+			return "", err
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(out))
+		if err != nil {
+			return "", fmt.Errorf("decode chunk %d: %w", chunk, err)
+		}
+		if len(b) == 0 {
+			return "", fmt.Errorf("%s changed during transfer, expected %d bytes, got %d", in.RemotePath, size, done)
+		}
+		if _, err := w.Write(b); err != nil {
+			return "", fmt.Errorf("write %s: %w", in.LocalPath, err)
+		}
+		done += int64(len(b))
+		in.Progress(done, size)
+	}
+	return c.remoteChecksum(in.Instance, fmt.Sprintf("sha256sum %s", remotePath))
+}
+
+// uploadS3 uploads file to temporary S3 object, grants the instance role read access to that object and copies it
+// to the instance with aws cli. Returns remote checksum
+func (c Client) uploadS3(in CopyInput, size int64) (string, error) {
+	f, err := os.Open(in.LocalPath)
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", in.LocalPath, err)
+	}
+	defer f.Close()
+
+	key := c.cpS3Key(in.Instance, filepath.Base(in.LocalPath))
+	ctx, cancel := context.WithTimeout(c.context(), cpS3Timeout)
+	defer cancel()
+	if err := c.awsClient.PutObject(ctx, in.Bucket, key, &progressReader{r: f, total: size, progress: in.Progress}, size); err != nil {
+		return "", err
+	}
+	defer c.deleteObject(in.Bucket, key)
+
+	var checksum string
+	err = c.withS3Access(in.Instance, in.Bucket, key, []string{"s3:GetObject"}, func() error {
+		remotePath := shellQuote(in.RemotePath)
+		cmd := fmt.Sprintf("aws s3 cp --only-show-errors --region %s s3://%s/%s %s && sha256sum %s", c.Region, in.Bucket, key, remotePath, remotePath)
+		checksum, err = c.remoteChecksum(in.Instance, cmd)
+		return err
+	})
+	return checksum, err
+}
+
+// downloadS3 grants the instance role write access to temporary S3 object, copies the file there with aws cli
+// and downloads it. Returns remote checksum
+func (c Client) downloadS3(in CopyInput, w io.Writer) (string, error) {
+	key := c.cpS3Key(in.Instance, path.Base(in.RemotePath))
+	defer c.deleteObject(in.Bucket, key)
+
+	var checksum string
+	err := c.withS3Access(in.Instance, in.Bucket, key, []string{"s3:PutObject"}, func() error {
+		remotePath := shellQuote(in.RemotePath)
+		cmd := fmt.Sprintf("sha256sum %s && aws s3 cp --only-show-errors --region %s %s s3://%s/%s", remotePath, c.Region, remotePath, in.Bucket, key)
+		var err error
+		checksum, err = c.remoteChecksum(in.Instance, cmd)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(c.context(), cpS3Timeout)
+	defer cancel()
+	size, err := c.awsClient.HeadObjectSize(ctx, in.Bucket, key)
+	if err != nil {
+		return "", err
+	}
+	if err := c.awsClient.GetObject(ctx, in.Bucket, key, &progressWriter{w: w, total: size, progress: in.Progress}); err != nil {
+		return "", err
+	}
+	return checksum, nil
+}
+
+// withS3Access adds inline policy to the instance role, scoped to the supplied S3 object, for the duration of fn
+func (c Client) withS3Access(instance aws.Instance, bucket, key string, actions []string, fn func() error) error {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*30)
+	defer cancel()
+
+	profile, err := c.awsClient.GetInstanceProfile(ctx, instance.InstanceProfile)
+	if err != nil {
+		return err
+	}
+	if len(profile.RoleNames) == 0 {
+		return fmt.Errorf("instance profile %s does not have any role", instance.InstanceProfile)
+	}
+	roleName := profile.RoleNames[0]
+	policy := iam.NewInlinePolicyInput(fmt.Sprintf("ec2-cp-%d", time.Now().Unix()), fmt.Sprintf("arn:%s:s3:::%s/%s", c.awsClient.Partition, bucket, key), actions)
+	if err := c.awsClient.PutRolePolicy(ctx, roleName, policy); err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(c.cleanupContext(), time.Second*5)
+		defer cancel()
+		if err := c.awsClient.DeleteRolePolicy(ctx, roleName, policy.Name); err != nil {
+			c.logger.Error(fmt.Sprintf("delete %s policy from %s role: %v", policy.Name, roleName, err))
+		}
+	}()
+
+	// same as with instance profile, role policy is not effective straight away
+	c.logger.Info("waiting 10 seconds for role policy to become available")
+	if err := c.sleep(10 * time.Second); err != nil {
+		return err
+	}
+	return fn()
+}
+
+func (c Client) deleteObject(bucket, key string) {
+	ctx, cancel := context.WithTimeout(c.cleanupContext(), time.Second*5)
+	defer cancel()
+	if err := c.awsClient.DeleteObject(ctx, bucket, key); err != nil {
+		c.logger.Error(fmt.Sprintf("delete s3://%s/%s: %v", bucket, key, err))
+	}
+}
+
+func (c Client) cpS3Key(instance aws.Instance, name string) string {
+	return fmt.Sprintf("ec2-cp/%s/%d/%s", instance.Id, time.Now().UnixNano(), name)
+}
+
+// remoteChecksum runs command that prints sha256sum output and returns the checksum
+func (c Client) remoteChecksum(instance aws.Instance, command string) (string, error) {
+	out, err := c.runCommand(instance, command)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no checksum returned from %s instance", instance.Name)
+	}
+	return fields[0], nil
+}
+
+// runCommand runs command on single instance and returns stdout, error is returned if the command did not succeed
+func (c Client) runCommand(instance aws.Instance, command string) (string, error) {
+	results, err := c.Exec(aws.Instances{instance}, command, cpCommandTimeout, nil)
+	if err != nil {
+		return "", err
+	}
+	invocation := results[0].Invocation
+	if !results[0].IsSuccess() {
+		return "", fmt.Errorf("command on %s instance %s: %s %s", instance.Name, strings.ToLower(results[0].Status()),
+			results[0].Details(), strings.TrimSpace(invocation.Stderr))
+	}
+	return invocation.Stdout, nil
+}
+
+func fileChecksum(name string) (string, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", 0, fmt.Errorf("open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("read %s: %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func shellQuote(in string) string {
+	return "'" + strings.ReplaceAll(in, "'", `'\''`) + "'"
+}
+
+// progressReader reports read bytes, seek resets the progress, because SDK reads the body to compute checksum
+type progressReader struct {
+	r        io.ReadSeeker
+	done     int64
+	total    int64
+	progress Progress
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	p.progress(p.done, p.total)
+	return n, err
+}
+
+func (p *progressReader) Seek(offset int64, whence int) (int64, error) {
+	n, err := p.r.Seek(offset, whence)
+	p.done = n
+	return n, err
+}
+
+type progressWriter struct {
+	w        io.Writer
+	done     int64
+	total    int64
+	progress Progress
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.done += int64(n)
+	p.progress(p.done, p.total)
+	return n, err
+}
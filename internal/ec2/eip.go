@@ -0,0 +1,69 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/progress"
+	"strings"
+	"time"
+)
+
+// AttachElasticIp associates elastic IP with the instance. If allocation id is empty, new elastic IP is allocated
+// and it is released when the instance is deleted, or elastic IP detached
+func (c Client) AttachElasticIp(instance aws.Instance, allocationId string) (aws.Address, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*30)
+	defer cancel()
+
+	defer c.cache.Delete(c.cacheKey("instances"))
+	// instances can be cached, get fresh tags and public IP
+	instance, err := c.awsClient.DescribeInstanceById(ctx, instance.Id)
+	if err != nil {
+		return aws.Address{}, err
+	}
+	if instance.PublicIpElastic || instance.ManagedEipAllocationId() != "" {
+		return aws.Address{}, fmt.Errorf("instance %s already has elastic ip %s", instance.Name, instance.PublicIp)
+	}
+	metadata := GetMetadataInput(strings.TrimPrefix(instance.Name, NamePrefix))
+	return c.awsClient.AttachElasticIp(ctx, instance, metadata, allocationId)
+}
+
+// DetachElasticIp disassociates elastic IPs from the instance and releases elastic IP allocated by AttachElasticIp.
+// Instance gets new public IP if it is in subnet that assigns public IPs
+func (c Client) DetachElasticIp(instance aws.Instance) ([]aws.Address, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*30)
+	defer cancel()
+
+	defer c.cache.Delete(c.cacheKey("instances"))
+	instance, err := c.awsClient.DescribeInstanceById(ctx, instance.Id)
+	if err != nil {
+		return nil, err
+	}
+	return c.awsClient.DetachElasticIp(ctx, instance)
+}
+
+// ElasticIpError is returned when instance is created and ready, but elastic IP could not be attached. Instance is
+// kept, elastic IP can be attached again with AttachElasticIp
+type ElasticIpError struct {
+	InstanceId string
+	Err        error
+}
+
+func (e *ElasticIpError) Error() string {
+	return fmt.Sprintf("instance %s created, but elastic ip not attached: %v", e.InstanceId, e.Err)
+}
+
+func (e *ElasticIpError) Unwrap() error {
+	return e.Err
+}
+
+// attachNewElasticIp allocates elastic IP for created instance and returns instance with the new public IP. Instance
+// is returned with ElasticIpError if elastic IP could not be attached
+func (c Client) attachNewElasticIp(instance aws.Instance) (aws.Instance, error) {
+	address, err := c.AttachElasticIp(instance, "")
+	if err != nil {
+		return instance, &ElasticIpError{InstanceId: instance.Id, Err: err}
+	}
+	progress.Report(c.reporter, progress.Event{Type: progress.Created, Instance: instance.Name, Resource: "elastic ip", Id: address.AllocationId, Message: address.PublicIp})
+	return c.describeInstanceById(instance.Id)
+}
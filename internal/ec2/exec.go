@@ -0,0 +1,209 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/aws/ssm"
+	"strings"
+	"time"
+)
+
+const (
+	// sendCommandBatchSize is the maximum number of instance ids accepted by ssm send-command
+	sendCommandBatchSize = 50
+	// execGracePeriod is time we wait on top of the command timeout for SSM agent to pick up and report command
+	execGracePeriod  = 60 * time.Second
+	execPollInterval = 2 * time.Second
+)
+
+// ExecOutput is called with every new line of the command output, stderr is set to true if the line is from stderr.
+// Output can be nil if the caller is interested only in the results
+type ExecOutput func(instance aws.Instance, line string, stderr bool)
+
+type ExecResult struct {
+	Instance   aws.Instance
+	Invocation ssm.CommandInvocation
+}
+
+// IsTruncated returns true if the command output exceeded SSM limit, so only part of it was received
+func (e ExecResult) IsTruncated() bool {
+	return e.Invocation.IsTruncated()
+}
+
+// IsSuccess returns true if the command finished successfully and its whole output was received
+func (e ExecResult) IsSuccess() bool {
+	return e.Invocation.IsSuccess() && !e.IsTruncated()
+}
+
+// Status returns command invocation status, or Partial if the command succeeded, but its output was truncated
+func (e ExecResult) Status() string {
+	if e.Invocation.IsSuccess() && e.IsTruncated() {
+		return "Partial"
+	}
+	return e.Invocation.Status
+}
+
+// Details returns command invocation status details, or reason why the output is incomplete if it was truncated
+func (e ExecResult) Details() string {
+	if e.IsTruncated() {
+		return fmt.Sprintf("output exceeded SSM limit of %d characters and was truncated", ssm.OutputLimit)
+	}
+	return e.Invocation.StatusDetails
+}
+
+type ExecResults []ExecResult
+
+// Failed returns results that did not finish successfully, or their output was truncated
+func (e ExecResults) Failed() ExecResults {
+	var out ExecResults
+	for _, result := range e {
+		if !result.IsSuccess() {
+			out = append(out, result)
+		}
+	}
+	return out
+}
+
+// Exec runs shell command on supplied instances via SSM and polls the invocations until they finish or timeout
+// is reached. New output is passed to the output function line by line as it becomes available
+func (c Client) Exec(instances aws.Instances, command string, timeout time.Duration, output ExecOutput) (ExecResults, error) {
+	if output == nil {
+		output = func(aws.Instance, string, bool) {}
+	}
+	commandIds, err := c.sendShellCommand(instances, command, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := make([]*execStream, len(instances))
+	for i, instance := range instances {
+		streams[i] = &execStream{instance: instance, commandId: commandIds[instance.Id], output: output}
+	}
+
+	deadline := time.Now().Add(timeout + execGracePeriod)
+	for {
+		pending := 0
+		for _, stream := range streams {
+			if stream.invocation.IsDone() {
+				continue
+			}
+			invocation, err := c.getCommandInvocation(stream.commandId, stream.instance.Id)
+			if err != nil {
+				return nil, err
+			}
+			stream.update(invocation)
+			if !invocation.IsDone() {
+				pending++
+			}
+		}
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			c.logger.Warn(fmt.Sprintf("%d instances did not finish in %s, canceling command", pending, timeout+execGracePeriod))
+			c.cancelPending(streams)
+			break
+		}
+		if err := c.sleep(execPollInterval); err != nil {
+			c.cancelPending(streams)
+			return nil, err
+		}
+	}
+
+	var results ExecResults
+	for _, stream := range streams {
+		stream.flush()
+		results = append(results, ExecResult{Instance: stream.instance, Invocation: stream.invocation})
+	}
+	return results, nil
+}
+
+// sendShellCommand sends command in batches and returns map of instance id to command id
+func (c Client) sendShellCommand(instances aws.Instances, command string, timeout time.Duration) (map[string]string, error) {
+	out := make(map[string]string)
+	for i := 0; i < len(instances); i += sendCommandBatchSize {
+		batch := instances[i:min(i+sendCommandBatchSize, len(instances))]
+		var instanceIds []string
+		for _, instance := range batch {
+			instanceIds = append(instanceIds, instance.Id)
+		}
+
+		ctx, cancel := context.WithTimeout(c.context(), time.Second*5)
+		commandId, err := c.awsClient.SendShellCommand(ctx, instanceIds, command, timeout)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		for _, instanceId := range instanceIds {
+			out[instanceId] = commandId
+		}
+	}
+	return out, nil
+}
+
+func (c Client) getCommandInvocation(commandId, instanceId string) (ssm.CommandInvocation, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*5)
+	defer cancel()
+	return c.awsClient.GetCommandInvocation(ctx, commandId, instanceId)
+}
+
+// cancelPending cancels commands on instances that are not done yet and marks them as timed out
+func (c Client) cancelPending(streams []*execStream) {
+	ctx, cancel := context.WithTimeout(c.cleanupContext(), time.Second*5)
+	defer cancel()
+
+	for _, stream := range streams {
+		if stream.invocation.IsDone() {
+			continue
+		}
+		if err := c.awsClient.CancelCommand(ctx, stream.commandId, []string{stream.instance.Id}); err != nil {
+			c.logger.Error(fmt.Sprintf("cancel command on %s instance: %v", stream.instance.Name, err))
+		}
+		stream.invocation.Status = "TimedOut"
+		stream.invocation.StatusDetails = "timed out waiting for command to finish"
+	}
+}
+
+// execStream keeps track of already printed output, so only new lines are sent to the output function
+type execStream struct {
+	instance   aws.Instance
+	commandId  string
+	output     ExecOutput
+	invocation ssm.CommandInvocation
+	stdoutPos  int
+	stderrPos  int
+}
+
+func (e *execStream) update(invocation ssm.CommandInvocation) {
+	e.invocation = invocation
+	e.stdoutPos = e.writeLines(invocation.Stdout, e.stdoutPos, false)
+	e.stderrPos = e.writeLines(invocation.Stderr, e.stderrPos, true)
+}
+
+// flush writes remaining output that does not end with new line
+func (e *execStream) flush() {
+	if e.stdoutPos < len(e.invocation.Stdout) {
+		e.output(e.instance, e.invocation.Stdout[e.stdoutPos:], false)
+		e.stdoutPos = len(e.invocation.Stdout)
+	}
+	if e.stderrPos < len(e.invocation.Stderr) {
+		e.output(e.instance, e.invocation.Stderr[e.stderrPos:], true)
+		e.stderrPos = len(e.invocation.Stderr)
+	}
+}
+
+// writeLines writes complete lines from supplied position and returns new position
+func (e *execStream) writeLines(content string, pos int, stderr bool) int {
+	if pos > len(content) {
+		return pos
+	}
+	for {
+		i := strings.IndexByte(content[pos:], '\n')
+		if i < 0 {
+			return pos
+		}
+		e.output(e.instance, content[pos:pos+i], stderr)
+		pos += i + 1
+	}
+}
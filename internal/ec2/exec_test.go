@@ -0,0 +1,37 @@
+package ec2
+
+import (
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/aws/ssm"
+	"strings"
+	"testing"
+)
+
+func TestExecResultsFailed(t *testing.T) {
+	tests := []struct {
+		name       string
+		invocation ssm.CommandInvocation
+		failed     bool
+		status     string
+	}{
+		{name: "success", invocation: ssm.CommandInvocation{Status: "Success", Stdout: "ok"}, status: "Success"},
+		{name: "exit code", invocation: ssm.CommandInvocation{Status: "Failed", ResponseCode: 1}, failed: true, status: "Failed"},
+		{name: "truncated stdout", invocation: ssm.CommandInvocation{Status: "Success", Stdout: strings.Repeat("x", ssm.OutputLimit)},
+			failed: true, status: "Partial"},
+		{name: "truncated stderr", invocation: ssm.CommandInvocation{Status: "Success", Stderr: "error\n--output truncated--"},
+			failed: true, status: "Partial"},
+		{name: "failed and truncated", invocation: ssm.CommandInvocation{Status: "Failed", ResponseCode: 1, Stdout: strings.Repeat("x", ssm.OutputLimit)},
+			failed: true, status: "Failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ExecResult{Instance: aws.Instance{Name: "test"}, Invocation: tt.invocation}
+			if failed := len(ExecResults{result}.Failed()) == 1; failed != tt.failed {
+				t.Errorf("expected failed %t, got %t", tt.failed, failed)
+			}
+			if result.Status() != tt.status {
+				t.Errorf("expected %s status, got %s", tt.status, result.Status())
+			}
+		})
+	}
+}
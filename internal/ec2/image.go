@@ -0,0 +1,63 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"strings"
+	"time"
+)
+
+// CreateImage creates image named <prefix><name> from the instance and waits for it to become available
+func (c Client) CreateImage(instance aws.Instance, name string, noReboot bool) (aws.Image, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Hour)
+	defer cancel()
+
+	metadata := GetMetadataInput(name)
+	images, err := c.awsClient.DescribeImagesByTags(ctx, map[string]string{"Name": metadata.Name})
+	if err != nil {
+		return aws.Image{}, err
+	}
+	if len(images) != 0 {
+		return aws.Image{}, fmt.Errorf("image %s already exists", metadata.Name)
+	}
+
+	imageId, err := c.awsClient.CreateImage(ctx, instance, metadata, noReboot)
+	if err != nil {
+		return aws.Image{}, err
+	}
+	c.logger.Info(fmt.Sprintf("waiting for image %s to become available", imageId))
+	return c.awsClient.WaitForImage(ctx, imageId, 55*time.Minute)
+}
+
+// ListImages returns images created by CreateImage
+func (c Client) ListImages() (aws.Images, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*10)
+	defer cancel()
+	// project tags without the name
+	tags := GetMetadataInput("").Tags
+	delete(tags, "Name")
+	return c.awsClient.DescribeImagesByTags(ctx, tags)
+}
+
+// GetImage returns image created by CreateImage, name can be supplied with or without the name prefix
+func (c Client) GetImage(name string) (aws.Image, error) {
+	images, err := c.ListImages()
+	if err != nil {
+		return aws.Image{}, err
+	}
+	metadata := GetMetadataInput(strings.TrimPrefix(name, NamePrefix))
+	for _, image := range images {
+		if image.Name == metadata.Name || image.Id == name {
+			return image, nil
+		}
+	}
+	return aws.Image{}, fmt.Errorf("image %s not found", name)
+}
+
+// DeleteImage deregisters image and deletes its snapshots
+func (c Client) DeleteImage(image aws.Image) error {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*30)
+	defer cancel()
+	return c.awsClient.DeregisterImage(ctx, image)
+}
@@ -0,0 +1,53 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when instance or subnet does not exist
+var ErrNotFound = errors.New("not found")
+
+// ListAll returns instances in any state except terminated (List returns only running instances), it is not cached
+func (c Client) ListAll() (aws.Instances, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*5)
+	defer cancel()
+	return c.awsClient.DescribeAllInstancesByNamePrefix(ctx, NamePrefix, GetMetadataInput("").Tags)
+}
+
+// FindInstance returns instance (in any state except terminated) by name with or without the name prefix
+func (c Client) FindInstance(name string) (aws.Instance, error) {
+	instances, err := c.ListAll()
+	if err != nil {
+		return aws.Instance{}, err
+	}
+	fullName := NamePrefix + strings.TrimPrefix(name, NamePrefix)
+	for _, instance := range instances {
+		if instance.Name == fullName {
+			return instance, nil
+		}
+	}
+	return aws.Instance{}, fmt.Errorf("instance %s %w", name, ErrNotFound)
+}
+
+// Start starts stopped instance
+func (c Client) Start(instance aws.Instance) error {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*10)
+	defer cancel()
+
+	defer c.cache.Delete(c.cacheKey("instances"))
+	return c.awsClient.StartInstance(ctx, instance)
+}
+
+// Stop stops running instance, elastic IP stays associated with the instance
+func (c Client) Stop(instance aws.Instance) error {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*10)
+	defer cancel()
+
+	defer c.cache.Delete(c.cacheKey("instances"))
+	return c.awsClient.StopInstance(ctx, instance)
+}
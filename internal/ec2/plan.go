@@ -0,0 +1,311 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/aws/iam"
+	"github.com/pete911/ec2/internal/aws/vpc"
+	"sort"
+	"strings"
+	"time"
+)
+
+type PlanItem struct {
+	// Action is either "create" or "delete"
+	Action  string
+	Type    string
+	Name    string
+	Details []string
+}
+
+// Plan is list of resources that would be created or deleted
+type Plan []PlanItem
+
+func (p Plan) String() string {
+	var out []string
+	for _, item := range p {
+		symbol := "+"
+		if item.Action == "delete" {
+			symbol = "-"
+		}
+		out = append(out, fmt.Sprintf("%s %s %s", symbol, item.Type, item.Name))
+		for _, detail := range item.Details {
+			out = append(out, fmt.Sprintf("    %s", detail))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// PlanCreate returns resources created by Create (count 1) or CreateBatch, instances are distributed across subnets
+// the same way as in CreateBatch. Subnets are ignored if new VPC is created
+func (c Client) PlanCreate(name string, count int, subnets []vpc.Subnet, opts CreateOptions) Plan {
+	config := NewConfig(name, c.awsClient.AccountId, c.awsClient.Region)
+	// security group and instance profile of the batch are shared by the batch instances
+	resources := config
+	if count > 1 {
+		resources = NewConfig(BatchResourcesName(name), c.awsClient.AccountId, c.awsClient.Region)
+	}
+	profile := resources.GetInstanceProfileInput()
+
+	var plan Plan
+	if opts.NewVpc {
+		tags := formatTags(config.meta.Tags)
+		// cidr is validated before the plan is created
+		vpcCidr, subnetCidr, _ := vpc.NetworkCidrBlocks(opts.NewVpcCidr)
+		plan = Plan{
+			{Action: "create", Type: "vpc", Name: config.meta.Name, Details: []string{"cidr: " + vpcCidr, tags}},
+			{Action: "create", Type: "internet gateway", Name: config.meta.Name, Details: []string{tags}},
+			{Action: "create", Type: "subnet", Name: config.meta.Name, Details: []string{"cidr: " + subnetCidr, "public ip on launch", tags}},
+			{Action: "create", Type: "route table", Name: config.meta.Name, Details: []string{"route: 0.0.0.0/0 to internet gateway", tags}},
+		}
+		subnets = []vpc.Subnet{{Id: "(new)", VpcId: "(new)", AvailabilityZone: "AZ selected by AWS"}}
+	}
+
+	var rolePolicies []string
+	for _, policy := range profile.Role.ManagedPolicyNames {
+		rolePolicies = append(rolePolicies, fmt.Sprintf("managed policy: %s", iam.ManagedPolicyArn(c.awsClient.Partition, policy)))
+	}
+	for _, policy := range profile.Role.InlinePolicies {
+		rolePolicies = append(rolePolicies, fmt.Sprintf("inline policy: %s", policy.Name))
+	}
+
+	plan = append(plan, Plan{
+		{
+			Action:  "create",
+			Type:    "security group",
+			Name:    resources.meta.Name,
+			Details: []string{fmt.Sprintf("vpc: %s", subnets[0].VpcId), formatTags(resources.meta.Tags)},
+		},
+		{Action: "create", Type: "instance profile", Name: profile.Name, Details: []string{formatTags(profile.Tags)}},
+		{Action: "create", Type: "role", Name: profile.Role.RoleName, Details: append(rolePolicies, formatTags(profile.Role.Tags))},
+	}...)
+
+	if opts.SsmEndpoints {
+		endpoints := GetMetadataInput(ssmEndpointsName)
+		plan = append(plan, PlanItem{
+			Action:  "create",
+			Type:    "security group",
+			Name:    endpoints.Name,
+			Details: []string{"ingress: tcp 443 from vpc cidr", "skipped if it already exists", formatTags(endpoints.Tags)},
+		})
+		for _, service := range ssmEndpointServices {
+			plan = append(plan, PlanItem{
+				Action:  "create",
+				Type:    "vpc endpoint",
+				Name:    vpc.EndpointServiceName(c.awsClient.Partition, c.Region, service),
+				Details: []string{"interface with private dns", "skipped if usable endpoint already exists", formatTags(endpoints.Tags)},
+			})
+		}
+	}
+
+	imageId, instanceType := aws.DefaultImageId, defaultInstanceType
+	if template := opts.LaunchTemplate; template.Id != "" {
+		if template.ImageId != "" {
+			imageId = template.ImageId
+		}
+		if template.InstanceType != "" {
+			instanceType = template.InstanceType
+		}
+	}
+	if opts.ImageId != "" {
+		imageId = opts.ImageId
+	}
+	names := []string{name}
+	if count > 1 {
+		names = BatchNames(name, count)
+	}
+	for i, instanceName := range names {
+		subnet := subnets[i%len(subnets)]
+		meta := GetMetadataInput(instanceName)
+		details := []string{
+			fmt.Sprintf("type: %s", instanceType),
+			fmt.Sprintf("ami: %s", imageId),
+			fmt.Sprintf("subnet: %s (%s)", subnet.Id, subnet.AvailabilityZone),
+		}
+		if opts.LaunchTemplate.Id != "" {
+			details = append(details, fmt.Sprintf("launch template: %s", opts.LaunchTemplate))
+		}
+		if opts.NewVpc {
+			details = append(details, fmt.Sprintf("tag: %s=(new vpc id)", aws.ManagedVpcTagKey))
+		}
+		if opts.SsmEndpoints {
+			details = append(details, fmt.Sprintf("tag: %s=%s", aws.SsmEndpointsTagKey, GetMetadataInput(ssmEndpointsName).Name))
+		}
+		if opts.Ipv6 || subnet.IsIpv6Only() {
+			details = append(details, fmt.Sprintf("ipv6: %s", strings.Join(subnet.Ipv6CidrBlocks, ", ")))
+		}
+		plan = append(plan, PlanItem{
+			Action:  "create",
+			Type:    "instance",
+			Name:    meta.Name,
+			Details: append(details, formatTags(meta.Tags)),
+		})
+		if opts.Eip {
+			plan = append(plan, PlanItem{Action: "create", Type: "elastic ip", Name: meta.Name, Details: []string{formatTags(meta.Tags)}})
+		}
+	}
+	return plan
+}
+
+// PlanDelete returns resources deleted by Delete or DeleteBatch. Security groups and instance profiles shared by
+// other instances are not deleted, so they are marked as such. Roles and their policies are listed on best-effort
+// basis, IAM read permissions are not required to delete instances
+func (c Client) PlanDelete(instances aws.Instances) Plan {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*30)
+	defer cancel()
+
+	var plan Plan
+	profiles := make(map[string]bool)
+	securityGroups := make(map[string]bool)
+	for _, instance := range instances {
+		plan = append(plan, PlanItem{
+			Action:  "delete",
+			Type:    "instance",
+			Name:    instance.Name,
+			Details: []string{fmt.Sprintf("id: %s", instance.Id), fmt.Sprintf("type: %s", instance.InstanceType)},
+		})
+	}
+
+	for _, instance := range instances {
+		for _, sg := range instance.SecurityGroups {
+			if securityGroups[sg.Id] {
+				continue
+			}
+			securityGroups[sg.Id] = true
+			plan = append(plan, PlanItem{
+				Action:  "delete",
+				Type:    "security group",
+				Name:    sg.Name,
+				Details: []string{fmt.Sprintf("id: %s", sg.Id), "skipped if used by other instances"},
+			})
+		}
+
+		if instance.InstanceProfile == "" || profiles[instance.InstanceProfile] {
+			continue
+		}
+		profiles[instance.InstanceProfile] = true
+		plan = append(plan, PlanItem{
+			Action:  "delete",
+			Type:    "instance profile",
+			Name:    instance.InstanceProfile,
+			Details: []string{"skipped if used by other instances"},
+		})
+
+		profile, err := c.awsClient.GetInstanceProfile(ctx, instance.InstanceProfile)
+		if err != nil {
+			c.logger.Debug(fmt.Sprintf("get %s instance profile: %v", instance.InstanceProfile, err))
+			plan[len(plan)-1].Details = append(plan[len(plan)-1].Details, "with its role, role could not be listed")
+			continue
+		}
+		for _, roleName := range profile.RoleNames {
+			inlinePolicies, managedPolicies, err := c.awsClient.GetRolePolicies(ctx, roleName)
+			if err != nil {
+				c.logger.Debug(fmt.Sprintf("get %s role policies: %v", roleName, err))
+				plan = append(plan, PlanItem{Action: "delete", Type: "role", Name: roleName, Details: []string{"policies could not be listed"}})
+				continue
+			}
+			var details []string
+			for _, policy := range managedPolicies {
+				details = append(details, fmt.Sprintf("detach managed policy: %s", policy))
+			}
+			for _, policy := range inlinePolicies {
+				details = append(details, fmt.Sprintf("delete inline policy: %s", policy))
+			}
+			plan = append(plan, PlanItem{Action: "delete", Type: "role", Name: roleName, Details: details})
+		}
+	}
+
+	for _, instance := range instances {
+		if allocationId := instance.ManagedEipAllocationId(); allocationId != "" {
+			plan = append(plan, PlanItem{
+				Action:  "delete",
+				Type:    "elastic ip",
+				Name:    allocationId,
+				Details: []string{fmt.Sprintf("public ip: %s", instance.PublicIp)},
+			})
+		}
+	}
+
+	endpoints := make(map[string]bool)
+	for _, instance := range instances {
+		name := instance.SsmEndpointsName()
+		if name == "" || endpoints[instance.VpcId] {
+			continue
+		}
+		endpoints[instance.VpcId] = true
+		plan = append(plan, PlanItem{
+			Action:  "delete",
+			Type:    "vpc endpoints",
+			Name:    name,
+			Details: []string{fmt.Sprintf("vpc: %s", instance.VpcId), "with security group", "skipped if used by other instances"},
+		})
+	}
+
+	vpcs := make(map[string]bool)
+	for _, instance := range instances {
+		vpcId := instance.ManagedVpcId()
+		if vpcId == "" || vpcs[vpcId] {
+			continue
+		}
+		vpcs[vpcId] = true
+		plan = append(plan, PlanItem{
+			Action:  "delete",
+			Type:    "vpc",
+			Name:    vpcId,
+			Details: []string{"with subnets, route tables and internet gateway", "skipped if used by other instances"},
+		})
+	}
+	return plan
+}
+
+// DryRunCreate calls EC2 APIs with DryRun flag to verify permissions to create instance. IAM does not support dry
+// run, so IAM permissions are not verified
+func (c Client) DryRunCreate(name string, subnet vpc.Subnet, opts CreateOptions) []aws.DryRunResult {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*10)
+	defer cancel()
+
+	// VPC does not exist yet, so security group, endpoints and instance cannot be verified
+	if opts.NewVpc {
+		return c.awsClient.DryRunCreateNetwork(ctx, opts.NewVpcCidr)
+	}
+	var results []aws.DryRunResult
+	if opts.SsmEndpoints {
+		results = c.awsClient.DryRunCreateSSMEndpoints(ctx, subnet)
+	}
+	if opts.Eip {
+		results = append(results, c.awsClient.DryRunAllocateElasticIp(ctx)...)
+	}
+
+	config := NewConfig(name, c.awsClient.AccountId, c.awsClient.Region)
+	input := aws.RunInstancesInput{
+		Metadata:       config.meta,
+		Subnet:         subnet,
+		InstanceType:   defaultInstanceType,
+		ImageId:        opts.ImageId,
+		Ipv6:           opts.Ipv6,
+		LaunchTemplate: opts.LaunchTemplate,
+	}
+	return append(results, c.awsClient.DryRunRunInstance(ctx, input)...)
+}
+
+// DryRunDelete calls EC2 APIs with DryRun flag to verify permissions to delete instances
+func (c Client) DryRunDelete(instances aws.Instances) []aws.DryRunResult {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*30)
+	defer cancel()
+
+	var out []aws.DryRunResult
+	for _, instance := range instances {
+		out = append(out, c.awsClient.DryRunTerminateInstance(ctx, instance)...)
+	}
+	return out
+}
+
+func formatTags(tags map[string]string) string {
+	var out []string
+	for k, v := range tags {
+		out = append(out, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(out)
+	return fmt.Sprintf("tags: %s", strings.Join(out, ", "))
+}
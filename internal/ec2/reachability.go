@@ -0,0 +1,91 @@
+package ec2
+
+import (
+	"fmt"
+	"github.com/pete911/ec2/internal/aws/vpc"
+	"strings"
+)
+
+// ssmEndpointServices are services the SSM agent has to reach to register the instance and run commands
+var ssmEndpointServices = []string{"ssm", "ssmmessages", "ec2messages"}
+
+// Reachability is result of the pre-launch analysis whether instance in the subnet can reach SSM endpoints
+type Reachability struct {
+	Subnet    vpc.Subnet
+	Reachable bool
+	// Reason describes how the endpoints are reached, or why they are not
+	Reason string
+	// MissingEndpoints are SSM interface VPC endpoints (service names) missing in the VPC
+	MissingEndpoints []string
+}
+
+// Hint returns suggested fix if SSM endpoints are not reachable
+func (r Reachability) Hint() string {
+	if r.Reachable {
+		return ""
+	}
+	return fmt.Sprintf("select public subnet, add 0.0.0.0/0 route to NAT gateway to %s route table, or create "+
+		"interface VPC endpoints with private DNS enabled in %s vpc for %s",
+		r.Subnet.RouteTable.Id, r.Subnet.VpcId, strings.Join(r.MissingEndpoints, ", "))
+}
+
+// CheckSSMReachability checks whether instance launched in the subnet can reach ssm, ssmmessages and ec2messages
+// endpoints, either through internet gateway (with public IP), NAT or interface VPC endpoints. Security groups and
+// network ACLs are not checked
+func (c Client) CheckSSMReachability(subnet vpc.Subnet) (Reachability, error) {
+	out := Reachability{Subnet: subnet}
+	ipv6Only := subnet.IsIpv6Only()
+	if route, ok := subnet.RouteTable.DefaultRoute("ipv4"); ok && !ipv6Only {
+		switch route.TargetType {
+		case "internet-gateway":
+			if subnet.MapPublicIpOnLaunch {
+				out.Reachable = true
+				out.Reason = fmt.Sprintf("public subnet, default route to %s", route.TargetId)
+				return out, nil
+			}
+		case "nat-gateway", "nat-instance":
+			out.Reachable = true
+			out.Reason = fmt.Sprintf("private subnet, default route to %s %s", route.TargetType, route.TargetId)
+			return out, nil
+		case "transit-gateway", "network-interface", "vpc-peering-connection", "core-network":
+			// egress is centralized elsewhere, we cannot verify it, so we assume it works
+			out.Reachable = true
+			out.Reason = fmt.Sprintf("default route to %s %s (internet access not verified)", route.TargetType, route.TargetId)
+			return out, nil
+		}
+	}
+
+	endpoints, err := c.GetVpcEndpoints(subnet.VpcId)
+	if err != nil {
+		return Reachability{}, err
+	}
+	usable := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		if endpoint.IsUsable() {
+			usable[endpoint.ServiceName] = true
+		}
+	}
+	for _, service := range ssmEndpointServices {
+		serviceName := vpc.EndpointServiceName(c.awsClient.Partition, c.Region, service)
+		if !usable[serviceName] {
+			out.MissingEndpoints = append(out.MissingEndpoints, serviceName)
+		}
+	}
+	if len(out.MissingEndpoints) == 0 {
+		out.Reachable = true
+		out.Reason = "ssm, ssmmessages and ec2messages VPC endpoints"
+		return out, nil
+	}
+
+	switch {
+	case ipv6Only:
+		out.Reason = "IPv6-only subnet without SSM VPC endpoints"
+	case subnet.IsPublicIpv4() && !subnet.MapPublicIpOnLaunch:
+		out.Reason = "public subnet does not assign public IPv4 address to instances"
+	case subnet.IsPublicIpv6():
+		out.Reason = "subnet has only IPv6 route to internet gateway, SSM agent uses IPv4 endpoints"
+	default:
+		out.Reason = "private subnet without NAT gateway or SSM VPC endpoints"
+	}
+	return out, nil
+}
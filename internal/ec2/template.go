@@ -0,0 +1,40 @@
+package ec2
+
+import (
+	"context"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/aws/vpc"
+	"strings"
+	"time"
+)
+
+// GetLaunchTemplate returns launch template version referenced as <name|id>[:version]
+func (c Client) GetLaunchTemplate(ref string) (aws.LaunchTemplate, error) {
+	templateRef, err := aws.ParseLaunchTemplateRef(ref)
+	if err != nil {
+		return aws.LaunchTemplate{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*5)
+	defer cancel()
+	return c.awsClient.DescribeLaunchTemplate(ctx, templateRef)
+}
+
+// LaunchTemplateConflicts returns launch template fields that are replaced by the fields set by the tool when the
+// instance is created, subnet is empty when new VPC is created
+func (c Client) LaunchTemplateConflicts(name string, subnet vpc.Subnet, opts CreateOptions) []string {
+	return c.runInstancesInput(name, subnet, "", opts, nil).LaunchTemplateConflicts()
+}
+
+// ExportLaunchTemplate creates version of the named launch template from the instance launch configuration, template
+// is created if it does not exist. Name is used as is (ec2- prefix is not added), so the template is referenced by the
+// same name in GetLaunchTemplate
+func (c Client) ExportLaunchTemplate(instance aws.Instance, name string) (aws.LaunchTemplate, error) {
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*10)
+	defer cancel()
+
+	metadata := GetMetadataInput(strings.TrimPrefix(name, NamePrefix))
+	metadata.Name = name
+	metadata.Tags["Name"] = name
+	return c.awsClient.CreateLaunchTemplateVersion(ctx, instance, metadata)
+}
@@ -0,0 +1,150 @@
+package errs
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Class of the AWS API error, every known class maps to distinct process exit code, so wrapper scripts can react.
+// Errors that cannot be classified exit with generic exit code 1
+type Class int
+
+const (
+	ClassUnknown Class = iota
+	ClassNotFound
+	ClassConflict
+	ClassAccessDenied
+	ClassCredentials
+	ClassThrottling
+	ClassQuotaExceeded
+	ClassInsufficientCapacity
+	ClassInternal
+)
+
+var (
+	accessDeniedCodes = []string{"AccessDenied", "AccessDeniedException", "UnauthorizedOperation", "UnauthorizedAccess",
+		"OptInRequired"}
+	credentialsCodes = []string{"ExpiredToken", "ExpiredTokenException", "RequestExpired", "InvalidClientTokenId",
+		"AuthFailure", "UnrecognizedClientException", "SignatureDoesNotMatch", "InvalidToken"}
+	throttlingCodes = []string{"Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequestsException",
+		"SlowDown", "RequestThrottled"}
+	notFoundCodes = []string{"NoSuchEntity", "NoSuchKey", "NoSuchBucket", "NotFound"}
+	conflictCodes = []string{"EntityAlreadyExists"}
+	internalCodes = []string{"InternalError", "InternalFailure", "InternalServerError", "InternalServiceError",
+		"InternalServiceException", "ServiceUnavailable", "ServiceUnavailableException", "Unavailable", "ServiceFailure"}
+)
+
+// classify returns class of AWS API error code, order matters e.g. RequestLimitExceeded is throttling, not quota
+func classify(code string) Class {
+	switch {
+	case strings.HasSuffix(code, ".NotFound") || contains(notFoundCodes, code):
+		return ClassNotFound
+	case strings.HasSuffix(code, ".Duplicate") || contains(conflictCodes, code):
+		return ClassConflict
+	case contains(accessDeniedCodes, code):
+		return ClassAccessDenied
+	case contains(credentialsCodes, code):
+		return ClassCredentials
+	case contains(throttlingCodes, code):
+		return ClassThrottling
+	case strings.HasSuffix(code, "LimitExceeded") || code == "ServiceQuotaExceededException":
+		return ClassQuotaExceeded
+	case strings.HasPrefix(code, "Insufficient") && strings.HasSuffix(code, "Capacity"):
+		return ClassInsufficientCapacity
+	case contains(internalCodes, code):
+		return ClassInternal
+	}
+	return ClassUnknown
+}
+
+func (c Class) String() string {
+	switch c {
+	case ClassNotFound:
+		return "not found"
+	case ClassConflict:
+		return "conflict"
+	case ClassAccessDenied:
+		return "access denied"
+	case ClassCredentials:
+		return "invalid or expired credentials"
+	case ClassThrottling:
+		return "throttled"
+	case ClassQuotaExceeded:
+		return "quota exceeded"
+	case ClassInsufficientCapacity:
+		return "insufficient capacity"
+	case ClassInternal:
+		return "AWS internal error"
+	}
+	return "AWS API error"
+}
+
+func (c Class) Hint() string {
+	switch c {
+	case ClassAccessDenied:
+		return "your IAM identity is missing permission for this operation, ask your AWS administrator to grant it"
+	case ClassCredentials:
+		return "AWS credentials are missing or expired, refresh them (e.g. aws sso login) or check AWS_PROFILE"
+	case ClassThrottling:
+		return "AWS API rate limit reached, wait a moment and retry"
+	case ClassQuotaExceeded:
+		return "service quota reached, delete unused resources or request quota increase in Service Quotas console"
+	case ClassInsufficientCapacity:
+		return "AWS does not have capacity for the instance type in this availability zone, retry later or select " +
+			"subnet in different availability zone"
+	}
+	return ""
+}
+
+func (c Class) StatusCode() int {
+	switch c {
+	case ClassNotFound:
+		return http.StatusNotFound
+	case ClassConflict:
+		return http.StatusConflict
+	case ClassAccessDenied:
+		return http.StatusForbidden
+	case ClassCredentials:
+		return http.StatusUnauthorized
+	case ClassThrottling, ClassQuotaExceeded:
+		return http.StatusTooManyRequests
+	case ClassInsufficientCapacity:
+		return http.StatusServiceUnavailable
+	case ClassInternal:
+		return http.StatusInternalServerError
+	}
+	// unknown codes are client errors (e.g. InvalidParameterValue), server faults are classified as internal
+	return http.StatusBadRequest
+}
+
+// ExitCode returns process exit code, 1 is used for generic errors
+func (c Class) ExitCode() int {
+	switch c {
+	case ClassNotFound:
+		return 3
+	case ClassConflict:
+		return 4
+	case ClassAccessDenied:
+		return 5
+	case ClassCredentials:
+		return 6
+	case ClassThrottling:
+		return 7
+	case ClassQuotaExceeded:
+		return 8
+	case ClassInsufficientCapacity:
+		return 9
+	case ClassInternal:
+		return 10
+	}
+	return 1
+}
+
+func contains(in []string, v string) bool {
+	for _, item := range in {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -5,13 +5,22 @@ import (
 	"fmt"
 	"github.com/aws/smithy-go"
 	"net/http"
+	"regexp"
 	"strings"
 )
 
+var encodedMessageRegex = regexp.MustCompile(`Encoded authorization failure message: (\S+)`)
+
 type ApiError struct {
 	StatusCode  int
 	FullError   error
 	UserMessage string
+	Class       Class
+	// Code and Message are AWS API error code and message
+	Code    string
+	Message string
+	// EncodedMessage is set on UnauthorizedOperation errors and can be decoded by sts decode-authorization-message
+	EncodedMessage string
 }
 
 func NewApiError(statusCode int, err error, userMessage string) *ApiError {
@@ -19,15 +28,19 @@ func NewApiError(statusCode int, err error, userMessage string) *ApiError {
 		StatusCode:  statusCode,
 		FullError:   err,
 		UserMessage: userMessage,
+		Class:       ClassUnknown,
 	}
 }
 
+// Error returns user message with short AWS error code and message, full SDK error is available in FullError
 func (e *ApiError) Error() string {
 	var out []string
 	if e.UserMessage != "" {
 		out = append(out, e.UserMessage)
 	}
-	if e.FullError != nil {
+	if e.Code != "" {
+		out = append(out, fmt.Sprintf("%s: %s", e.Code, e.Message))
+	} else if e.FullError != nil {
 		out = append(out, e.FullError.Error())
 	}
 	if e.StatusCode != 0 {
@@ -36,18 +49,68 @@ func (e *ApiError) Error() string {
 	return strings.Join(out, ": ")
 }
 
+func (e *ApiError) Unwrap() error {
+	return e.FullError
+}
+
+// Hint returns actionable message for the user, or empty string if there is none
+func (e *ApiError) Hint() string {
+	return e.Class.Hint()
+}
+
 // FromAwsApi wrap AWS SDK error in API error
 func FromAwsApi(err error, msg string) error {
 	var apiErr smithy.APIError
 	if ok := errors.As(err, &apiErr); ok {
-		code := apiErr.ErrorCode()
-		if strings.HasSuffix(code, ".NotFound") {
-			return NewApiError(http.StatusNotFound, err, fmt.Sprintf("%s: not found", msg))
+		class := classify(apiErr.ErrorCode())
+		statusCode := class.StatusCode()
+		var respErr interface{ HTTPStatusCode() int }
+		if errors.As(err, &respErr) && class == ClassUnknown {
+			statusCode = respErr.HTTPStatusCode()
+		}
+		// code is not known, but AWS reported it as its own fault
+		if class == ClassUnknown && (apiErr.ErrorFault() == smithy.FaultServer || statusCode >= 500) {
+			class, statusCode = ClassInternal, http.StatusInternalServerError
 		}
-		if strings.HasSuffix(code, ".Duplicate") {
-			return NewApiError(http.StatusConflict, err, fmt.Sprintf("%s: conflict", msg))
+		label := class.String()
+		if class == ClassUnknown {
+			label = fmt.Sprintf("%s (%s)", class, apiErr.ErrorCode())
 		}
-		return NewApiError(http.StatusInternalServerError, err, fmt.Sprintf("%s: internal server error", msg))
+		e := NewApiError(statusCode, err, fmt.Sprintf("%s: %s", msg, label))
+		e.Class = class
+		e.Code = apiErr.ErrorCode()
+		e.Message = apiErr.ErrorMessage()
+		if m := encodedMessageRegex.FindStringSubmatch(e.Message); len(m) == 2 {
+			e.EncodedMessage = m[1]
+			e.Message = strings.TrimSpace(strings.Replace(e.Message, m[0], "", 1))
+		}
+		return e
+	}
+
+	// credential errors happen before the request is sent, so they are not API errors
+	if isCredentialsError(err) {
+		e := NewApiError(ClassCredentials.StatusCode(), err, fmt.Sprintf("%s: %s", msg, ClassCredentials))
+		e.Class = ClassCredentials
+		return e
 	}
 	return NewApiError(0, err, msg)
 }
+
+// ExitCode returns process exit code for the error class, 1 is returned for errors that are not API errors
+func ExitCode(err error) int {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr.Class.ExitCode()
+	}
+	return 1
+}
+
+func isCredentialsError(err error) bool {
+	msg := err.Error()
+	for _, v := range []string{"failed to retrieve credentials", "failed to refresh cached credentials", "token has expired"} {
+		if strings.Contains(msg, v) {
+			return true
+		}
+	}
+	return false
+}
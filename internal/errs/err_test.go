@@ -0,0 +1,74 @@
+package errs
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestFromAwsApi(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		class      Class
+		statusCode int
+		exitCode   int
+		message    string
+	}{
+		{
+			name:       "known code",
+			err:        &smithy.GenericAPIError{Code: "InvalidInstanceID.NotFound", Message: "missing"},
+			class:      ClassNotFound,
+			statusCode: http.StatusNotFound,
+			exitCode:   3,
+			message:    "ec2 describe-instances: not found: InvalidInstanceID.NotFound: missing: Not Found",
+		},
+		{
+			name:       "unknown client code",
+			err:        &smithy.GenericAPIError{Code: "InvalidParameterValue", Message: "bad", Fault: smithy.FaultClient},
+			class:      ClassUnknown,
+			statusCode: http.StatusBadRequest,
+			exitCode:   1,
+			message:    "ec2 describe-instances: AWS API error (InvalidParameterValue): InvalidParameterValue: bad: Bad Request",
+		},
+		{
+			name:       "internal code",
+			err:        &smithy.GenericAPIError{Code: "InternalError", Message: "oops"},
+			class:      ClassInternal,
+			statusCode: http.StatusInternalServerError,
+			exitCode:   10,
+			message:    "ec2 describe-instances: AWS internal error: InternalError: oops: Internal Server Error",
+		},
+		{
+			name:       "unknown server fault",
+			err:        &smithy.GenericAPIError{Code: "SomethingBroke", Message: "oops", Fault: smithy.FaultServer},
+			class:      ClassInternal,
+			statusCode: http.StatusInternalServerError,
+			exitCode:   10,
+			message:    "ec2 describe-instances: AWS internal error: SomethingBroke: oops: Internal Server Error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := FromAwsApi(tt.err, "ec2 describe-instances")
+			var apiErr *ApiError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected ApiError, got %T", err)
+			}
+			if apiErr.Class != tt.class {
+				t.Errorf("class: expected %v, got %v", tt.class, apiErr.Class)
+			}
+			if apiErr.StatusCode != tt.statusCode {
+				t.Errorf("status code: expected %d, got %d", tt.statusCode, apiErr.StatusCode)
+			}
+			if code := ExitCode(err); code != tt.exitCode {
+				t.Errorf("exit code: expected %d, got %d", tt.exitCode, code)
+			}
+			if err.Error() != tt.message {
+				t.Errorf("message: expected %q, got %q", tt.message, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package progress
+
+import "time"
+
+type Type string
+
+const (
+	// Created resource was created
+	Created Type = "created"
+	// Deleted resource was deleted
+	Deleted Type = "deleted"
+	// State instance state changed
+	State Type = "state"
+	// Check status check passed
+	Check Type = "check"
+	// Info step started or was skipped
+	Info Type = "info"
+	// Done all steps of the instance (or shared resources) finished
+	Done Type = "done"
+	// Failed step failed, no more events are reported for the instance
+	Failed Type = "failed"
+)
+
+// Event is single create or delete step. Instance is name of the instance the step belongs to, it is empty for
+// resources shared by multiple instances
+type Event struct {
+	Time     time.Time `json:"time"`
+	Type     Type      `json:"type"`
+	Instance string    `json:"instance,omitempty"`
+	Resource string    `json:"resource,omitempty"`
+	Id       string    `json:"id,omitempty"`
+	Message  string    `json:"message"`
+}
+
+// Reporter receives events, it has to be safe for concurrent use
+type Reporter interface {
+	Report(Event)
+}
+
+// Report sets event time and sends it to the reporter, nil reporter discards the event
+func Report(r Reporter, e Event) {
+	if r == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	r.Report(e)
+}
@@ -0,0 +1,345 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/aws/vpc"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/pete911/ec2/internal/errs"
+	"github.com/pete911/ec2/internal/progress"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Instance is instance in any state except terminated, name is without the ec2- prefix
+type Instance struct {
+	Id               string            `json:"id"`
+	Name             string            `json:"name"`
+	State            string            `json:"state"`
+	InstanceType     string            `json:"instance_type"`
+	ImageId          string            `json:"image_id"`
+	VpcId            string            `json:"vpc_id"`
+	SubnetId         string            `json:"subnet_id"`
+	PublicDnsName    string            `json:"public_dns_name,omitempty"`
+	PublicIp         string            `json:"public_ip,omitempty"`
+	PublicIpElastic  bool              `json:"public_ip_elastic"`
+	PrivateDnsName   string            `json:"private_dns_name,omitempty"`
+	PrivateIp        string            `json:"private_ip,omitempty"`
+	Ipv6Address      string            `json:"ipv6_address,omitempty"`
+	SecurityGroupIds []string          `json:"security_group_ids"`
+	InstanceProfile  string            `json:"instance_profile,omitempty"`
+	LaunchTime       time.Time         `json:"launch_time"`
+	Tags             map[string]string `json:"tags"`
+}
+
+func toInstance(in aws.Instance) *Instance {
+	var securityGroupIds []string
+	for _, sg := range in.SecurityGroups {
+		securityGroupIds = append(securityGroupIds, sg.Id)
+	}
+	return &Instance{
+		Id:               in.Id,
+		Name:             strings.TrimPrefix(in.Name, ec2.NamePrefix),
+		State:            in.State,
+		InstanceType:     in.InstanceType,
+		ImageId:          in.ImageId,
+		VpcId:            in.VpcId,
+		SubnetId:         in.SubnetId,
+		PublicDnsName:    in.PublicDnsName,
+		PublicIp:         in.PublicIp,
+		PublicIpElastic:  in.PublicIpElastic,
+		PrivateDnsName:   in.PrivateDnsName,
+		PrivateIp:        in.PrivateIp,
+		Ipv6Address:      in.Ipv6Address,
+		SecurityGroupIds: securityGroupIds,
+		InstanceProfile:  in.InstanceProfile,
+		LaunchTime:       in.LaunchTime,
+		Tags:             in.Tags,
+	}
+}
+
+// CreateRequest is request body of create, it replaces create command flags and prompts. Subnet is required unless
+// new VPC is created
+type CreateRequest struct {
+	Name         string `json:"name"`
+	Region       string `json:"region"`
+	SubnetId     string `json:"subnet_id"`
+	Count        int    `json:"count"`
+	Concurrency  int    `json:"concurrency"`
+	Image        string `json:"image"`
+	Ipv6         bool   `json:"ipv6"`
+	NewVpc       bool   `json:"new_vpc"`
+	Cidr         string `json:"cidr"`
+	SsmEndpoints bool   `json:"ssm_endpoints"`
+	Eip          bool   `json:"eip"`
+}
+
+func (s Server) listInstances(w http.ResponseWriter, r *http.Request) {
+	client, err := s.client(r.URL.Query().Get("region"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	instances, err := client.WithContext(r.Context()).ListAll()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	out := []*Instance{}
+	for _, instance := range instances {
+		out = append(out, toInstance(instance))
+	}
+	writeJson(w, http.StatusOK, map[string]any{"region": client.Region, "instances": out})
+}
+
+func (s Server) getInstance(w http.ResponseWriter, r *http.Request) {
+	_, instance, err := s.findInstance(r)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, toInstance(instance))
+}
+
+// createInstance validates request and resolves image and subnet, so invalid request fails immediately, instance is
+// created by background job
+func (s Server) createInstance(w http.ResponseWriter, r *http.Request) {
+	var req CreateRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		s.writeError(w, fmt.Errorf("%w: %v", errBadRequest, err))
+		return
+	}
+	if err := s.setCreateCount(&req); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	client, err := s.client(req.Region)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	name, opts, subnets, err := createOptions(client.WithContext(r.Context()), &req)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	job := s.jobs.start("create", client.Region, name, func(reporter progress.Reporter) ([]Result, error) {
+		c := client.WithReporter(reporter)
+		if req.Count == 1 {
+			var subnet vpc.Subnet
+			if len(subnets) != 0 {
+				subnet = subnets[0]
+			}
+			// instance is returned with error, if it is created without elastic IP
+			instance, err := c.Create(name, subnet, opts)
+			result := Result{Name: name, Error: toError(err)}
+			if instance.Id != "" {
+				result.Instance = toInstance(instance)
+			}
+			return []Result{result}, nil
+		}
+
+		results, err := c.CreateBatch(name, req.Count, req.Concurrency, subnets, opts)
+		if err != nil {
+			return nil, err
+		}
+		var out []Result
+		for _, result := range results {
+			item := Result{Name: result.Name, Error: toError(result.Err)}
+			if result.Instance.Id != "" {
+				item.Instance = toInstance(result.Instance)
+			}
+			out = append(out, item)
+		}
+		return out, nil
+	})
+	writeJob(w, job)
+}
+
+// setCreateCount sets default count and concurrency and validates them, count is limited by the server max count, so
+// a single request cannot launch unbounded number of instances
+func (s Server) setCreateCount(req *CreateRequest) error {
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if req.Concurrency == 0 {
+		req.Concurrency = 5
+	}
+	if req.Count < 1 || req.Concurrency < 1 {
+		return fmt.Errorf("%w: count and concurrency have to be at least 1", errBadRequest)
+	}
+	if req.Count > s.maxCount {
+		return fmt.Errorf("%w: count cannot be more than %d", errBadRequest, s.maxCount)
+	}
+	return nil
+}
+
+// createOptions validates request and returns instance name without prefix, create options and
+// subnets (subnet spread across availability zones for batch, none for new VPC)
+func createOptions(client ec2.Client, req *CreateRequest) (string, ec2.CreateOptions, []vpc.Subnet, error) {
+	name := strings.TrimPrefix(req.Name, ec2.NamePrefix)
+	if name == "" {
+		return "", ec2.CreateOptions{}, nil, fmt.Errorf("%w: name is required", errBadRequest)
+	}
+
+	opts := ec2.CreateOptions{Ipv6: req.Ipv6, NewVpc: req.NewVpc, NewVpcCidr: req.Cidr, SsmEndpoints: req.SsmEndpoints, Eip: req.Eip}
+	if req.Image != "" {
+		image, err := client.GetImage(req.Image)
+		var apiErr *errs.ApiError
+		if errors.As(err, &apiErr) {
+			return "", opts, nil, err
+		}
+		if err != nil {
+			return "", opts, nil, fmt.Errorf("image %s %w", req.Image, ec2.ErrNotFound)
+		}
+		opts.ImageId = image.Id
+	}
+
+	if req.NewVpc {
+		if req.SubnetId != "" || req.Ipv6 {
+			return "", opts, nil, fmt.Errorf("%w: new_vpc cannot be used with subnet_id or ipv6", errBadRequest)
+		}
+		if _, _, err := vpc.NetworkCidrBlocks(req.Cidr); err != nil {
+			return "", opts, nil, fmt.Errorf("%w: %v", errBadRequest, err)
+		}
+		return name, opts, nil, nil
+	}
+	if req.Cidr != "" {
+		return "", opts, nil, fmt.Errorf("%w: cidr can only be used with new_vpc", errBadRequest)
+	}
+	if req.SubnetId == "" {
+		return "", opts, nil, fmt.Errorf("%w: subnet_id is required unless new_vpc is set", errBadRequest)
+	}
+	subnet, err := client.GetSubnet(req.SubnetId)
+	if err != nil {
+		return "", opts, nil, err
+	}
+	if req.Ipv6 && !subnet.HasIpv6() {
+		return "", opts, nil, fmt.Errorf("%w: subnet %s does not have IPv6 CIDR block", errBadRequest, subnet.Id)
+	}
+	if req.Count == 1 {
+		return name, opts, []vpc.Subnet{subnet}, nil
+	}
+	subnets, err := client.SpreadSubnets(subnet)
+	return name, opts, subnets, err
+}
+
+// deleteInstance verifies that instance exists, instance and its resources are deleted by background job
+func (s Server) deleteInstance(w http.ResponseWriter, r *http.Request) {
+	client, instance, err := s.findInstance(r)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	name := strings.TrimPrefix(instance.Name, ec2.NamePrefix)
+	job := s.jobs.start("delete", client.Region, name, func(reporter progress.Reporter) ([]Result, error) {
+		return []Result{{Name: name, Error: toError(client.WithReporter(reporter).Delete(instance))}}, nil
+	})
+	writeJob(w, job)
+}
+
+func (s Server) startInstance(w http.ResponseWriter, r *http.Request) {
+	client, instance, err := s.findInstance(r)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := client.WithContext(r.Context()).Start(instance); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s Server) stopInstance(w http.ResponseWriter, r *http.Request) {
+	client, instance, err := s.findInstance(r)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := client.WithContext(r.Context()).Stop(instance); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// findInstance returns client for the request region and instance from the request path
+func (s Server) findInstance(r *http.Request) (ec2.Client, aws.Instance, error) {
+	client, err := s.client(r.URL.Query().Get("region"))
+	if err != nil {
+		return ec2.Client{}, aws.Instance{}, err
+	}
+	instance, err := client.WithContext(r.Context()).FindInstance(r.PathValue("name"))
+	return client, instance, err
+}
+
+func (s Server) getJob(w http.ResponseWriter, r *http.Request) {
+	item, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		s.writeError(w, fmt.Errorf("job %s %w", r.PathValue("id"), ec2.ErrNotFound))
+		return
+	}
+	writeJson(w, http.StatusOK, item.snapshot())
+}
+
+// jobEvents streams job progress events as server-sent events, events reported before the request are sent first.
+// Event id is sequence number of the event, so client can resume with Last-Event-ID header. Stream ends with done
+// event that has the job (without events) as data
+func (s Server) jobEvents(w http.ResponseWriter, r *http.Request) {
+	item, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		s.writeError(w, fmt.Errorf("job %s %w", r.PathValue("id"), ec2.ErrNotFound))
+		return
+	}
+	n, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	for {
+		events, finished, changed := item.since(n)
+		for _, event := range events {
+			n++
+			writeEvent(w, n, "progress", event)
+		}
+		if finished {
+			job := item.snapshot()
+			job.Events = nil
+			writeEvent(w, n, "done", job)
+			_ = rc.Flush()
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, id int, event string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, data)
+}
+
+// writeJob writes accepted response with job status url
+func writeJob(w http.ResponseWriter, job Job) {
+	w.Header().Set("Location", "/v1/jobs/"+job.Id)
+	writeJson(w, http.StatusAccepted, job)
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/pete911/ec2/internal/progress"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// jobRetention is how long finished jobs are kept for status polling
+const jobRetention = 24 * time.Hour
+
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is create or delete running in background, Error is set if the whole job failed, errors of individual
+// instances are in the results
+type Job struct {
+	Id         string           `json:"id"`
+	Type       string           `json:"type"`
+	Region     string           `json:"region"`
+	Name       string           `json:"name"`
+	Status     JobStatus        `json:"status"`
+	Error      *Error           `json:"error,omitempty"`
+	Results    []Result         `json:"results,omitempty"`
+	Events     []progress.Event `json:"events,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+}
+
+type Result struct {
+	Name     string    `json:"name"`
+	Instance *Instance `json:"instance,omitempty"`
+	Error    *Error    `json:"error,omitempty"`
+}
+
+// job is Job with events broadcast, it is progress reporter of the job client
+type job struct {
+	mu  sync.Mutex
+	job Job
+	// changed is closed and replaced when event is reported or job finishes
+	changed chan struct{}
+}
+
+func (j *job) Report(e progress.Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.job.Events = append(j.job.Events, e)
+	j.notify()
+}
+
+func (j *job) finish(results []Result, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.job.FinishedAt = &now
+	j.job.Results = results
+	j.job.Status = JobSucceeded
+	if err != nil {
+		j.job.Status = JobFailed
+		j.job.Error = toError(err)
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			j.job.Status = JobFailed
+		}
+	}
+	j.notify()
+}
+
+func (j *job) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// snapshot returns copy of the job
+func (j *job) snapshot() Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := j.job
+	out.Events = append([]progress.Event{}, j.job.Events...)
+	return out
+}
+
+// since returns events reported after the first n events, whether the job finished and channel that is closed on
+// the next change
+func (j *job) since(n int) ([]progress.Event, bool, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	events := append([]progress.Event{}, j.job.Events[min(max(n, 0), len(j.job.Events)):]...)
+	return events, j.job.Status != JobRunning, j.changed
+}
+
+type jobs struct {
+	logger *slog.Logger
+	mu     sync.Mutex
+	items  map[string]*job
+	wg     sync.WaitGroup
+}
+
+func newJobs(logger *slog.Logger) *jobs {
+	return &jobs{logger: logger, items: make(map[string]*job)}
+}
+
+// start runs fn in background, fn reports progress to the supplied reporter. Finished jobs older than retention are
+// removed
+func (j *jobs) start(jobType, region, name string, fn func(progress.Reporter) ([]Result, error)) Job {
+	id, err := newJobId()
+	if err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	item := &job{
+		job:     Job{Id: id, Type: jobType, Region: region, Name: name, Status: JobRunning, CreatedAt: time.Now()},
+		changed: make(chan struct{}),
+	}
+
+	j.mu.Lock()
+	for k, v := range j.items {
+		if finished := v.snapshot().FinishedAt; finished != nil && time.Since(*finished) > jobRetention {
+			delete(j.items, k)
+		}
+	}
+	j.items[id] = item
+	j.mu.Unlock()
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		j.logger.Info(fmt.Sprintf("%s job %s started", jobType, id), "name", name, "region", region)
+		results, err := fn(item)
+		item.finish(results, err)
+		j.logger.Info(fmt.Sprintf("%s job %s finished", jobType, id), "status", item.snapshot().Status)
+	}()
+	return item.snapshot()
+}
+
+func (j *jobs) get(id string) (*job, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	item, ok := j.items[id]
+	return item, ok
+}
+
+func (j *jobs) wait() {
+	j.wg.Wait()
+}
+
+func newJobId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,15 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var openApiDocument []byte
+
+// openApi serves OpenAPI document, it does not require token, so clients can be generated from it
+func (s Server) openApi(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openApiDocument)
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/pete911/ec2/internal/errs"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+// errBadRequest is returned when request parameters are missing, invalid or cannot be combined
+var errBadRequest = errors.New("bad request")
+
+// ClientFactory returns client for the region, it is called for every request and should cache the clients
+type ClientFactory func(region string) (ec2.Client, error)
+
+type Server struct {
+	logger  *slog.Logger
+	clients ClientFactory
+	// region is used when request does not set region
+	region string
+	token  string
+	// maxCount is maximum number of instances created by one create request
+	maxCount int
+	jobs     *jobs
+}
+
+// NewServer creates server, every request (except OpenAPI document) has to have bearer token. Create request count is
+// limited to maxCount
+func NewServer(logger *slog.Logger, clients ClientFactory, region, token string, maxCount int) Server {
+	return Server{
+		logger:   logger,
+		clients:  clients,
+		region:   region,
+		token:    token,
+		maxCount: maxCount,
+		jobs:     newJobs(logger),
+	}
+}
+
+func (s Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /openapi.json", s.openApi)
+	mux.Handle("GET /v1/instances", s.auth(s.listInstances))
+	mux.Handle("POST /v1/instances", s.auth(s.createInstance))
+	mux.Handle("GET /v1/instances/{name}", s.auth(s.getInstance))
+	mux.Handle("DELETE /v1/instances/{name}", s.auth(s.deleteInstance))
+	mux.Handle("POST /v1/instances/{name}/start", s.auth(s.startInstance))
+	mux.Handle("POST /v1/instances/{name}/stop", s.auth(s.stopInstance))
+	mux.Handle("GET /v1/jobs/{id}", s.auth(s.getJob))
+	mux.Handle("GET /v1/jobs/{id}/events", s.auth(s.jobEvents))
+	return s.logRequests(mux)
+}
+
+// Wait blocks until all running jobs finish
+func (s Server) Wait() {
+	s.jobs.wait()
+}
+
+func (s Server) auth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJson(w, http.StatusUnauthorized, Error{Message: "missing or invalid bearer token"})
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (s Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		s.logger.Info("request", "method", r.Method, "path", r.URL.Path, "status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds())
+	})
+}
+
+// client returns client for the region set in the request, or server default region
+func (s Server) client(region string) (ec2.Client, error) {
+	if region == "" {
+		region = s.region
+	}
+	if region == "" {
+		return ec2.Client{}, fmt.Errorf("%w: region is required", errBadRequest)
+	}
+	if !regionPattern.MatchString(region) {
+		return ec2.Client{}, fmt.Errorf("%w: invalid region %s", errBadRequest, region)
+	}
+	return s.clients(region)
+}
+
+// Error is response body of failed request, and error of failed job or instance
+type Error struct {
+	Message string `json:"message"`
+	// Kind is AWS API error class, e.g. access denied, throttled
+	Kind string `json:"kind,omitempty"`
+	Code string `json:"code,omitempty"`
+	Hint string `json:"hint,omitempty"`
+	// ConsoleTail is last lines of console output of instance that did not pass status checks
+	ConsoleTail string `json:"console_tail,omitempty"`
+}
+
+// newError converts error to response body and HTTP status code
+func newError(err error) (Error, int) {
+	out := Error{Message: err.Error()}
+
+	var notReady *ec2.NotReadyError
+	if errors.As(err, &notReady) {
+		out.ConsoleTail = notReady.ConsoleTail
+	}
+	var apiErr *errs.ApiError
+	if errors.As(err, &apiErr) {
+		if apiErr.Class != errs.ClassUnknown || apiErr.Code != "" {
+			out.Kind = apiErr.Class.String()
+		}
+		out.Code = apiErr.Code
+		out.Hint = apiErr.Hint()
+		return out, apiStatusCode(apiErr)
+	}
+
+	switch {
+	case errors.Is(err, errBadRequest):
+		return out, http.StatusBadRequest
+	case errors.Is(err, ec2.ErrNotFound):
+		return out, http.StatusNotFound
+	case errors.Is(err, aws.ErrInstanceExists):
+		return out, http.StatusConflict
+	}
+	return out, http.StatusInternalServerError
+}
+
+// apiStatusCode returns status code of AWS API error, AWS faults and failed calls (e.g. AWS is not reachable) are
+// upstream errors, not errors of this server
+func apiStatusCode(err *errs.ApiError) int {
+	switch err.Class {
+	case errs.ClassInternal:
+		return http.StatusBadGateway
+	case errs.ClassUnknown:
+		if err.StatusCode >= 400 && err.StatusCode < 500 {
+			return err.StatusCode
+		}
+		return http.StatusBadGateway
+	}
+	return err.Class.StatusCode()
+}
+
+func toError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	out, _ := newError(err)
+	return &out
+}
+
+func (s Server) writeError(w http.ResponseWriter, err error) {
+	out, status := newError(err)
+	if status >= http.StatusInternalServerError {
+		s.logger.Error(err.Error())
+	}
+	writeJson(w, status, out)
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	// client might be gone, there is nothing to do with the error
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController flush server-sent events
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
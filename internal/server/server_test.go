@@ -0,0 +1,359 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/pete911/ec2/internal/errs"
+	"github.com/pete911/ec2/internal/progress"
+)
+
+const (
+	testToken    = "secret"
+	testMaxCount = 10
+)
+
+func newTestServer(t *testing.T, clients ClientFactory) (Server, *httptest.Server) {
+	t.Helper()
+	s := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)), clients, "", testToken, testMaxCount)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// failingClients returns client factory that records requested regions and fails with the supplied error
+func failingClients(regions *[]string, err error) ClientFactory {
+	return func(region string) (ec2.Client, error) {
+		*regions = append(*regions, region)
+		return ec2.Client{}, err
+	}
+}
+
+func do(t *testing.T, method, url, token string, body io.Reader) (*http.Response, Error) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var out Error
+	if resp.StatusCode >= 400 {
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("decode error body: %v", err)
+		}
+	}
+	return resp, out
+}
+
+func TestAuth(t *testing.T) {
+	var regions []string
+	_, ts := newTestServer(t, failingClients(&regions, errors.New("not called")))
+
+	for name, token := range map[string]string{"missing token": "", "invalid token": "wrong"} {
+		t.Run(name, func(t *testing.T) {
+			resp, body := do(t, http.MethodGet, ts.URL+"/v1/instances?region=eu-west-2", token, nil)
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Fatalf("expected 401, got %d", resp.StatusCode)
+			}
+			if resp.Header.Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("expected WWW-Authenticate Bearer header, got %q", resp.Header.Get("WWW-Authenticate"))
+			}
+			if body.Message == "" {
+				t.Error("expected error message")
+			}
+		})
+	}
+	if len(regions) != 0 {
+		t.Errorf("client should not be created for unauthorized request, got %v", regions)
+	}
+
+	t.Run("openapi without token", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/openapi.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var doc map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+			t.Fatalf("invalid openapi document: %v", err)
+		}
+	})
+}
+
+func TestRegion(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		regions    []string
+		statusCode int
+	}{
+		{name: "missing region", query: "", statusCode: http.StatusBadRequest},
+		{name: "invalid region", query: "?region=eu-west-2/../x", statusCode: http.StatusBadRequest},
+		{name: "valid region", query: "?region=eu-west-2", regions: []string{"eu-west-2"}, statusCode: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var regions []string
+			_, ts := newTestServer(t, failingClients(&regions, errs.FromAwsApi(errors.New("dial tcp: connection refused"), "sts get-caller-identity")))
+
+			resp, _ := do(t, http.MethodGet, ts.URL+"/v1/instances"+tt.query, testToken, nil)
+			if resp.StatusCode != tt.statusCode {
+				t.Errorf("expected %d, got %d", tt.statusCode, resp.StatusCode)
+			}
+			if fmt.Sprint(regions) != fmt.Sprint(tt.regions) {
+				t.Errorf("expected clients for %v regions, got %v", tt.regions, regions)
+			}
+		})
+	}
+}
+
+func TestNewError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+		kind       string
+	}{
+		{name: "bad request", err: fmt.Errorf("%w: name is required", errBadRequest), statusCode: http.StatusBadRequest},
+		{name: "not found", err: fmt.Errorf("instance x %w", ec2.ErrNotFound), statusCode: http.StatusNotFound},
+		{name: "already exists", err: fmt.Errorf("instance x %w", aws.ErrInstanceExists), statusCode: http.StatusConflict},
+		{
+			name:       "unknown client code",
+			err:        errs.FromAwsApi(&smithy.GenericAPIError{Code: "InvalidParameterValue", Fault: smithy.FaultClient}, "ec2 run-instances"),
+			statusCode: http.StatusBadRequest,
+			kind:       "AWS API error",
+		},
+		{
+			name:       "access denied",
+			err:        errs.FromAwsApi(&smithy.GenericAPIError{Code: "UnauthorizedOperation"}, "ec2 run-instances"),
+			statusCode: http.StatusForbidden,
+			kind:       "access denied",
+		},
+		{
+			name:       "aws internal error",
+			err:        errs.FromAwsApi(&smithy.GenericAPIError{Code: "InternalError"}, "ec2 run-instances"),
+			statusCode: http.StatusBadGateway,
+			kind:       "AWS internal error",
+		},
+		{name: "other error", err: errors.New("boom"), statusCode: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, statusCode := newError(tt.err)
+			if statusCode != tt.statusCode {
+				t.Errorf("expected %d, got %d", tt.statusCode, statusCode)
+			}
+			if out.Kind != tt.kind {
+				t.Errorf("expected kind %q, got %q", tt.kind, out.Kind)
+			}
+		})
+	}
+}
+
+func TestCreateInvalidBody(t *testing.T) {
+	var regions []string
+	_, ts := newTestServer(t, failingClients(&regions, errors.New("not called")))
+
+	resp, body := do(t, http.MethodPost, ts.URL+"/v1/instances", testToken, strings.NewReader(`{"name": "x", "unknown": 1}`))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(body.Message, "unknown") {
+		t.Errorf("expected unknown field in message, got %q", body.Message)
+	}
+}
+
+func TestCreateCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		message string
+	}{
+		{name: "over max count", body: `{"name": "x", "count": 10000}`, message: "count cannot be more than 10"},
+		{name: "negative count", body: `{"name": "x", "count": -1}`, message: "count and concurrency have to be at least 1"},
+		{name: "negative concurrency", body: `{"name": "x", "concurrency": -1}`, message: "count and concurrency have to be at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var regions []string
+			_, ts := newTestServer(t, failingClients(&regions, errors.New("not called")))
+
+			resp, body := do(t, http.MethodPost, ts.URL+"/v1/instances", testToken, strings.NewReader(tt.body))
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d", resp.StatusCode)
+			}
+			if !strings.Contains(body.Message, tt.message) {
+				t.Errorf("expected %q in message, got %q", tt.message, body.Message)
+			}
+			if len(regions) != 0 {
+				t.Errorf("expected request to be rejected before client is created, got regions %v", regions)
+			}
+		})
+	}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	s, ts := newTestServer(t, nil)
+	release := make(chan struct{})
+	job := s.jobs.start("create", "eu-west-2", "test", func(r progress.Reporter) ([]Result, error) {
+		progress.Report(r, progress.Event{Type: progress.Info, Instance: "ec2-test", Message: "launching"})
+		<-release
+		return []Result{{Name: "test", Error: toError(errors.New("boom"))}}, nil
+	})
+	if job.Status != JobRunning {
+		t.Fatalf("expected running job, got %s", job.Status)
+	}
+
+	resp, _ := do(t, http.MethodGet, ts.URL+"/v1/jobs/unknown", testToken, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown job: expected 404, got %d", resp.StatusCode)
+	}
+
+	close(release)
+	s.Wait()
+	got := getJob(t, ts.URL, job.Id)
+	if got.Status != JobFailed {
+		t.Errorf("expected failed job (instance failed), got %s", got.Status)
+	}
+	if got.FinishedAt == nil {
+		t.Error("expected finished time")
+	}
+	if len(got.Events) != 1 || got.Events[0].Message != "launching" {
+		t.Errorf("expected launching event, got %+v", got.Events)
+	}
+	if len(got.Results) != 1 || got.Results[0].Error == nil || got.Results[0].Error.Message != "boom" {
+		t.Errorf("expected failed result, got %+v", got.Results)
+	}
+}
+
+func TestJobEvents(t *testing.T) {
+	s, ts := newTestServer(t, nil)
+	release := make(chan struct{})
+	job := s.jobs.start("delete", "eu-west-2", "test", func(r progress.Reporter) ([]Result, error) {
+		for _, msg := range []string{"one", "two", "three"} {
+			progress.Report(r, progress.Event{Type: progress.Info, Message: msg})
+		}
+		<-release
+		progress.Report(r, progress.Event{Type: progress.Done, Message: "four"})
+		return []Result{{Name: "test"}}, nil
+	})
+
+	t.Run("live", func(t *testing.T) {
+		body := streamEvents(t, ts.URL, job.Id, "")
+		defer body.Close()
+		// events reported before the request are replayed, the last one is sent when the job continues
+		scanner := bufio.NewScanner(body)
+		events := readEvents(t, scanner, 3)
+		close(release)
+		events = append(events, readEvents(t, scanner, 2)...)
+		assertEvents(t, events, []string{"1 progress one", "2 progress two", "3 progress three", "4 progress four", "4 done succeeded"})
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		s.Wait()
+		body := streamEvents(t, ts.URL, job.Id, "2")
+		defer body.Close()
+		assertEvents(t, readEvents(t, bufio.NewScanner(body), 3), []string{"3 progress three", "4 progress four", "4 done succeeded"})
+	})
+}
+
+func getJob(t *testing.T, url, id string) Job {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url+"/v1/jobs/"+id, nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out Job
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func streamEvents(t *testing.T, url, id, lastEventId string) io.ReadCloser {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url+"/v1/jobs/"+id+"/events", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected event stream, got %s", ct)
+	}
+	return resp.Body
+}
+
+// readEvents reads n server-sent events and returns them as "<id> <event> <message or job status>"
+func readEvents(t *testing.T, scanner *bufio.Scanner, n int) []string {
+	t.Helper()
+	done := make(chan []string)
+	go func() {
+		var out []string
+		var id, event string
+		for len(out) < n && scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				var data struct {
+					Message string    `json:"message"`
+					Status  JobStatus `json:"status"`
+				}
+				_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data)
+				value := data.Message
+				if event == "done" {
+					value = string(data.Status)
+				}
+				out = append(out, fmt.Sprintf("%s %s %s", id, event, value))
+			}
+		}
+		done <- out
+	}()
+	select {
+	case out := <-done:
+		return out
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for %d events", n)
+		return nil
+	}
+}
+
+func assertEvents(t *testing.T, got, expected []string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected events:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const fileName = "state.json"
+
+// State is small amount of data remembered between runs, e.g. last used region
+type State struct {
+	LastRegion string `json:"last_region"`
+}
+
+// Load returns saved state, empty state is returned if the state has not been saved yet
+func Load() (State, error) {
+	path, err := statePath()
+	if err != nil {
+		return State{}, err
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("read state %s: %w", path, err)
+	}
+
+	var s State
+	if err := json.Unmarshal(b, &s); err != nil {
+		return State{}, fmt.Errorf("unmarshal state %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func Save(s State) error {
+	path, err := statePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("marshal state: %w", err)
+	}
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		return fmt.Errorf("write state %s: %w", path, err)
+	}
+	return nil
+}
+
+func statePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("user config dir: %w", err)
+	}
+	return filepath.Join(dir, "ec2", fileName), nil
+}
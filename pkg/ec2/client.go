@@ -0,0 +1,133 @@
+// Package ec2 is Go API of the ec2 tool. It creates, lists, deletes, starts and stops EC2 instances with the same
+// security group, instance profile and tags as the ec2 command, so instances created by the library and by the
+// command can be managed by either of them. Instance names are supplied and returned without the "ec2-" prefix.
+// The library never prompts, prints to stdout or exits the process.
+package ec2
+
+import (
+	"context"
+	"fmt"
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/cache"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/pete911/ec2/internal/progress"
+	"io"
+	"log/slog"
+)
+
+type Client struct {
+	client ec2.Client
+	// Region and AccountId of the AWS config the client was created with
+	Region    string
+	AccountId string
+}
+
+type options struct {
+	logger      *slog.Logger
+	reporter    progress.Reporter
+	logApiCalls bool
+}
+
+// Option configures Client
+type Option func(*options)
+
+// WithLogger sets logger, logs are discarded by default
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// WithProgress sets function that receives create and delete progress events, it is called concurrently when
+// instances are created or deleted in batch
+func WithProgress(fn func(Event)) Option {
+	return func(o *options) { o.reporter = reporterFunc(fn) }
+}
+
+// WithApiCallLogging logs every AWS API call with operation, latency, retry count and request id at info level
+func WithApiCallLogging() Option {
+	return func(o *options) { o.logApiCalls = true }
+}
+
+// New creates client from AWS config, region and credentials (and custom endpoint, HTTP client, ...) are taken from
+// the config. Caller identity is verified by STS call
+func New(ctx context.Context, cfg awssdk.Config, opts ...Option) (*Client, error) {
+	o := options{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("%w: aws config region is not set", ErrInvalidOption)
+	}
+
+	awsClient, err := aws.NewClientFromConfig(ctx, o.logger, cfg, aws.Options{LogApiCalls: o.logApiCalls})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	// cache is shared with the command on the same machine, library always reads fresh data
+	client := ec2.NewClient(o.logger, awsClient, cache.New(o.logger, 0, false))
+	if o.reporter != nil {
+		client = client.WithReporter(o.reporter)
+	}
+	return &Client{client: client, Region: awsClient.Region, AccountId: awsClient.AccountId}, nil
+}
+
+// List returns instances in any state except terminated
+func (c *Client) List(ctx context.Context) ([]Instance, error) {
+	instances, err := c.client.WithContext(ctx).ListAll()
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	var out []Instance
+	for _, instance := range instances {
+		out = append(out, toInstance(instance))
+	}
+	return out, nil
+}
+
+// Get returns instance by name, ErrNotFound is returned if it does not exist
+func (c *Client) Get(ctx context.Context, name string) (Instance, error) {
+	instance, err := c.get(ctx, name)
+	if err != nil {
+		return Instance{}, err
+	}
+	return toInstance(instance), nil
+}
+
+// Delete terminates instance and deletes its security group, instance profile, elastic IP, SSM endpoints and VPC
+// created with it (shared resources are deleted only if they are not used by other instances)
+func (c *Client) Delete(ctx context.Context, name string) error {
+	instance, err := c.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	return wrapError(c.client.WithContext(ctx).Delete(instance))
+}
+
+// Start starts stopped instance, it does not wait for the instance to be running
+func (c *Client) Start(ctx context.Context, name string) error {
+	instance, err := c.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	return wrapError(c.client.WithContext(ctx).Start(instance))
+}
+
+// Stop stops running instance, it does not wait for the instance to be stopped
+func (c *Client) Stop(ctx context.Context, name string) error {
+	instance, err := c.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	return wrapError(c.client.WithContext(ctx).Stop(instance))
+}
+
+func (c *Client) get(ctx context.Context, name string) (aws.Instance, error) {
+	instance, err := c.client.WithContext(ctx).FindInstance(name)
+	return instance, wrapError(err)
+}
+
+type reporterFunc func(Event)
+
+func (f reporterFunc) Report(e progress.Event) {
+	f(e)
+}
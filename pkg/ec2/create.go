@@ -0,0 +1,160 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pete911/ec2/internal/aws/vpc"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/pete911/ec2/internal/errs"
+)
+
+type createOptions struct {
+	subnetId    string
+	image       string
+	concurrency int
+	opts        ec2.CreateOptions
+}
+
+// CreateOption configures Create and CreateBatch
+type CreateOption func(*createOptions)
+
+// WithSubnet sets subnet the instance is launched in, it is required unless WithNewVpc is used
+func WithSubnet(subnetId string) CreateOption {
+	return func(o *createOptions) { o.subnetId = subnetId }
+}
+
+// WithIpv6 assigns IPv6 address, subnet has to have IPv6 CIDR block
+func WithIpv6() CreateOption {
+	return func(o *createOptions) { o.opts.Ipv6 = true }
+}
+
+// WithNewVpc creates VPC with public subnet for the instance, VPC is deleted with its last instance
+func WithNewVpc() CreateOption {
+	return func(o *createOptions) { o.opts.NewVpc = true }
+}
+
+// WithNewVpcCidr sets CIDR block of the VPC created by WithNewVpc (IPv4 /16 to /28, default 10.0.0.0/16), subnet is
+// the first /24 of it
+func WithNewVpcCidr(cidr string) CreateOption {
+	return func(o *createOptions) { o.opts.NewVpcCidr = cidr }
+}
+
+// WithSSMEndpoints creates (or reuses) SSM VPC endpoints, so instance is reachable without internet access
+func WithSSMEndpoints() CreateOption {
+	return func(o *createOptions) { o.opts.SsmEndpoints = true }
+}
+
+// WithElasticIp allocates and associates elastic IP, it is released when the instance is deleted
+func WithElasticIp() CreateOption {
+	return func(o *createOptions) { o.opts.Eip = true }
+}
+
+// WithImage launches instance from image created by the ec2 image create command (name or id)
+func WithImage(image string) CreateOption {
+	return func(o *createOptions) { o.image = image }
+}
+
+// WithConcurrency sets maximum number of instances created in parallel by CreateBatch, default is 5
+func WithConcurrency(concurrency int) CreateOption {
+	return func(o *createOptions) { o.concurrency = concurrency }
+}
+
+type CreateResult struct {
+	Name     string
+	Instance Instance
+	// Err is set if the instance failed to launch or did not become ready
+	Err error
+}
+
+// Create creates instance and waits for it to pass status checks. NotReadyError is returned if the instance is
+// launched, but does not become ready, the instance is not deleted. If the instance is ready, but elastic IP could not
+// be attached, the instance is returned with the error
+func (c *Client) Create(ctx context.Context, name string, opts ...CreateOption) (Instance, error) {
+	client := c.client.WithContext(ctx)
+	o, subnet, err := c.createOptions(client, opts)
+	if err != nil {
+		return Instance{}, err
+	}
+	instance, err := client.Create(name, subnet, o.opts)
+	if err != nil && instance.Id == "" {
+		return Instance{}, wrapError(err)
+	}
+	return toInstance(instance), wrapError(err)
+}
+
+// CreateBatch creates count instances named <name>-1 to <name>-<count> spread across availability zones of the
+// subnet VPC. Error is returned only if shared resources could not be created, failures of the individual instances
+// are returned in the results
+func (c *Client) CreateBatch(ctx context.Context, name string, count int, opts ...CreateOption) ([]CreateResult, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("%w: count has to be at least 1", ErrInvalidOption)
+	}
+	client := c.client.WithContext(ctx)
+	o, subnet, err := c.createOptions(client, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var subnets []vpc.Subnet
+	if !o.opts.NewVpc {
+		if subnets, err = client.SpreadSubnets(subnet); err != nil {
+			return nil, wrapError(err)
+		}
+	}
+	results, err := client.CreateBatch(name, count, o.concurrency, subnets, o.opts)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	var out []CreateResult
+	for _, result := range results {
+		out = append(out, CreateResult{Name: result.Name, Instance: toInstance(result.Instance), Err: wrapError(result.Err)})
+	}
+	return out, nil
+}
+
+// createOptions applies and validates options, subnet is resolved unless new VPC is created
+func (c *Client) createOptions(client ec2.Client, opts []CreateOption) (createOptions, vpc.Subnet, error) {
+	o := createOptions{concurrency: 5}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.image != "" {
+		image, err := client.GetImage(o.image)
+		var apiErr *errs.ApiError
+		if errors.As(err, &apiErr) {
+			return o, vpc.Subnet{}, wrapError(err)
+		}
+		if err != nil {
+			return o, vpc.Subnet{}, fmt.Errorf("image %s: %w", o.image, ErrNotFound)
+		}
+		o.opts.ImageId = image.Id
+	}
+
+	if o.opts.NewVpc {
+		if o.subnetId != "" || o.opts.Ipv6 {
+			return o, vpc.Subnet{}, fmt.Errorf("%w: new vpc cannot be used with subnet or ipv6", ErrInvalidOption)
+		}
+		if _, _, err := vpc.NetworkCidrBlocks(o.opts.NewVpcCidr); err != nil {
+			return o, vpc.Subnet{}, fmt.Errorf("%w: %v", ErrInvalidOption, err)
+		}
+		return o, vpc.Subnet{}, nil
+	}
+	if o.opts.NewVpcCidr != "" {
+		return o, vpc.Subnet{}, fmt.Errorf("%w: new vpc cidr can only be used with new vpc", ErrInvalidOption)
+	}
+	if o.subnetId == "" {
+		return o, vpc.Subnet{}, fmt.Errorf("%w: subnet is required", ErrInvalidOption)
+	}
+
+	subnet, err := client.GetSubnet(o.subnetId)
+	if err != nil {
+		return o, vpc.Subnet{}, wrapError(err)
+	}
+	if o.opts.Ipv6 && !subnet.HasIpv6() {
+		return o, vpc.Subnet{}, fmt.Errorf("%w: subnet %s does not have IPv6 CIDR block", ErrInvalidOption, subnet.Id)
+	}
+	return o, subnet, nil
+}
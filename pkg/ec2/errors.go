@@ -0,0 +1,105 @@
+package ec2
+
+import (
+	"errors"
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/pete911/ec2/internal/errs"
+)
+
+var (
+	// ErrNotFound is returned when instance (or subnet, image) does not exist
+	ErrNotFound = ec2.ErrNotFound
+	// ErrAlreadyExists is returned by create when instance with the same name exists in any state except terminated
+	ErrAlreadyExists = aws.ErrInstanceExists
+	// ErrInvalidOption is returned when options are missing or cannot be combined
+	ErrInvalidOption = errors.New("invalid option")
+)
+
+// ErrorKind classifies AWS API errors
+type ErrorKind string
+
+const (
+	KindUnknown              ErrorKind = "unknown"
+	KindNotFound             ErrorKind = "not-found"
+	KindConflict             ErrorKind = "conflict"
+	KindAccessDenied         ErrorKind = "access-denied"
+	KindCredentials          ErrorKind = "credentials"
+	KindThrottling           ErrorKind = "throttling"
+	KindQuotaExceeded        ErrorKind = "quota-exceeded"
+	KindInsufficientCapacity ErrorKind = "insufficient-capacity"
+	KindInternal             ErrorKind = "internal"
+)
+
+// APIError is error returned by AWS API
+type APIError struct {
+	Kind ErrorKind
+	// Code and Message are AWS API error code and message
+	Code    string
+	Message string
+	// Hint is actionable message for the user, it can be empty
+	Hint string
+	err  error
+}
+
+func (e *APIError) Error() string {
+	return e.err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.err
+}
+
+// NotReadyError is returned by create when instance is launched, but does not pass status checks. Instance is not
+// deleted, ConsoleTail contains last lines of its console output
+type NotReadyError struct {
+	InstanceId  string
+	ConsoleTail string
+	err         error
+}
+
+func (e *NotReadyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *NotReadyError) Unwrap() error {
+	return e.err
+}
+
+// wrapError converts internal errors to the package error types, the original error is kept in the chain
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var notReady *ec2.NotReadyError
+	if errors.As(err, &notReady) {
+		return &NotReadyError{InstanceId: notReady.InstanceId, ConsoleTail: notReady.ConsoleTail, err: err}
+	}
+	var apiErr *errs.ApiError
+	if errors.As(err, &apiErr) {
+		return &APIError{Kind: toErrorKind(apiErr.Class), Code: apiErr.Code, Message: apiErr.Message, Hint: apiErr.Hint(), err: err}
+	}
+	return err
+}
+
+func toErrorKind(class errs.Class) ErrorKind {
+	switch class {
+	case errs.ClassNotFound:
+		return KindNotFound
+	case errs.ClassConflict:
+		return KindConflict
+	case errs.ClassAccessDenied:
+		return KindAccessDenied
+	case errs.ClassCredentials:
+		return KindCredentials
+	case errs.ClassThrottling:
+		return KindThrottling
+	case errs.ClassQuotaExceeded:
+		return KindQuotaExceeded
+	case errs.ClassInsufficientCapacity:
+		return KindInsufficientCapacity
+	case errs.ClassInternal:
+		return KindInternal
+	}
+	return KindUnknown
+}
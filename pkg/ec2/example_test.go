@@ -0,0 +1,179 @@
+package ec2_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/pete911/ec2/pkg/ec2"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+)
+
+const (
+	callerIdentityResponse  = `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><GetCallerIdentityResult><Arn>arn:aws:iam::123456789012:user/test</Arn><UserId>AIDAEXAMPLE</UserId><Account>123456789012</Account></GetCallerIdentityResult><ResponseMetadata><RequestId>req-1</RequestId></ResponseMetadata></GetCallerIdentityResponse>`
+	vpcsResponse            = `<DescribeVpcsResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>req-2</requestId><vpcSet><item><vpcId>vpc-1</vpcId><state>available</state><cidrBlock>10.0.0.0/16</cidrBlock></item></vpcSet></DescribeVpcsResponse>`
+	subnetsResponse         = `<DescribeSubnetsResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>req-3</requestId><subnetSet><item><subnetId>subnet-1</subnetId><vpcId>vpc-1</vpcId><state>available</state><cidrBlock>10.0.0.0/24</cidrBlock><availabilityZone>eu-west-2a</availabilityZone></item></subnetSet></DescribeSubnetsResponse>`
+	routeTablesResponse     = `<DescribeRouteTablesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>req-4</requestId><routeTableSet/></DescribeRouteTablesResponse>`
+	vpcEndpointsResponse    = `<DescribeVpcEndpointsResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>req-5</requestId><vpcEndpointSet/></DescribeVpcEndpointsResponse>`
+	noInstancesResponse     = `<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>req-6</requestId><reservationSet/></DescribeInstancesResponse>`
+	stoppedInstanceResponse = `<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>req-6</requestId><reservationSet><item><reservationId>r-1</reservationId><instancesSet><item><instanceId>i-0123456789abcdef0</instanceId><imageId>ami-1</imageId><instanceState><code>80</code><name>stopped</name></instanceState><instanceType>t3.micro</instanceType><subnetId>subnet-1</subnetId><vpcId>vpc-1</vpcId><tagSet><item><key>Name</key><value>ec2-test</value></item></tagSet></item></instancesSet></item></reservationSet></DescribeInstancesResponse>`
+	unauthorizedResponse    = `<Response><Errors><Error><Code>UnauthorizedOperation</Code><Message>You are not authorized to perform this operation.</Message></Error></Errors><RequestID>req-7</RequestID></Response>`
+)
+
+// newFakeAWS starts server that responds to STS caller identity and EC2 describe calls, describe instances response
+// and status are set by the example
+func newFakeAWS(instancesStatus int, instancesResponse string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body := string(b)
+		w.Header().Set("Content-Type", "text/xml")
+		switch {
+		case strings.Contains(body, "Action=GetCallerIdentity"):
+			io.WriteString(w, callerIdentityResponse)
+		case strings.Contains(body, "Action=DescribeVpcs"):
+			io.WriteString(w, vpcsResponse)
+		case strings.Contains(body, "Action=DescribeSubnets"):
+			io.WriteString(w, subnetsResponse)
+		case strings.Contains(body, "Action=DescribeRouteTables"):
+			io.WriteString(w, routeTablesResponse)
+		case strings.Contains(body, "Action=DescribeVpcEndpoints"):
+			io.WriteString(w, vpcEndpointsResponse)
+		case strings.Contains(body, "Action=DescribeInstances"):
+			// stopped instance is returned only if the state filter includes it, as AWS does
+			if instancesResponse == stoppedInstanceResponse && !strings.Contains(body, "=stopped") {
+				io.WriteString(w, noInstancesResponse)
+				return
+			}
+			w.WriteHeader(instancesStatus)
+			io.WriteString(w, instancesResponse)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `<Response><Errors><Error><Code>InvalidAction</Code><Message>unexpected request</Message></Error></Errors><RequestID>req-0</RequestID></Response>`)
+		}
+	}))
+}
+
+// newFakeClient creates client with static credentials that sends requests to the fake AWS server
+func newFakeClient(server *httptest.Server) *ec2.Client {
+	cfg := awssdk.Config{
+		Region:       "eu-west-2",
+		BaseEndpoint: awssdk.String(server.URL),
+		Credentials: awssdk.CredentialsProviderFunc(func(context.Context) (awssdk.Credentials, error) {
+			return awssdk.Credentials{AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret"}, nil
+		}),
+		RetryMaxAttempts: 1,
+	}
+	client, err := ec2.New(context.Background(), cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return client
+}
+
+func ExampleNew() {
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("eu-west-2"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	client, err := ec2.New(ctx, cfg, ec2.WithLogger(logger), ec2.WithApiCallLogging(), ec2.WithProgress(func(e ec2.Event) {
+		fmt.Printf("%s %s: %s\n", e.Instance, e.Type, e.Message)
+	}))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(client.AccountId, client.Region)
+}
+
+func ExampleClient_Create() {
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("eu-west-2"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := ec2.New(ctx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	instance, err := client.Create(ctx, "test", ec2.WithSubnet("subnet-0123456789abcdef0"), ec2.WithIpv6(), ec2.WithElasticIp())
+	var notReady *ec2.NotReadyError
+	switch {
+	case errors.Is(err, ec2.ErrAlreadyExists):
+		fmt.Println("instance test already exists")
+	case errors.As(err, &notReady):
+		fmt.Printf("instance %s is not ready, console output:\n%s\n", notReady.InstanceId, notReady.ConsoleTail)
+	case err != nil && instance.Id != "":
+		fmt.Printf("instance %s is ready, but: %v\n", instance.Id, err)
+	case err != nil:
+		log.Fatal(err)
+	default:
+		fmt.Println(instance.Id, instance.PublicIp)
+	}
+}
+
+func ExampleClient_Create_alreadyExists() {
+	server := newFakeAWS(http.StatusOK, stoppedInstanceResponse)
+	defer server.Close()
+	client := newFakeClient(server)
+
+	// instance with the same name is stopped, but it still holds the name
+	_, err := client.Create(context.Background(), "test", ec2.WithSubnet("subnet-1"))
+	fmt.Println(errors.Is(err, ec2.ErrAlreadyExists))
+	fmt.Println(err)
+	// Output:
+	// true
+	// stopped instance with ec2-test name already exists
+}
+
+func ExampleClient_Create_invalidOption() {
+	server := newFakeAWS(http.StatusOK, noInstancesResponse)
+	defer server.Close()
+	client := newFakeClient(server)
+
+	_, err := client.Create(context.Background(), "test", ec2.WithNewVpc(), ec2.WithSubnet("subnet-1"))
+	fmt.Println(errors.Is(err, ec2.ErrInvalidOption))
+	fmt.Println(err)
+	_, err = client.Create(context.Background(), "test", ec2.WithSubnet("subnet-1"), ec2.WithIpv6())
+	fmt.Println(err)
+	_, err = client.CreateBatch(context.Background(), "test", 0, ec2.WithSubnet("subnet-1"), ec2.WithConcurrency(2))
+	fmt.Println(err)
+	// Output:
+	// true
+	// invalid option: new vpc cannot be used with subnet or ipv6
+	// invalid option: subnet subnet-1 does not have IPv6 CIDR block
+	// invalid option: count has to be at least 1
+}
+
+func ExampleClient_Get_notFound() {
+	server := newFakeAWS(http.StatusOK, noInstancesResponse)
+	defer server.Close()
+	client := newFakeClient(server)
+
+	_, err := client.Get(context.Background(), "test")
+	fmt.Println(errors.Is(err, ec2.ErrNotFound))
+	// Output:
+	// true
+}
+
+func ExampleAPIError() {
+	server := newFakeAWS(http.StatusForbidden, unauthorizedResponse)
+	defer server.Close()
+	client := newFakeClient(server)
+
+	err := client.Stop(context.Background(), "test")
+	var apiErr *ec2.APIError
+	if errors.As(err, &apiErr) {
+		fmt.Println(apiErr.Kind, apiErr.Code)
+	}
+	// Output:
+	// access-denied UnauthorizedOperation
+}
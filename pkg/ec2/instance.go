@@ -0,0 +1,72 @@
+package ec2
+
+import (
+	"github.com/pete911/ec2/internal/aws"
+	"github.com/pete911/ec2/internal/ec2"
+	"github.com/pete911/ec2/internal/progress"
+	"strings"
+	"time"
+)
+
+// Event is create or delete progress event
+type Event = progress.Event
+
+// EventType is type of the progress event
+type EventType = progress.Type
+
+const (
+	EventCreated EventType = progress.Created
+	EventDeleted EventType = progress.Deleted
+	EventState   EventType = progress.State
+	EventCheck   EventType = progress.Check
+	EventInfo    EventType = progress.Info
+	EventDone    EventType = progress.Done
+	EventFailed  EventType = progress.Failed
+)
+
+type Instance struct {
+	Id   string
+	Name string
+	// State is pending, running, stopping or stopped
+	State            string
+	InstanceType     string
+	ImageId          string
+	VpcId            string
+	SubnetId         string
+	PublicDnsName    string
+	PublicIp         string
+	PublicIpElastic  bool
+	PrivateDnsName   string
+	PrivateIp        string
+	Ipv6Address      string
+	SecurityGroupIds []string
+	InstanceProfile  string
+	LaunchTime       time.Time
+	Tags             map[string]string
+}
+
+func toInstance(in aws.Instance) Instance {
+	var securityGroupIds []string
+	for _, sg := range in.SecurityGroups {
+		securityGroupIds = append(securityGroupIds, sg.Id)
+	}
+	return Instance{
+		Id:               in.Id,
+		Name:             strings.TrimPrefix(in.Name, ec2.NamePrefix),
+		State:            in.State,
+		InstanceType:     in.InstanceType,
+		ImageId:          in.ImageId,
+		VpcId:            in.VpcId,
+		SubnetId:         in.SubnetId,
+		PublicDnsName:    in.PublicDnsName,
+		PublicIp:         in.PublicIp,
+		PublicIpElastic:  in.PublicIpElastic,
+		PrivateDnsName:   in.PrivateDnsName,
+		PrivateIp:        in.PrivateIp,
+		Ipv6Address:      in.Ipv6Address,
+		SecurityGroupIds: securityGroupIds,
+		InstanceProfile:  in.InstanceProfile,
+		LaunchTime:       in.LaunchTime,
+		Tags:             in.Tags,
+	}
+}